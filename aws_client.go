@@ -0,0 +1,210 @@
+package connector
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AdRoll/goamz/aws"
+)
+
+// AwsError is an error response from one of the AWS services called through awsClient.
+type AwsError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *AwsError) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// awsClient is a minimal SigV4 signing client for the AWS query (SQS, SNS) and JSON
+// (Firehose, DynamoDB) protocols. Endpoint can point at a local stand-in for testing.
+type awsClient struct {
+	Service  string
+	Region   string
+	Endpoint string
+	Auth     aws.Auth
+	HTTP     *http.Client
+
+	// JSONVersion is the version of the JSON protocol the service speaks, 1.1 when empty.
+	JSONVersion string
+}
+
+// newAwsClient builds a client for service signing with auth, or with credentials from the
+// environment when auth is nil. An empty region means us-east-1 and an empty endpoint the
+// service's public endpoint in the region.
+func newAwsClient(service string, region string, endpoint string, auth *aws.Auth) (*awsClient, error) {
+	if region == "" {
+		region = aws.USEast.Name
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", service, region)
+	}
+	if auth == nil {
+		envAuth, err := aws.EnvAuth()
+		if err != nil {
+			return nil, err
+		}
+		auth = &envAuth
+	}
+	return &awsClient{
+		Service:  service,
+		Region:   region,
+		Endpoint: endpoint,
+		Auth:     *auth,
+		HTTP:     &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// callQuery calls a query protocol action and decodes the XML response into out.
+func (c *awsClient) callQuery(rawurl string, params url.Values, out interface{}) error {
+	body := []byte(params.Encode())
+	req, err := http.NewRequest("POST", rawurl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	resp, err := c.do(req, body)
+	if err != nil {
+		return err
+	}
+
+	if resp.status >= 300 {
+		var e struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		xml.Unmarshal(resp.body, &e)
+		return &AwsError{StatusCode: resp.status, Code: e.Code, Message: e.Message}
+	}
+	return xml.Unmarshal(resp.body, out)
+}
+
+// callJSON calls a JSON protocol operation, e.g. Firehose_20150804.PutRecordBatch, and decodes
+// the response into out.
+func (c *awsClient) callJSON(target string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	version := c.JSONVersion
+	if version == "" {
+		version = "1.1"
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-"+version)
+	req.Header.Set("X-Amz-Target", target)
+
+	resp, err := c.do(req, body)
+	if err != nil {
+		return err
+	}
+
+	if resp.status >= 300 {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(resp.body, &e)
+		// __type may be namespaced, e.g. com.amazonaws.firehose#ServiceUnavailableException
+		code := e.Type[strings.LastIndex(e.Type, "#")+1:]
+		return &AwsError{StatusCode: resp.status, Code: code, Message: e.Message}
+	}
+	return json.Unmarshal(resp.body, out)
+}
+
+type awsResponse struct {
+	status int
+	body   []byte
+}
+
+func (c *awsClient) do(req *http.Request, body []byte) (*awsResponse, error) {
+	c.sign(req, body, time.Now())
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &awsResponse{status: resp.StatusCode, body: b}, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (c *awsClient) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if token := c.Auth.Token(); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	req.Header.Set("Host", req.URL.Host)
+
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := new(bytes.Buffer)
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + c.Region + "/" + c.Service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.Auth.SecretKey), date)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, c.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	// Host is sent from req.Host by net/http, not from the header map
+	req.Header.Del("Host")
+	req.Host = req.URL.Host
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.Auth.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdRoll/goamz/aws"
+)
+
+// testAwsAuth signs requests to local stand-ins, so that tests do not read the environment.
+var testAwsAuth = &aws.Auth{AccessKey: "AKID", SecretKey: "secret"}
+
+func TestAwsClientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.firehose#ResourceNotFoundException","message":"no such stream"}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`<ErrorResponse><Error><Code>ServiceUnavailable</Code><Message>try again</Message></Error></ErrorResponse>`))
+	}))
+	defer server.Close()
+
+	c := &awsClient{Service: "test", Region: "us-east-1", Endpoint: server.URL, HTTP: http.DefaultClient}
+
+	err := c.callJSON("Firehose_20150804.PutRecordBatch", struct{}{}, &struct{}{})
+	want := &AwsError{StatusCode: 400, Code: "ResourceNotFoundException", Message: "no such stream"}
+	if e, ok := err.(*AwsError); !ok || *e != *want {
+		t.Errorf("callJSON() error = %v want %v", err, want)
+	}
+
+	err = c.callQuery(server.URL, url.Values{}, &struct{}{})
+	want = &AwsError{StatusCode: 503, Code: "ServiceUnavailable", Message: "try again"}
+	if e, ok := err.(*AwsError); !ok || *e != *want {
+		t.Errorf("callQuery() error = %v want %v", err, want)
+	}
+	if !IsRecoverableError(err) {
+		t.Errorf("IsRecoverableError(%v) = false want true", err)
+	}
+}
+
+func TestAwsClientSign(t *testing.T) {
+	c := &awsClient{Service: "sqs", Region: "us-east-1", Auth: aws.Auth{AccessKey: "AKID", SecretKey: "secret"}}
+	req, _ := http.NewRequest("POST", "https://sqs.us-east-1.amazonaws.com/123/queue", strings.NewReader("Action=SendMessageBatch"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	c.sign(req, []byte("Action=SendMessageBatch"), time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	if d := req.Header.Get("X-Amz-Date"); d != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %v want %v", d, "20150830T123600Z")
+	}
+	prefix := "AWS4-HMAC-SHA256 Credential=AKID/20150830/us-east-1/sqs/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature="
+	if a := req.Header.Get("Authorization"); !strings.HasPrefix(a, prefix) || len(a) != len(prefix)+64 {
+		t.Errorf("Authorization = %v want prefix %v and a 64 character signature", a, prefix)
+	}
+	if req.Host != "sqs.us-east-1.amazonaws.com" {
+		t.Errorf("Host = %v want %v", req.Host, "sqs.us-east-1.amazonaws.com")
+	}
+}
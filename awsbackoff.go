@@ -124,6 +124,36 @@ func s3IsRecoverableError(err error) bool {
 	return r
 }
 
+func awsIsRecoverableError(err error) bool {
+	recoverableErrorCodes := map[string]bool{
+		"InternalError":                          true,
+		"InternalFailure":                        true,
+		"ProvisionedThroughputExceededException": true,
+		"RequestLimitExceeded":                   true,
+		"RequestThrottled":                       true,
+		"ServiceUnavailable":                     true,
+		"ServiceUnavailableException":            true,
+		"Throttling":                             true,
+		"ThrottlingException":                    true,
+	}
+	r := false
+	cErr, ok := err.(*AwsError)
+	if ok && (recoverableErrorCodes[cErr.Code] == true || cErr.StatusCode >= http.StatusInternalServerError || cErr.StatusCode == http.StatusTooManyRequests) {
+		r = true
+	}
+	return r
+}
+
+func elasticsearchIsRecoverableError(err error) bool {
+	cErr, ok := err.(*ElasticsearchError)
+	return ok && (cErr.StatusCode == http.StatusTooManyRequests || cErr.StatusCode >= http.StatusInternalServerError)
+}
+
+func httpIsRecoverableError(err error) bool {
+	cErr, ok := err.(*HTTPError)
+	return ok && (cErr.StatusCode == http.StatusTooManyRequests || cErr.StatusCode >= http.StatusInternalServerError)
+}
+
 func sqlIsRecoverableError(err error) bool {
 	r := false
 
@@ -135,13 +165,16 @@ func sqlIsRecoverableError(err error) bool {
 }
 
 var recoverableErrorTesters = map[string]RecoverableErrorTester{
-	"kinesis":  NewRecoverableErrorTester(kinesisIsRecoverableError),
-	"network":  NewRecoverableErrorTester(netIsRecoverableError),
-	"url":      NewRecoverableErrorTester(urlIsRecoverableError),
-	"redshift": NewRecoverableErrorTester(redshiftIsRecoverableError),
-	"s3":       NewRecoverableErrorTester(s3IsRecoverableError),
-	"sql":      NewRecoverableErrorTester(sqlIsRecoverableError),
-	"text":     NewRecoverableErrorTester(textIsRecoverableError),
+	"aws":           NewRecoverableErrorTester(awsIsRecoverableError),
+	"elasticsearch": NewRecoverableErrorTester(elasticsearchIsRecoverableError),
+	"http":          NewRecoverableErrorTester(httpIsRecoverableError),
+	"kinesis":       NewRecoverableErrorTester(kinesisIsRecoverableError),
+	"network":       NewRecoverableErrorTester(netIsRecoverableError),
+	"url":           NewRecoverableErrorTester(urlIsRecoverableError),
+	"redshift":      NewRecoverableErrorTester(redshiftIsRecoverableError),
+	"s3":            NewRecoverableErrorTester(s3IsRecoverableError),
+	"sql":           NewRecoverableErrorTester(sqlIsRecoverableError),
+	"text":          NewRecoverableErrorTester(textIsRecoverableError),
 }
 
 // this determines whether the error is recoverable
@@ -24,6 +24,13 @@ func Test_isRecoverableError(t *testing.T) {
 		{err: fmt.Errorf("an arbitrary error"), isRecoverable: false},
 		{err: fmt.Errorf("The specified S3 prefix 'somefilethatismissing' does not exist"), isRecoverable: true},
 		{err: fmt.Errorf("Some other pq error"), isRecoverable: false},
+		{err: &AwsError{StatusCode: 400, Code: "ThrottlingException"}, isRecoverable: true},
+		{err: &AwsError{StatusCode: 503, Code: "ServiceUnavailable"}, isRecoverable: true},
+		{err: &AwsError{StatusCode: 400, Code: "InvalidParameterValue"}, isRecoverable: false},
+		{err: &ElasticsearchError{StatusCode: 429, Type: "es_rejected_execution_exception"}, isRecoverable: true},
+		{err: &ElasticsearchError{StatusCode: 400, Type: "mapper_parsing_exception"}, isRecoverable: false},
+		{err: &HTTPError{StatusCode: 502}, isRecoverable: true},
+		{err: &HTTPError{StatusCode: 404}, isRecoverable: false},
 		{err: &s3.Error{StatusCode: 503, Code: "SlowDown", Message: "Please reduce your request rate.", BucketName: "", RequestId: "0EEC0F7AF7C87037", HostId: "cTwRlKBZcAAVC3CrL2JS2L948Tcr1sTXszbahGcIalThT3fZVQMSyNK9+78m+m23SZrZl9rw1GY="}, isRecoverable: true},
 
 		//"InternalFailure":                        true,
@@ -0,0 +1,89 @@
+package connector
+
+import (
+	"fmt"
+	"strconv"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// batchRanges splits items with the given sizes, in order, into [start, end) ranges of at
+// most maxCount items and maxBytes bytes. An item larger than maxBytes gets a range of its own.
+func batchRanges(sizes []int, maxCount int, maxBytes int) [][2]int {
+	var ranges [][2]int
+	start, size := 0, 0
+	for i, n := range sizes {
+		if i > start && (i-start == maxCount || size+n > maxBytes) {
+			ranges = append(ranges, [2]int{start, i})
+			start, size = i, 0
+		}
+		size += n
+	}
+	if start < len(sizes) {
+		ranges = append(ranges, [2]int{start, len(sizes)})
+	}
+	return ranges
+}
+
+// sendWithRetry sends the items identified by ids with send, which returns the ids that failed
+// with a retryable per-item error. Only those are resubmitted, with the aws backoff between
+// attempts. Errors returned by send abort unless they are recoverable.
+func sendWithRetry(ids []int, send func(ids []int) ([]int, error), infoString string) error {
+	var err error
+	for i := 0; i < 10; i++ {
+		HandleAwsWaitTimeExp(i, infoString)
+
+		var failed []int
+		failed, err = send(ids)
+		if err != nil {
+			if IsRecoverableError(err) {
+				l4g.Warn("recoverable error %v for %s", err, infoString)
+				continue
+			}
+			return err
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+
+		l4g.Warn("%d of %d entries failed for %s, retrying them", len(failed), len(ids), infoString)
+		ids = failed
+		err = fmt.Errorf("%d entries still failing after retries for %s", len(failed), infoString)
+	}
+	return err
+}
+
+// indexes returns the ints in [start, end).
+func indexes(start int, end int) []int {
+	ids := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		ids = append(ids, i)
+	}
+	return ids
+}
+
+// batchEntryFailure is a failed entry of an SQS SendMessageBatch or SNS PublishBatch response.
+// Entry ids are the indexes of the records they carry.
+type batchEntryFailure struct {
+	Id          string
+	Code        string
+	Message     string
+	SenderFault bool
+}
+
+// failedEntries returns the ids of the failed entries to retry. An entry failed through the
+// sender's fault will fail again, so it fails the whole batch instead.
+func failedEntries(failures []batchEntryFailure) ([]int, error) {
+	var failed []int
+	for _, f := range failures {
+		if f.SenderFault {
+			return nil, &AwsError{Code: f.Code, Message: fmt.Sprintf("entry %s: %s", f.Id, f.Message)}
+		}
+		id, err := strconv.Atoi(f.Id)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected batch entry id %q", f.Id)
+		}
+		failed = append(failed, id)
+	}
+	return failed, nil
+}
@@ -0,0 +1,68 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBatchRanges(t *testing.T) {
+	testCases := []struct {
+		sizes    []int
+		maxCount int
+		maxBytes int
+		ranges   [][2]int
+	}{
+		{sizes: nil, maxCount: 10, maxBytes: 100, ranges: nil},
+		{sizes: []int{1, 1, 1}, maxCount: 10, maxBytes: 100, ranges: [][2]int{{0, 3}}},
+		{sizes: []int{1, 1, 1, 1, 1}, maxCount: 2, maxBytes: 100, ranges: [][2]int{{0, 2}, {2, 4}, {4, 5}}},
+		{sizes: []int{40, 40, 40}, maxCount: 10, maxBytes: 100, ranges: [][2]int{{0, 2}, {2, 3}}},
+		{sizes: []int{150, 10}, maxCount: 10, maxBytes: 100, ranges: [][2]int{{0, 1}, {1, 2}}},
+	}
+
+	for idx, tc := range testCases {
+		if r := batchRanges(tc.sizes, tc.maxCount, tc.maxBytes); !reflect.DeepEqual(r, tc.ranges) {
+			t.Errorf("test case %d: batchRanges(%v, %v, %v) = %v want %v", idx, tc.sizes, tc.maxCount, tc.maxBytes, r, tc.ranges)
+		}
+	}
+}
+
+func TestSendWithRetry(t *testing.T) {
+	var calls [][]int
+	err := sendWithRetry([]int{0, 1, 2, 3}, func(ids []int) ([]int, error) {
+		calls = append(calls, ids)
+		if len(calls) == 1 {
+			return []int{1, 3}, nil
+		}
+		return nil, nil
+	}, "test")
+
+	if err != nil {
+		t.Errorf("sendWithRetry() = %v want nil", err)
+	}
+	if want := [][]int{{0, 1, 2, 3}, {1, 3}}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("sendWithRetry() calls = %v want %v", calls, want)
+	}
+}
+
+func TestFailedEntries(t *testing.T) {
+	testCases := []struct {
+		failures []batchEntryFailure
+		failed   []int
+		isError  bool
+	}{
+		{failures: nil, failed: nil},
+		{failures: []batchEntryFailure{{Id: "3", Code: "InternalError"}, {Id: "7", Code: "InternalError"}}, failed: []int{3, 7}},
+		{failures: []batchEntryFailure{{Id: "3", Code: "InternalError"}, {Id: "7", Code: "InvalidMessageContents", SenderFault: true}}, isError: true},
+		{failures: []batchEntryFailure{{Id: "x"}}, isError: true},
+	}
+
+	for idx, tc := range testCases {
+		failed, err := failedEntries(tc.failures)
+		if (err != nil) != tc.isError {
+			t.Errorf("test case %d: failedEntries() error = %v want error %v", idx, err, tc.isError)
+		}
+		if !tc.isError && !reflect.DeepEqual(failed, tc.failed) {
+			t.Errorf("test case %d: failedEntries() = %v want %v", idx, failed, tc.failed)
+		}
+	}
+}
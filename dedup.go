@@ -0,0 +1,224 @@
+package connector
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// DedupStore persists the ids a Deduplicator has seen, so that duplicates are still caught
+// after a restart or when another worker takes over a shard.
+type DedupStore interface {
+	// Contains reports whether id was added within window of now.
+	Contains(id string, window time.Duration) (bool, error)
+	// Add records ids as seen at the given time. Ids older than the window may be expired.
+	Add(ids []string, at time.Time, window time.Duration) error
+}
+
+// DedupBatchStore is a DedupStore that looks up many ids in one call. The Deduplicator uses it
+// to look up a whole page of records read from a shard at once.
+type DedupBatchStore interface {
+	DedupStore
+	// ContainsAll returns the subset of ids added within window of now.
+	ContainsAll(ids []string, window time.Duration) (map[string]bool, error)
+}
+
+// Deduplicator drops records whose id, as extracted by ID, was already delivered within Window,
+// e.g. duplicates created by producer retries, which carry new sequence numbers and so get past
+// the Buffer's sequence number check.
+//
+// Set it as the Pipeline's Dedup. Ids of buffered records are pending until the buffer is
+// emitted and only then committed, so records replayed after a failed emit are not dropped.
+// Committed ids are kept in memory, bounded by Window and MaxEntries, and in Store if set.
+// A Deduplicator may be shared by the pipelines of several shards.
+type Deduplicator struct {
+	// ID returns the id of a record. Records with an empty id are never dropped.
+	ID func(record interface{}) string
+
+	Window     time.Duration
+	MaxEntries int
+
+	// Store optionally persists committed ids. When it cannot be reached, records are kept,
+	// favouring a duplicate over a lost record, and committed ids are only kept in memory.
+	Store DedupStore
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	pending map[string]map[string]bool
+
+	// stored holds the result of the shard's last Prefetch, from id to whether Store has it.
+	stored map[string]map[string]bool
+}
+
+type dedupEntry struct {
+	id   string
+	seen time.Time
+}
+
+// Duplicate reports whether r duplicates a delivered record or one already buffered on the
+// shard. Otherwise r's id becomes pending on the shard.
+func (d *Deduplicator) Duplicate(shardID string, r interface{}) bool {
+	id := d.ID(r)
+	if id == "" {
+		return false
+	}
+
+	d.mu.Lock()
+	d.init()
+	if d.pending[shardID][id] || d.recent(id, time.Now()) {
+		d.mu.Unlock()
+		return true
+	}
+	d.mu.Unlock()
+
+	if d.Store != nil {
+		d.mu.Lock()
+		found, fetched := d.stored[shardID][id]
+		d.mu.Unlock()
+
+		var err error
+		if !fetched {
+			found, err = d.Store.Contains(id, d.Window)
+		}
+		if err != nil {
+			l4g.Warn("dedup store lookup of [%s] failed on shard [%v], keeping the record: %v", id, shardID, err)
+		}
+		if found {
+			d.mu.Lock()
+			d.remember(id, time.Now())
+			d.mu.Unlock()
+			return true
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending[shardID] == nil {
+		d.pending[shardID] = map[string]bool{}
+	}
+	d.pending[shardID][id] = true
+	return false
+}
+
+// Prefetch looks up the ids of records in Store in one call when it is a DedupBatchStore, so
+// that the Duplicate calls for them that follow do not query it one id at a time. The Pipeline
+// calls it for every page of records read from the shard; each call replaces the last.
+func (d *Deduplicator) Prefetch(shardID string, records []interface{}) {
+	bs, ok := d.Store.(DedupBatchStore)
+	if !ok {
+		return
+	}
+
+	d.mu.Lock()
+	d.init()
+	delete(d.stored, shardID)
+	now := time.Now()
+	seen := map[string]bool{}
+	var ids []string
+	for _, r := range records {
+		id := d.ID(r)
+		if id != "" && !seen[id] && !d.pending[shardID][id] && !d.recent(id, now) {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	d.mu.Unlock()
+
+	if len(ids) == 0 {
+		return
+	}
+	found, err := bs.ContainsAll(ids, d.Window)
+	if err != nil {
+		// Duplicate falls back to looking up ids one at a time
+		l4g.Warn("dedup store lookup of [%v] ids failed on shard [%v]: %v", len(ids), shardID, err)
+		return
+	}
+
+	stored := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		stored[id] = found[id]
+	}
+	d.mu.Lock()
+	d.stored[shardID] = stored
+	d.mu.Unlock()
+}
+
+// Release discards the shard's pending ids, which were never delivered, so that the records
+// are kept when they are read again, e.g. after the emit failed or by the next owner of the
+// shard. The Pipeline calls it when it stops processing the shard.
+func (d *Deduplicator) Release(shardID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.init()
+	delete(d.pending, shardID)
+	delete(d.stored, shardID)
+}
+
+// Commit marks the shard's pending ids as delivered. The Pipeline calls it after a successful
+// Emit and before checkpointing. The ids are remembered in memory even when Store cannot be
+// reached; the error is then returned, and the Pipeline logs it and checkpoints regardless.
+func (d *Deduplicator) Commit(shardID string) error {
+	d.mu.Lock()
+	d.init()
+	pending := d.pending[shardID]
+	delete(d.pending, shardID)
+	d.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	for _, id := range ids {
+		d.remember(id, now)
+	}
+	d.mu.Unlock()
+
+	if d.Store != nil {
+		return d.Store.Add(ids, now, d.Window)
+	}
+	return nil
+}
+
+func (d *Deduplicator) init() {
+	if d.lru == nil {
+		d.lru = list.New()
+		d.entries = map[string]*list.Element{}
+		d.pending = map[string]map[string]bool{}
+		d.stored = map[string]map[string]bool{}
+	}
+}
+
+// recent reports whether id was committed within the window, expiring old entries.
+func (d *Deduplicator) recent(id string, now time.Time) bool {
+	for e := d.lru.Back(); e != nil && now.Sub(e.Value.(*dedupEntry).seen) > d.Window; e = d.lru.Back() {
+		d.lru.Remove(e)
+		delete(d.entries, e.Value.(*dedupEntry).id)
+	}
+	_, ok := d.entries[id]
+	return ok
+}
+
+// remember adds id to the front of the in-memory LRU, evicting the oldest beyond MaxEntries.
+func (d *Deduplicator) remember(id string, now time.Time) {
+	d.init()
+	if e, ok := d.entries[id]; ok {
+		e.Value.(*dedupEntry).seen = now
+		d.lru.MoveToFront(e)
+		return
+	}
+	d.entries[id] = d.lru.PushFront(&dedupEntry{id: id, seen: now})
+	for d.MaxEntries > 0 && d.lru.Len() > d.MaxEntries {
+		e := d.lru.Back()
+		d.lru.Remove(e)
+		delete(d.entries, e.Value.(*dedupEntry).id)
+	}
+}
@@ -0,0 +1,243 @@
+package connector
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MysqlDedupStore is a DedupStore keeping ids in a MySQL table.
+type MysqlDedupStore struct {
+	TableName string
+	Db        *sql.DB
+}
+
+// EnsureSchema creates the dedup table if it does not exist.
+func (s *MysqlDedupStore) EnsureSchema() error {
+	_, err := s.Db.Exec("CREATE TABLE IF NOT EXISTS " + parseMysqlTableName(s.TableName).quoted() + " (" +
+		"dedup_id VARCHAR(255) NOT NULL, " +
+		"seen_at BIGINT NOT NULL, " +
+		"PRIMARY KEY (dedup_id), " +
+		"KEY idx_seen_at (seen_at)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	return err
+}
+
+// Contains reports whether id was added within window.
+func (s *MysqlDedupStore) Contains(id string, window time.Duration) (bool, error) {
+	var n int
+	err := s.Db.QueryRow("SELECT COUNT(*) FROM "+parseMysqlTableName(s.TableName).quoted()+" WHERE dedup_id = ? AND seen_at >= ?", id, time.Now().Add(-window).UnixNano()).Scan(&n)
+	return n > 0, err
+}
+
+// ContainsAll returns the ids added within window, looked up with a single query.
+func (s *MysqlDedupStore) ContainsAll(ids []string, window time.Duration) (map[string]bool, error) {
+	marks := make([]string, len(ids))
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, time.Now().Add(-window).UnixNano())
+	for i, id := range ids {
+		marks[i] = "?"
+		args = append(args, id)
+	}
+	rows, err := s.Db.Query("SELECT dedup_id FROM "+parseMysqlTableName(s.TableName).quoted()+" WHERE seen_at >= ? AND dedup_id IN ("+strings.Join(marks, ", ")+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		found[id] = true
+	}
+	return found, rows.Err()
+}
+
+// Add records ids as seen and deletes ids that fell out of the window.
+func (s *MysqlDedupStore) Add(ids []string, at time.Time, window time.Duration) error {
+	table := parseMysqlTableName(s.TableName).quoted()
+
+	marks := make([]string, len(ids))
+	args := make([]interface{}, 0, 2*len(ids))
+	for i, id := range ids {
+		marks[i] = "(?, ?)"
+		args = append(args, id, at.UnixNano())
+	}
+	_, err := s.Db.Exec("INSERT INTO "+table+" (dedup_id, seen_at) VALUES "+strings.Join(marks, ", ")+" ON DUPLICATE KEY UPDATE seen_at = VALUES(seen_at)", args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Db.Exec("DELETE FROM "+table+" WHERE seen_at < ?", at.Add(-window).UnixNano())
+	return err
+}
+
+// RedisDedupStore is a DedupStore keeping each id as a Redis key that expires with the window.
+type RedisDedupStore struct {
+	// Addr is the host:port of the Redis server.
+	Addr     string
+	Password string
+
+	// KeyPrefix is prepended to ids to form keys, e.g. "dedup:myapp:".
+	KeyPrefix string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Contains reports whether the id's key exists. Keys expire with the window they were added with.
+func (s *RedisDedupStore) Contains(id string, window time.Duration) (bool, error) {
+	replies, err := s.do([][]string{{"EXISTS", s.KeyPrefix + id}})
+	if err != nil {
+		return false, err
+	}
+	return replies[0] == "1", nil
+}
+
+// ContainsAll checks the keys of ids in one round trip.
+func (s *RedisDedupStore) ContainsAll(ids []string, window time.Duration) (map[string]bool, error) {
+	cmds := make([][]string, len(ids))
+	for i, id := range ids {
+		cmds[i] = []string{"EXISTS", s.KeyPrefix + id}
+	}
+	replies, err := s.do(cmds)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for i, id := range ids {
+		if replies[i] == "1" {
+			found[id] = true
+		}
+	}
+	return found, nil
+}
+
+// Add sets a key per id, expiring after window, in one round trip.
+func (s *RedisDedupStore) Add(ids []string, at time.Time, window time.Duration) error {
+	ms := strconv.FormatInt(int64(window/time.Millisecond), 10)
+	cmds := make([][]string, len(ids))
+	for i, id := range ids {
+		cmds[i] = []string{"SET", s.KeyPrefix + id, strconv.FormatInt(at.Unix(), 10), "PX", ms}
+	}
+	_, err := s.do(cmds)
+	return err
+}
+
+// do pipelines cmds over the connection, dialing it if needed, and returns the replies as
+// strings. The connection is dropped after any error, to be dialed again on the next call.
+func (s *RedisDedupStore) do(cmds [][]string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return nil, err
+		}
+	}
+
+	replies, err := s.roundTrip(cmds)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return replies, err
+}
+
+func (s *RedisDedupStore) dial() error {
+	conn, err := net.DialTimeout("tcp", s.Addr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+
+	if s.Password != "" {
+		if _, err = s.roundTrip([][]string{{"AUTH", s.Password}}); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RedisDedupStore) roundTrip(cmds [][]string) ([]string, error) {
+	s.conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	w := bufio.NewWriter(s.conn)
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]string, len(cmds))
+	var firstErr error
+	for i := range cmds {
+		reply, err := readRedisReply(s.reader)
+		if err != nil {
+			if _, ok := err.(redisError); !ok {
+				return nil, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// redisError is an error reply from Redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// readRedisReply reads a simple string, error, integer or bulk string reply.
+func readRedisReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n < 0 {
+			return "", nil
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+	return "", fmt.Errorf("redis: unsupported reply %q", line)
+}
@@ -0,0 +1,180 @@
+package connector
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redisStandIn serves EXISTS, SET and AUTH from a map, ignoring expiry.
+type redisStandIn struct {
+	mu       sync.Mutex
+	keys     map[string]string
+	password string
+	commands []string
+}
+
+func (s *redisStandIn) serve(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() returned %s", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func (s *redisStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			r.ReadString('\n')
+			arg, _ := r.ReadString('\n')
+			args[i] = strings.TrimRight(arg, "\r\n")
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		switch args[0] {
+		case "AUTH":
+			if args[1] == s.password {
+				fmt.Fprint(conn, "+OK\r\n")
+			} else {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+			}
+		case "SET":
+			s.keys[args[1]] = args[2]
+			fmt.Fprint(conn, "+OK\r\n")
+		case "EXISTS":
+			if _, ok := s.keys[args[1]]; ok {
+				fmt.Fprint(conn, ":1\r\n")
+			} else {
+				fmt.Fprint(conn, ":0\r\n")
+			}
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		s.mu.Unlock()
+	}
+}
+
+func Test_RedisDedupStore(t *testing.T) {
+	srv := &redisStandIn{keys: map[string]string{}, password: "secret"}
+	s := &RedisDedupStore{Addr: srv.serve(t), Password: "secret", KeyPrefix: "dedup:"}
+
+	if err := s.Add([]string{"a", "b"}, time.Unix(1500000000, 0), time.Minute); err != nil {
+		t.Fatalf("Add() returned %s", err)
+	}
+
+	cases := []struct {
+		id   string
+		want bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"c", false},
+	}
+	for _, c := range cases {
+		got, err := s.Contains(c.id, time.Minute)
+		if err != nil {
+			t.Fatalf("Contains(%v) returned %s", c.id, err)
+		}
+		if got != c.want {
+			t.Errorf("Contains(%v) = %v want %v", c.id, got, c.want)
+		}
+	}
+
+	found, err := s.ContainsAll([]string{"a", "c", "b"}, time.Minute)
+	if err != nil {
+		t.Fatalf("ContainsAll() returned %s", err)
+	}
+	if want := map[string]bool{"a": true, "b": true}; !reflect.DeepEqual(found, want) {
+		t.Errorf("ContainsAll() = %v want %v", found, want)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if got, want := srv.commands[0], "AUTH secret"; got != want {
+		t.Errorf("first command = %v want %v", got, want)
+	}
+	if got, want := srv.commands[1], "SET dedup:a 1500000000 PX 60000"; got != want {
+		t.Errorf("SET command = %v want %v", got, want)
+	}
+}
+
+func Test_RedisDedupStoreAuthError(t *testing.T) {
+	srv := &redisStandIn{keys: map[string]string{}, password: "secret"}
+	s := &RedisDedupStore{Addr: srv.serve(t), Password: "wrong"}
+
+	if _, err := s.Contains("a", time.Minute); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Contains() with a wrong password returned %v", err)
+	}
+}
+
+func Test_MysqlDedupStore(t *testing.T) {
+	rc, _ := sql.Open("mysql", os.Getenv("CHECKPOINT_MYSQL_DSN"))
+
+	s := &MysqlDedupStore{TableName: "KinesisConnector.TestDedup", Db: rc}
+	if err := s.EnsureSchema(); err != nil {
+		t.Fatalf("EnsureSchema() returned %s", err)
+	}
+	rc.Exec("DELETE FROM KinesisConnector.TestDedup")
+
+	if err := s.Add([]string{"old"}, time.Now().Add(-2*time.Hour), time.Hour); err != nil {
+		t.Fatalf("Add() returned %s", err)
+	}
+	if err := s.Add([]string{"a", "b"}, time.Now(), time.Hour); err != nil {
+		t.Fatalf("Add() returned %s", err)
+	}
+
+	cases := []struct {
+		id   string
+		want bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"old", false},
+		{"c", false},
+	}
+	for _, c := range cases {
+		got, err := s.Contains(c.id, time.Hour)
+		if err != nil {
+			t.Fatalf("Contains(%v) returned %s", c.id, err)
+		}
+		if got != c.want {
+			t.Errorf("Contains(%v) = %v want %v", c.id, got, c.want)
+		}
+	}
+
+	found, err := s.ContainsAll([]string{"a", "old", "c", "b"}, time.Hour)
+	if err != nil {
+		t.Fatalf("ContainsAll() returned %s", err)
+	}
+	if want := map[string]bool{"a": true, "b": true}; !reflect.DeepEqual(found, want) {
+		t.Errorf("ContainsAll() = %v want %v", found, want)
+	}
+
+	rc.Exec("DROP TABLE KinesisConnector.TestDedup")
+}
@@ -0,0 +1,264 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ezoic/go-kinesis"
+)
+
+type fakeDedupStore struct {
+	ids      map[string]bool
+	err      error
+	lookups  int
+	batches  [][]string
+	batchErr error
+}
+
+func (s *fakeDedupStore) Contains(id string, window time.Duration) (bool, error) {
+	s.lookups++
+	return s.ids[id], s.err
+}
+
+// fakeDedupBatchStore is a fakeDedupStore that also looks ids up in batches.
+type fakeDedupBatchStore struct {
+	*fakeDedupStore
+}
+
+func (s fakeDedupBatchStore) ContainsAll(ids []string, window time.Duration) (map[string]bool, error) {
+	s.batches = append(s.batches, ids)
+	found := map[string]bool{}
+	for _, id := range ids {
+		if s.ids[id] {
+			found[id] = true
+		}
+	}
+	return found, s.batchErr
+}
+
+func (s *fakeDedupStore) Add(ids []string, at time.Time, window time.Duration) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, id := range ids {
+		s.ids[id] = true
+	}
+	return nil
+}
+
+func stringID(r interface{}) string {
+	return r.(string)
+}
+
+func Test_DeduplicatorPendingAndCommitted(t *testing.T) {
+	d := &Deduplicator{ID: stringID, Window: time.Hour}
+
+	cases := []struct {
+		shard, id string
+		want      bool
+	}{
+		{"shard-1", "a", false},
+		{"shard-1", "a", true},
+		{"shard-1", "b", false},
+		{"shard-2", "a", false},
+		{"shard-1", "", false},
+		{"shard-1", "", false},
+	}
+	for _, c := range cases {
+		if got := d.Duplicate(c.shard, c.id); got != c.want {
+			t.Errorf("Duplicate(%v, %q) = %v want %v", c.shard, c.id, got, c.want)
+		}
+	}
+
+	// pending ids of a shard that failed to emit are dropped on replay, so commit only shard-1
+	if err := d.Commit("shard-1"); err != nil {
+		t.Fatalf("Commit() returned %s", err)
+	}
+	if got := d.Duplicate("shard-3", "b"); got != true {
+		t.Errorf("Duplicate() of a committed id = %v want %v", got, true)
+	}
+	if got := d.Duplicate("shard-2", "c"); got != false {
+		t.Errorf("Duplicate() of a new id = %v want %v", got, false)
+	}
+}
+
+func Test_DeduplicatorWindow(t *testing.T) {
+	d := &Deduplicator{ID: stringID, Window: 50 * time.Millisecond}
+
+	d.Duplicate("shard", "a")
+	d.Commit("shard")
+	if got := d.Duplicate("shard", "a"); got != true {
+		t.Errorf("Duplicate() within the window = %v want %v", got, true)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got := d.Duplicate("shard", "a"); got != false {
+		t.Errorf("Duplicate() after the window = %v want %v", got, false)
+	}
+}
+
+func Test_DeduplicatorMaxEntries(t *testing.T) {
+	d := &Deduplicator{ID: stringID, Window: time.Hour, MaxEntries: 2}
+
+	for _, id := range []string{"a", "b", "c"} {
+		d.Duplicate("shard", id)
+		d.Commit("shard")
+	}
+	if got := d.lru.Len(); got != 2 {
+		t.Errorf("entries = %v want %v", got, 2)
+	}
+	if got := d.Duplicate("shard", "a"); got != false {
+		t.Errorf("Duplicate() of an evicted id = %v want %v", got, false)
+	}
+	if got := d.Duplicate("shard", "c"); got != true {
+		t.Errorf("Duplicate() of a kept id = %v want %v", got, true)
+	}
+}
+
+func Test_DeduplicatorStore(t *testing.T) {
+	store := &fakeDedupStore{ids: map[string]bool{"seen": true}}
+	d := &Deduplicator{ID: stringID, Window: time.Hour, Store: store}
+
+	if got := d.Duplicate("shard", "seen"); got != true {
+		t.Errorf("Duplicate() of an id in the store = %v want %v", got, true)
+	}
+	d.Duplicate("shard", "new")
+	if err := d.Commit("shard"); err != nil {
+		t.Fatalf("Commit() returned %s", err)
+	}
+	if !store.ids["new"] {
+		t.Errorf("Commit() did not add the id to the store")
+	}
+
+	store.err = errors.New("unreachable")
+	if got := d.Duplicate("shard", "other"); got != false {
+		t.Errorf("Duplicate() with a failing store = %v want %v", got, false)
+	}
+	if err := d.Commit("shard"); err == nil {
+		t.Errorf("Commit() with a failing store returned no error")
+	}
+	if got := d.Duplicate("shard", "other"); got != true {
+		t.Errorf("Duplicate() after a Commit() with a failing store = %v want %v", got, true)
+	}
+}
+
+func Test_DeduplicatorPrefetch(t *testing.T) {
+	store := &fakeDedupStore{ids: map[string]bool{"seen": true}}
+	d := &Deduplicator{ID: stringID, Window: time.Hour, Store: fakeDedupBatchStore{store}}
+
+	d.Duplicate("shard", "pending")
+	store.lookups = 0
+	d.Prefetch("shard", []interface{}{"seen", "new", "new", "pending", ""})
+	if want := [][]string{{"seen", "new"}}; !reflect.DeepEqual(store.batches, want) {
+		t.Errorf("ContainsAll() calls = %v want %v", store.batches, want)
+	}
+
+	cases := []struct {
+		id   string
+		want bool
+	}{
+		{"seen", true},
+		{"new", false},
+		{"pending", true},
+	}
+	for _, c := range cases {
+		if got := d.Duplicate("shard", c.id); got != c.want {
+			t.Errorf("Duplicate(%q) = %v want %v", c.id, got, c.want)
+		}
+	}
+	if store.lookups != 0 {
+		t.Errorf("Contains() called %d times after Prefetch() want 0", store.lookups)
+	}
+
+	store.batchErr = errors.New("unreachable")
+	d.Prefetch("shard", []interface{}{"other"})
+	if d.Duplicate("shard", "other") || store.lookups != 1 {
+		t.Errorf("Duplicate() after a failed Prefetch() made %d lookups want 1", store.lookups)
+	}
+}
+
+// failingEmitter fails its first Emit and keeps the records of the others.
+type failingEmitter struct {
+	calls   int
+	records []interface{}
+}
+
+func (e *failingEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	e.calls++
+	if e.calls == 1 {
+		return errors.New("emit failed")
+	}
+	e.records = append(e.records, b.Records()...)
+	return nil
+}
+
+func Test_DeduplicatorReleasedAfterFailedEmit(t *testing.T) {
+	var batch []kinesis.GetRecordsRecords
+	for i := 1; i <= 3; i++ {
+		batch = append(batch, kinesis.GetRecordsRecords{Data: []byte(fmt.Sprint("r", i)), SequenceNumber: fmt.Sprint(i)})
+	}
+	reader := &fakeShardReader{batches: [][]kinesis.GetRecordsRecords{batch}}
+	c := &memoryCheckpoint{shardID: "shard"}
+	emitter := &failingEmitter{}
+	dedup := &Deduplicator{ID: stringID, Window: time.Hour}
+
+	run := func() (panicked bool) {
+		defer func() {
+			panicked = recover() != nil
+		}()
+		p := Pipeline{
+			Buffer:      &RecordBuffer{NumRecordsToBuffer: 3},
+			Checkpoint:  c,
+			Dedup:       dedup,
+			Emitter:     emitter,
+			Filter:      &AllPassFilter{},
+			StreamName:  "stream",
+			Transformer: StringToStringTransformer{},
+		}
+		p.processShard(reader, "shard")
+		return false
+	}
+
+	if !run() {
+		t.Fatalf("processShard() with a failing emitter did not panic")
+	}
+
+	// restart the shard, which reads the same records again
+	reader.calls = 0
+	if run() {
+		t.Fatalf("processShard() after the restart panicked")
+	}
+	if want := []interface{}{"r1", "r2", "r3"}; !reflect.DeepEqual(emitter.records, want) {
+		t.Errorf("emitted records after the restart = %v want %v", emitter.records, want)
+	}
+}
+
+func Test_DeduplicatorCheckpointsWhenStoreFails(t *testing.T) {
+	reader := &fakeShardReader{batches: [][]kinesis.GetRecordsRecords{
+		{{Data: []byte("r1"), SequenceNumber: "1"}, {Data: []byte("r2"), SequenceNumber: "2"}},
+	}}
+	c := &memoryCheckpoint{shardID: "shard"}
+	emitter := &shardEmitter{records: map[string][]interface{}{}}
+	store := &fakeDedupStore{ids: map[string]bool{}, err: errors.New("unreachable")}
+
+	p := Pipeline{
+		Buffer:      &RecordBuffer{NumRecordsToBuffer: 2},
+		Checkpoint:  c,
+		Dedup:       &Deduplicator{ID: stringID, Window: time.Hour, Store: store},
+		Emitter:     emitter,
+		Filter:      &AllPassFilter{},
+		StreamName:  "stream",
+		Transformer: StringToStringTransformer{},
+	}
+	p.processShard(reader, "shard")
+
+	if c.sequenceNumber != "2" || !c.closed {
+		t.Errorf("checkpoint = %v, closed %v want 2, closed", c.sequenceNumber, c.closed)
+	}
+	if want := []interface{}{"r1", "r2"}; !reflect.DeepEqual(emitter.records["shard"], want) {
+		t.Errorf("emitted records = %v want %v", emitter.records["shard"], want)
+	}
+}
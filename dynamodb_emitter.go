@@ -0,0 +1,362 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdRoll/goamz/aws"
+	l4g "github.com/ezoic/log4go"
+)
+
+// BatchWriteItem limits: items per call, bytes per call and bytes per item.
+const (
+	maxDynamoDBBatchCount = 25
+	maxDynamoDBBatchSize  = 16 * 1024 * 1024
+	maxDynamoDBItemSize   = 400 * 1024
+)
+
+// dynamoDBSequenceWidth is the width sequence numbers are zero padded to, so that DynamoDB's
+// string comparison orders them numerically. Kinesis sequence numbers have at most 128 digits.
+const dynamoDBSequenceWidth = 128
+
+// DynamoDBEmitter is an implementation of Emitter that writes each buffered record as an item
+// of a DynamoDB table. Items are written with BatchWriteItem in groups of 25, retrying the
+// UnprocessedItems of each response with the aws backoff.
+//
+// Records are mapped to items with Item or, when it is nil, from the fields of a struct record:
+// the dynamodb tag names the attribute, "-" skips the field and omitempty skips zero values.
+//
+//	type Event struct {
+//		ID   string `dynamodb:"id"`
+//		Body string `dynamodb:"body,omitempty"`
+//	}
+type DynamoDBEmitter struct {
+	TableName string
+	Region    string
+
+	// Endpoint overrides the DynamoDB endpoint for the region, e.g. to use DynamoDB Local.
+	Endpoint string
+
+	// Auth signs requests. When nil, credentials are read from the environment on every Emit.
+	Auth *aws.Auth
+
+	// KeyAttributes names the table's hash key and, if it has one, its range key. Records with
+	// the same key in one buffer are written once, with the last record.
+	KeyAttributes []string
+
+	// Item maps a record to the item's attributes.
+	Item func(record interface{}) (map[string]interface{}, error)
+
+	// SequenceAttribute makes writes idempotent when set. Each item is stored with the buffer's
+	// last sequence number in this attribute and written with a conditional PutItem, which
+	// leaves items written from the same or a later buffer untouched. Replaying a buffer after a
+	// failed checkpoint then cannot overwrite newer data.
+	SequenceAttribute string
+}
+
+// Emit is invoked when the buffer is full. It writes every buffered record to TableName.
+func (e DynamoDBEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	client, err := newAwsClient("dynamodb", e.Region, e.Endpoint, e.Auth)
+	if err != nil {
+		return err
+	}
+	client.JSONVersion = "1.0"
+
+	items, keys, err := e.items(b.Records(), b.LastSequenceNumber())
+	if err != nil {
+		return err
+	}
+
+	infoString := "dynamodb emitter on shard " + shardID
+	if e.SequenceAttribute != "" {
+		err = sendWithRetry(indexes(0, len(items)), func(ids []int) ([]int, error) {
+			return e.putItems(client, items, ids)
+		}, infoString)
+		if err != nil {
+			l4g.Error("PutItem ERROR: %v", err)
+			return err
+		}
+	} else {
+		sizes := make([]int, len(items))
+		for i, item := range items {
+			data, _ := json.Marshal(item)
+			sizes[i] = len(data)
+		}
+		for _, r := range batchRanges(sizes, maxDynamoDBBatchCount, maxDynamoDBBatchSize) {
+			err = sendWithRetry(indexes(r[0], r[1]), func(ids []int) ([]int, error) {
+				return e.batchWriteItem(client, items, keys, ids)
+			}, infoString)
+			if err != nil {
+				l4g.Error("BatchWriteItem ERROR: %v", err)
+				return err
+			}
+		}
+	}
+
+	l4g.Info("[%v] records written to dynamodb table [%s] as [%v] items on shard [%v]", b.NumRecordsInBuffer(), e.TableName, len(items), shardID)
+	return nil
+}
+
+// dynamoDBItem is an item in the DynamoDB JSON format, attribute names to attribute values.
+type dynamoDBItem map[string]interface{}
+
+// items maps the records to items, keeping the last record for each key, and returns them in
+// order with their keys.
+func (e DynamoDBEmitter) items(records []interface{}, sequenceNumber string) ([]dynamoDBItem, []string, error) {
+	if len(e.KeyAttributes) == 0 {
+		return nil, nil, fmt.Errorf("dynamodb emitter for [%s] has no KeyAttributes", e.TableName)
+	}
+
+	var items []dynamoDBItem
+	var keys []string
+	index := map[string]int{}
+	for _, r := range records {
+		item, err := e.item(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if e.SequenceAttribute != "" {
+			item[e.SequenceAttribute] = map[string]interface{}{"S": paddedSequenceNumber(sequenceNumber)}
+		}
+
+		key, err := dynamoDBKey(item, e.KeyAttributes)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, _ := json.Marshal(item)
+		if len(data) > maxDynamoDBItemSize {
+			return nil, nil, fmt.Errorf("dynamodb item %s of about %d bytes exceeds the %d byte limit", key, len(data), maxDynamoDBItemSize)
+		}
+
+		if idx, ok := index[key]; ok {
+			items[idx] = item
+			continue
+		}
+		index[key] = len(items)
+		items = append(items, item)
+		keys = append(keys, key)
+	}
+	return items, keys, nil
+}
+
+func (e DynamoDBEmitter) item(record interface{}) (dynamoDBItem, error) {
+	var attrs map[string]interface{}
+	var err error
+	if e.Item != nil {
+		attrs, err = e.Item(record)
+	} else {
+		attrs, err = dynamoDBStructAttributes(record)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	item := dynamoDBItem{}
+	for name, v := range attrs {
+		if item[name], err = dynamoDBAttributeValue(v); err != nil {
+			return nil, fmt.Errorf("dynamodb attribute %s: %v", name, err)
+		}
+	}
+	return item, nil
+}
+
+type dynamoDBWriteRequest struct {
+	PutRequest struct {
+		Item dynamoDBItem
+	}
+}
+
+func (e DynamoDBEmitter) batchWriteItem(client *awsClient, items []dynamoDBItem, keys []string, ids []int) ([]int, error) {
+	requests := make([]dynamoDBWriteRequest, len(ids))
+	idByKey := map[string]int{}
+	for n, id := range ids {
+		requests[n].PutRequest.Item = items[id]
+		idByKey[keys[id]] = id
+	}
+	req := map[string]interface{}{
+		"RequestItems": map[string]interface{}{e.TableName: requests},
+	}
+
+	var resp struct {
+		UnprocessedItems map[string][]dynamoDBWriteRequest
+	}
+	if err := client.callJSON("DynamoDB_20120810.BatchWriteItem", req, &resp); err != nil {
+		return nil, err
+	}
+
+	var failed []int
+	for _, r := range resp.UnprocessedItems[e.TableName] {
+		key, err := dynamoDBKey(r.PutRequest.Item, e.KeyAttributes)
+		if err != nil {
+			return nil, err
+		}
+		id, ok := idByKey[key]
+		if !ok {
+			return nil, fmt.Errorf("BatchWriteItem to [%s] returned unprocessed item %s that was not sent", e.TableName, key)
+		}
+		failed = append(failed, id)
+	}
+	return failed, nil
+}
+
+// putItems writes the items at ids one at a time, only if the stored item has an older sequence
+// number or none. It returns the ids that failed with a recoverable error.
+func (e DynamoDBEmitter) putItems(client *awsClient, items []dynamoDBItem, ids []int) ([]int, error) {
+	var failed []int
+	for _, id := range ids {
+		req := map[string]interface{}{
+			"TableName":                 e.TableName,
+			"Item":                      items[id],
+			"ConditionExpression":       "attribute_not_exists(#seq) OR #seq < :seq",
+			"ExpressionAttributeNames":  map[string]string{"#seq": e.SequenceAttribute},
+			"ExpressionAttributeValues": map[string]interface{}{":seq": items[id][e.SequenceAttribute]},
+		}
+		err := client.callJSON("DynamoDB_20120810.PutItem", req, &struct{}{})
+		if err == nil {
+			continue
+		}
+		if cErr, ok := err.(*AwsError); ok && cErr.Code == "ConditionalCheckFailedException" {
+			l4g.Debug("skipping dynamodb item already written from a later sequence number in [%s]", e.TableName)
+			continue
+		}
+		if !IsRecoverableError(err) {
+			return nil, err
+		}
+		l4g.Warn("recoverable PutItem error %v for [%s]", err, e.TableName)
+		failed = append(failed, id)
+	}
+	return failed, nil
+}
+
+// dynamoDBKey identifies an item by the values of its key attributes.
+func dynamoDBKey(item dynamoDBItem, keyAttributes []string) (string, error) {
+	values := make([]interface{}, len(keyAttributes))
+	for i, name := range keyAttributes {
+		v, ok := item[name]
+		if !ok {
+			return "", fmt.Errorf("dynamodb item is missing key attribute %s", name)
+		}
+		values[i] = v
+	}
+	key, err := json.Marshal(values)
+	return string(key), err
+}
+
+// paddedSequenceNumber zero pads a sequence number to dynamoDBSequenceWidth digits.
+func paddedSequenceNumber(sequenceNumber string) string {
+	if len(sequenceNumber) >= dynamoDBSequenceWidth {
+		return sequenceNumber
+	}
+	return strings.Repeat("0", dynamoDBSequenceWidth-len(sequenceNumber)) + sequenceNumber
+}
+
+// dynamoDBStructAttributes maps the exported fields of a struct, or a pointer to one, to
+// attributes according to their dynamodb tags.
+func dynamoDBStructAttributes(record interface{}) (map[string]interface{}, error) {
+	v := reflect.ValueOf(record)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dynamodb emitter cannot map a %T record without an Item function", record)
+	}
+
+	attrs := map[string]interface{}{}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, opts := f.Name, ""
+		if tag, ok := f.Tag.Lookup("dynamodb"); ok {
+			if tag == "-" {
+				continue
+			}
+			if idx := strings.Index(tag, ","); idx >= 0 {
+				tag, opts = tag[:idx], tag[idx+1:]
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		if opts == "omitempty" && v.Field(i).IsZero() {
+			continue
+		}
+		attrs[name] = v.Field(i).Interface()
+	}
+	return attrs, nil
+}
+
+// dynamoDBAttributeValue converts a Go value to a DynamoDB attribute value. Times are stored as
+// RFC 3339 strings.
+func dynamoDBAttributeValue(value interface{}) (interface{}, error) {
+	switch x := value.(type) {
+	case nil:
+		return map[string]interface{}{"NULL": true}, nil
+	case []byte:
+		return map[string]interface{}{"B": x}, nil
+	case time.Time:
+		return map[string]interface{}{"S": x.Format(time.RFC3339Nano)}, nil
+	case json.Number:
+		return map[string]interface{}{"N": x.String()}, nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"S": v.String()}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"BOOL": v.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"N": strconv.FormatInt(v.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"N": strconv.FormatUint(v.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"N": strconv.FormatFloat(v.Float(), 'g', -1, 64)}, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return dynamoDBAttributeValue(nil)
+		}
+		return dynamoDBAttributeValue(v.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return dynamoDBAttributeValue(nil)
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			av, err := dynamoDBAttributeValue(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			list[i] = av
+		}
+		return map[string]interface{}{"L": list}, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			return dynamoDBAttributeValue(nil)
+		}
+		m := map[string]interface{}{}
+		for _, k := range v.MapKeys() {
+			av, err := dynamoDBAttributeValue(v.MapIndex(k).Interface())
+			if err != nil {
+				return nil, err
+			}
+			m[k.String()] = av
+		}
+		return map[string]interface{}{"M": m}, nil
+	case reflect.Struct:
+		attrs, err := dynamoDBStructAttributes(value)
+		if err != nil {
+			return nil, err
+		}
+		return dynamoDBAttributeValue(attrs)
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
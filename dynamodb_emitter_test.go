@@ -0,0 +1,230 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type dynamoDBTestEvent struct {
+	ID      string `dynamodb:"id"`
+	Count   int    `dynamodb:"count,omitempty"`
+	Tags    []string
+	Skipped string `dynamodb:"-"`
+	private string
+}
+
+func TestDynamoDBAttributeValue(t *testing.T) {
+	n := 3
+	testCases := []struct {
+		value interface{}
+		json  string
+	}{
+		{value: "a", json: `{"S":"a"}`},
+		{value: 42, json: `{"N":"42"}`},
+		{value: uint8(7), json: `{"N":"7"}`},
+		{value: 1.5, json: `{"N":"1.5"}`},
+		{value: json.Number("12345678901234567890"), json: `{"N":"12345678901234567890"}`},
+		{value: true, json: `{"BOOL":true}`},
+		{value: nil, json: `{"NULL":true}`},
+		{value: []byte("hi"), json: `{"B":"aGk="}`},
+		{value: &n, json: `{"N":"3"}`},
+		{value: time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC), json: `{"S":"2016-01-02T03:04:05Z"}`},
+		{value: []interface{}{"a", 1}, json: `{"L":[{"S":"a"},{"N":"1"}]}`},
+		{value: map[string]int{"a": 1}, json: `{"M":{"a":{"N":"1"}}}`},
+		{value: dynamoDBTestEvent{ID: "x"}, json: `{"M":{"Tags":{"NULL":true},"id":{"S":"x"}}}`},
+	}
+
+	for idx, tc := range testCases {
+		av, err := dynamoDBAttributeValue(tc.value)
+		if err != nil {
+			t.Errorf("test case %d: dynamoDBAttributeValue(%v) returned %v", idx, tc.value, err)
+			continue
+		}
+		if b, _ := json.Marshal(av); string(b) != tc.json {
+			t.Errorf("test case %d: dynamoDBAttributeValue(%v) = %s want %s", idx, tc.value, b, tc.json)
+		}
+	}
+
+	if _, err := dynamoDBAttributeValue(make(chan int)); err == nil {
+		t.Errorf("dynamoDBAttributeValue(chan) = nil error want an error")
+	}
+}
+
+func TestDynamoDBStructAttributes(t *testing.T) {
+	attrs, err := dynamoDBStructAttributes(&dynamoDBTestEvent{ID: "x", Tags: []string{"t"}, Skipped: "s", private: "p"})
+	if err != nil {
+		t.Fatalf("dynamoDBStructAttributes() returned %v", err)
+	}
+	want := map[string]interface{}{"id": "x", "Tags": []string{"t"}}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Errorf("dynamoDBStructAttributes() = %v want %v", attrs, want)
+	}
+
+	if _, err = dynamoDBStructAttributes("not a struct"); err == nil {
+		t.Errorf("dynamoDBStructAttributes(string) = nil error want an error")
+	}
+}
+
+func TestDynamoDBEmitterItems(t *testing.T) {
+	e := DynamoDBEmitter{TableName: "t", KeyAttributes: []string{"id"}, SequenceAttribute: "seq"}
+	records := []interface{}{
+		dynamoDBTestEvent{ID: "a", Count: 1},
+		dynamoDBTestEvent{ID: "b", Count: 1},
+		dynamoDBTestEvent{ID: "a", Count: 2},
+	}
+
+	items, keys, err := e.items(records, "4960")
+	if err != nil {
+		t.Fatalf("items() returned %v", err)
+	}
+	if want := []string{`[{"S":"a"}]`, `[{"S":"b"}]`}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("items() keys = %v want %v", keys, want)
+	}
+	if c := items[0]["count"]; !reflect.DeepEqual(c, map[string]interface{}{"N": "2"}) {
+		t.Errorf("items() count of a = %v want the last record's", c)
+	}
+	seq := items[1]["seq"].(map[string]interface{})["S"].(string)
+	if len(seq) != dynamoDBSequenceWidth || !strings.HasSuffix(seq, "04960") {
+		t.Errorf("items() seq = %v want 4960 padded to %d digits", seq, dynamoDBSequenceWidth)
+	}
+
+	e.KeyAttributes = []string{"id", "missing"}
+	if _, _, err = e.items(records, "1"); err == nil {
+		t.Errorf("items() without a key attribute = nil error want an error")
+	}
+}
+
+func TestPaddedSequenceNumber(t *testing.T) {
+	a, b := paddedSequenceNumber("999"), paddedSequenceNumber("1000")
+	if a >= b {
+		t.Errorf("paddedSequenceNumber(999) = %v not less than paddedSequenceNumber(1000) = %v", a, b)
+	}
+}
+
+func TestDynamoDBEmitterUnprocessedItems(t *testing.T) {
+	var calls []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RequestItems map[string][]dynamoDBWriteRequest
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		requests := req.RequestItems["t"]
+		calls = append(calls, len(requests))
+
+		// the first call leaves its last two items unprocessed
+		unprocessed := []dynamoDBWriteRequest{}
+		if len(calls) == 1 {
+			unprocessed = requests[len(requests)-2:]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"UnprocessedItems": map[string]interface{}{"t": unprocessed},
+		})
+	}))
+	defer server.Close()
+
+	b := &RecordBuffer{NumRecordsToBuffer: 100}
+	for i := 0; i < 30; i++ {
+		b.ProcessRecord(dynamoDBTestEvent{ID: fmt.Sprint(i)}, fmt.Sprint(i+1), 0)
+	}
+
+	e := DynamoDBEmitter{TableName: "t", Endpoint: server.URL, Auth: testAwsAuth, KeyAttributes: []string{"id"}}
+	if err := e.Emit(b, nil, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+	if want := []int{25, 2, 5}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("BatchWriteItem call sizes = %v want %v", calls, want)
+	}
+}
+
+// dynamoDBLocalEndpoint returns the DynamoDB Local endpoint, skipping the test when it is not
+// configured so that it never runs against real AWS.
+func dynamoDBLocalEndpoint(t *testing.T) string {
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_ENDPOINT is not set")
+	}
+	return endpoint
+}
+
+// dynamoDBLocalTable creates a table with a string hash key named id on DynamoDB Local.
+func dynamoDBLocalTable(t *testing.T, endpoint string, table string) *awsClient {
+	client, err := newAwsClient("dynamodb", "", endpoint, testAwsAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.JSONVersion = "1.0"
+
+	client.callJSON("DynamoDB_20120810.DeleteTable", map[string]string{"TableName": table}, &struct{}{})
+	err = client.callJSON("DynamoDB_20120810.CreateTable", map[string]interface{}{
+		"TableName":             table,
+		"AttributeDefinitions":  []map[string]string{{"AttributeName": "id", "AttributeType": "S"}},
+		"KeySchema":             []map[string]string{{"AttributeName": "id", "KeyType": "HASH"}},
+		"ProvisionedThroughput": map[string]int{"ReadCapacityUnits": 5, "WriteCapacityUnits": 5},
+	}, &struct{}{})
+	if err != nil {
+		t.Fatalf("CreateTable returned %v", err)
+	}
+	return client
+}
+
+func dynamoDBLocalCount(t *testing.T, client *awsClient, table string, id string) string {
+	var resp struct {
+		Item map[string]map[string]interface{}
+	}
+	err := client.callJSON("DynamoDB_20120810.GetItem", map[string]interface{}{
+		"TableName": table,
+		"Key":       map[string]interface{}{"id": map[string]string{"S": id}},
+	}, &resp)
+	if err != nil {
+		t.Fatalf("GetItem returned %v", err)
+	}
+	return fmt.Sprint(resp.Item["count"]["N"])
+}
+
+func Test_DynamoDBEmitter(t *testing.T) {
+	endpoint := dynamoDBLocalEndpoint(t)
+	client := dynamoDBLocalTable(t, endpoint, "TestDynamoDBEmitter")
+
+	b := &RecordBuffer{NumRecordsToBuffer: 100}
+	for i := 0; i < 60; i++ {
+		b.ProcessRecord(dynamoDBTestEvent{ID: fmt.Sprint(i), Count: i}, fmt.Sprint(i+1), 0)
+	}
+
+	e := DynamoDBEmitter{TableName: "TestDynamoDBEmitter", Endpoint: endpoint, Auth: testAwsAuth, KeyAttributes: []string{"id"}}
+	if err := e.Emit(b, nil, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+	if c := dynamoDBLocalCount(t, client, "TestDynamoDBEmitter", "59"); c != "59" {
+		t.Errorf("count of item 59 = %v want 59", c)
+	}
+}
+
+func Test_DynamoDBEmitterConditional(t *testing.T) {
+	endpoint := dynamoDBLocalEndpoint(t)
+	client := dynamoDBLocalTable(t, endpoint, "TestDynamoDBEmitterConditional")
+	e := DynamoDBEmitter{TableName: "TestDynamoDBEmitterConditional", Endpoint: endpoint, Auth: testAwsAuth, KeyAttributes: []string{"id"}, SequenceAttribute: "seq"}
+
+	newer := &RecordBuffer{NumRecordsToBuffer: 10}
+	newer.ProcessRecord(dynamoDBTestEvent{ID: "a", Count: 2}, "1000", 0)
+	if err := e.Emit(newer, nil, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+
+	// replaying an older buffer leaves the item alone
+	older := &RecordBuffer{NumRecordsToBuffer: 10}
+	older.ProcessRecord(dynamoDBTestEvent{ID: "a", Count: 1}, "999", 0)
+	if err := e.Emit(older, nil, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+
+	if c := dynamoDBLocalCount(t, client, "TestDynamoDBEmitterConditional", "a"); c != "2" {
+		t.Errorf("count of item a = %v want 2", c)
+	}
+}
@@ -0,0 +1,251 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AdRoll/goamz/aws"
+	l4g "github.com/ezoic/log4go"
+)
+
+// _bulk request limits used when the emitter does not set them: actions and bytes per request.
+const (
+	defaultBulkCount = 1000
+	maxBulkSize      = 10 * 1024 * 1024
+)
+
+// ElasticsearchError is a failed Elasticsearch or OpenSearch request, or a failed item of a
+// _bulk request.
+type ElasticsearchError struct {
+	StatusCode int
+	Type       string
+	Reason     string
+}
+
+func (e *ElasticsearchError) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Type, e.StatusCode, e.Reason)
+}
+
+// ElasticsearchEmitter is an implementation of Emitter that indexes the buffered records into
+// Elasticsearch or OpenSearch through the _bulk API. The Transformer must serialize records to
+// JSON documents. Items rejected with a 429 or 5xx status are retried on their own; any other
+// rejected item fails the Emit.
+//
+// Documents get ids derived from the shard and the record's sequence number, so replaying a
+// buffer after a failed checkpoint overwrites the documents it indexed the first time rather than
+// duplicating them, even when the replayed buffer starts at a different record.
+type ElasticsearchEmitter struct {
+	// URL is the cluster's base URL, e.g. https://search-domain.us-east-1.es.amazonaws.com.
+	URL string
+
+	// Index names the index documents are written to. Time layouts in braces are expanded with
+	// the record's Timestamp, e.g. "clickstream-{2006.01.02}" gives daily indexes.
+	Index string
+
+	// Timestamp returns the time used to expand Index for a record. When nil, the current UTC
+	// time is used.
+	Timestamp func(record interface{}) time.Time
+
+	// DocumentID returns the id of a record's document. When nil, the id is the shard ID and the
+	// record's sequence number, and sub-sequence number for user records of an aggregated
+	// record, taken from the buffer's metadata. Records buffered without
+	// metadata fall back to the buffer's first sequence number and their position in it.
+	DocumentID func(record interface{}, data []byte) string
+
+	// Username and Password are sent with basic authentication when set.
+	Username string
+	Password string
+
+	// AwsRegion signs requests for an Amazon OpenSearch Service domain in the region, with
+	// AwsAuth or, when it is nil, credentials from the environment.
+	AwsRegion string
+	AwsAuth   *aws.Auth
+
+	// BulkSize caps the number of documents per _bulk request, 1000 when zero.
+	BulkSize int
+
+	// HTTP is the client requests are sent with, http.DefaultClient when nil.
+	HTTP *http.Client
+}
+
+type bulkAction struct {
+	Index struct {
+		Index string `json:"_index"`
+		ID    string `json:"_id"`
+	} `json:"index"`
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// Emit is invoked when the buffer is full. It indexes every buffered record.
+func (e ElasticsearchEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	var client *awsClient
+	if e.AwsRegion != "" {
+		var err error
+		if client, err = newAwsClient("es", e.AwsRegion, e.URL, e.AwsAuth); err != nil {
+			return err
+		}
+	}
+
+	metadata := BufferMetadata(b)
+	lines := make([][]byte, 0, b.NumRecordsInBuffer())
+	sizes := make([]int, 0, b.NumRecordsInBuffer())
+	for i, r := range b.Records() {
+		data := t.FromRecord(r)
+
+		var action bulkAction
+		action.Index.Index = e.index(r)
+		if e.DocumentID != nil {
+			action.Index.ID = e.DocumentID(r, data)
+		} else if i < len(metadata) && metadata[i] != nil && metadata[i].SubSequenceNumber > 0 {
+			action.Index.ID = fmt.Sprintf("%s-%s-%d", shardID, metadata[i].SequenceNumber, metadata[i].SubSequenceNumber)
+		} else if i < len(metadata) && metadata[i] != nil {
+			action.Index.ID = fmt.Sprintf("%s-%s", shardID, metadata[i].SequenceNumber)
+		} else {
+			action.Index.ID = fmt.Sprintf("%s-%s-%d", shardID, b.FirstSequenceNumber(), i)
+		}
+		meta, err := json.Marshal(action)
+		if err != nil {
+			return err
+		}
+
+		line := make([]byte, 0, len(meta)+len(data)+2)
+		line = append(line, meta...)
+		line = append(line, '\n')
+		line = append(line, bytes.TrimSpace(data)...)
+		line = append(line, '\n')
+		lines = append(lines, line)
+		sizes = append(sizes, len(line))
+	}
+
+	bulkSize := e.BulkSize
+	if bulkSize == 0 {
+		bulkSize = defaultBulkCount
+	}
+
+	infoString := "elasticsearch emitter on shard " + shardID
+	for _, r := range batchRanges(sizes, bulkSize, maxBulkSize) {
+		err := sendWithRetry(indexes(r[0], r[1]), func(ids []int) ([]int, error) {
+			return e.bulk(client, lines, ids)
+		}, infoString)
+		if err != nil {
+			l4g.Error("_bulk ERROR: %v", err)
+			return err
+		}
+	}
+
+	l4g.Info("[%v] records indexed into [%s] on shard [%v]", b.NumRecordsInBuffer(), e.URL, shardID)
+	return nil
+}
+
+// index expands the time layouts in Index for a record.
+func (e ElasticsearchEmitter) index(record interface{}) string {
+	if !strings.Contains(e.Index, "{") {
+		return e.Index
+	}
+	ts := time.Now().UTC()
+	if e.Timestamp != nil {
+		ts = e.Timestamp(record)
+	}
+
+	var index bytes.Buffer
+	rest := e.Index
+	for {
+		start := strings.Index(rest, "{")
+		end := strings.Index(rest, "}")
+		if start < 0 || end < start {
+			index.WriteString(rest)
+			return index.String()
+		}
+		index.WriteString(rest[:start])
+		index.WriteString(ts.Format(rest[start+1 : end]))
+		rest = rest[end+1:]
+	}
+}
+
+// bulk sends the documents at ids in one _bulk request and returns the ids of the items that
+// failed with a retryable status. The response lists items in request order. Requests are
+// signed with client when it is not nil.
+func (e ElasticsearchEmitter) bulk(client *awsClient, lines [][]byte, ids []int) ([]int, error) {
+	var body bytes.Buffer
+	for _, id := range ids {
+		body.Write(lines[id])
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(e.URL, "/")+"/_bulk", bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.Username != "" {
+		req.SetBasicAuth(e.Username, e.Password)
+	}
+	if client != nil {
+		client.sign(req, body.Bytes(), time.Now())
+	}
+
+	httpClient := e.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		var r struct {
+			Error struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &r)
+		return nil, &ElasticsearchError{StatusCode: resp.StatusCode, Type: r.Error.Type, Reason: r.Error.Reason}
+	}
+
+	var r bulkResponse
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if !r.Errors {
+		return nil, nil
+	}
+
+	var failed []int
+	for idx, item := range r.Items {
+		if idx >= len(ids) {
+			break
+		}
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			itemErr := &ElasticsearchError{StatusCode: result.Status, Type: result.Error.Type, Reason: result.Error.Reason}
+			if !elasticsearchIsRecoverableError(itemErr) {
+				return nil, itemErr
+			}
+			failed = append(failed, ids[idx])
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,113 @@
+package connector
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// bulkStandIn accepts _bulk requests and answers each item with the next status from statuses,
+// recording the ids of every request's documents.
+func bulkStandIn(t *testing.T, statuses []int, calls *[][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			t.Errorf("path = %v want /_bulk", r.URL.Path)
+		}
+
+		var ids []string
+		var items []map[string]interface{}
+		errors := false
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action bulkAction
+			json.Unmarshal(scanner.Bytes(), &action)
+			scanner.Scan()
+			ids = append(ids, action.Index.Index+"/"+action.Index.ID)
+
+			status := 201
+			if len(statuses) > 0 {
+				status, statuses = statuses[0], statuses[1:]
+			}
+			result := map[string]interface{}{"_id": action.Index.ID, "status": status}
+			if status >= 300 {
+				errors = true
+				result["error"] = map[string]string{"type": "es_rejected_execution_exception", "reason": "queue full"}
+			}
+			items = append(items, map[string]interface{}{"index": result})
+		}
+		*calls = append(*calls, ids)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": errors, "items": items})
+	}))
+}
+
+func TestElasticsearchEmitter(t *testing.T) {
+	var calls [][]string
+	server := bulkStandIn(t, []int{201, 429, 201, 503}, &calls)
+	defer server.Close()
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	for i := 0; i < 4; i++ {
+		b.ProcessRecordWithMetadata(fmt.Sprintf(`{"n":%d}`, i), &Record{SequenceNumber: fmt.Sprint(100 + i)})
+	}
+
+	e := ElasticsearchEmitter{
+		URL:       server.URL,
+		Index:     "clicks-{2006.01.02}",
+		Timestamp: func(r interface{}) time.Time { return time.Date(2016, 3, 4, 0, 0, 0, 0, time.UTC) },
+	}
+	if err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+
+	want := [][]string{
+		{"clicks-2016.03.04/shardId-000000000000-100", "clicks-2016.03.04/shardId-000000000000-101", "clicks-2016.03.04/shardId-000000000000-102", "clicks-2016.03.04/shardId-000000000000-103"},
+		{"clicks-2016.03.04/shardId-000000000000-101", "clicks-2016.03.04/shardId-000000000000-103"},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("_bulk calls = %q want %q", calls, want)
+	}
+}
+
+func TestElasticsearchEmitterRejectedItem(t *testing.T) {
+	var calls [][]string
+	server := bulkStandIn(t, []int{201, 400}, &calls)
+	defer server.Close()
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	b.ProcessRecord(`{"n":1}`, "1", 0)
+	b.ProcessRecord(`{"n":"x"}`, "2", 0)
+
+	e := ElasticsearchEmitter{URL: server.URL, Index: "clicks"}
+	err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000")
+	if cErr, ok := err.(*ElasticsearchError); !ok || cErr.StatusCode != 400 {
+		t.Errorf("Emit() = %v want a 400 ElasticsearchError", err)
+	}
+	if len(calls) != 1 {
+		t.Errorf("_bulk calls = %v want 1", len(calls))
+	}
+}
+
+func TestElasticsearchEmitterIndex(t *testing.T) {
+	ts := time.Date(2016, 3, 4, 5, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		index string
+		want  string
+	}{
+		{index: "clicks", want: "clicks"},
+		{index: "clicks-{2006.01.02}", want: "clicks-2016.03.04"},
+		{index: "{2006}-clicks-{01}", want: "2016-clicks-03"},
+		{index: "clicks-{2006", want: "clicks-{2006"},
+	}
+
+	for idx, tc := range testCases {
+		e := ElasticsearchEmitter{Index: tc.index, Timestamp: func(r interface{}) time.Time { return ts }}
+		if r := e.index(nil); r != tc.want {
+			t.Errorf("test case %d: index(%v) = %v want %v", idx, tc.index, r, tc.want)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package connector
 
+import "time"
+
 // Emitter takes a full buffer and processes the stored records. The Emitter is a member of the
 // Pipeline that "emits" the objects that have been deserialized by the
 // Transformer. The Emit() method is invoked when the buffer is full (possibly to persist the
@@ -9,3 +11,57 @@ package connector
 type Emitter interface {
 	Emit(b Buffer, t Transformer, shardID string) error
 }
+
+// ShardFlusher is an Emitter that holds on to emitted data of a shard, e.g. to load it in
+// batches, and must be told when to deliver it. The Pipeline calls FlushShard with final false
+// every FlushInterval while it reads the shard, and with final true once it stops reading it,
+// because the shard was closed or its lease was lost. MultiEmitter and the typed adapters
+// forward both to the ShardFlushers they wrap; RoutingEmitter refuses routes that are
+// ShardFlushers. A FlushInterval of 0 disables the periodic flushes.
+type ShardFlusher interface {
+	Emitter
+	FlushInterval() time.Duration
+	FlushShard(shardID string, final bool) error
+}
+
+// emitterWrapper is implemented by emitters that forward flushes to the emitters they wrap, and
+// so are ShardFlushers whether or not those are.
+type emitterWrapper interface {
+	wrappedEmitters() []interface{}
+}
+
+// holdsShardData reports whether e, an Emitter or a TypedEmitter, is a ShardFlusher or wraps
+// one.
+func holdsShardData(e interface{}) bool {
+	if w, ok := e.(emitterWrapper); ok {
+		for _, wrapped := range w.wrappedEmitters() {
+			if holdsShardData(wrapped) {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := e.(interface {
+		FlushInterval() time.Duration
+		FlushShard(shardID string, final bool) error
+	})
+	return ok
+}
+
+// flushInterval returns the FlushInterval of e, or 0 if it is not a ShardFlusher.
+func flushInterval(e interface{}) time.Duration {
+	if f, ok := e.(interface{ FlushInterval() time.Duration }); ok {
+		return f.FlushInterval()
+	}
+	return 0
+}
+
+// flushShard flushes e if it is a ShardFlusher.
+func flushShard(e interface{}, shardID string, final bool) error {
+	if f, ok := e.(interface {
+		FlushShard(shardID string, final bool) error
+	}); ok {
+		return f.FlushShard(shardID, final)
+	}
+	return nil
+}
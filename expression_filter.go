@@ -0,0 +1,599 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ExpressionFilter keeps the records an expression, given as a string, is true for, so that
+// which events a connector keeps can be changed in its configuration. For example:
+//
+//	type == "click" && (user.country == "US" || user.country == "CA")
+//	!(path =~ "^/health") && has(session.id) && hash_sample(user.id, 0.1)
+//
+// Paths such as user.country or $.items.0.sku address fields of JSON objects, of maps and of
+// structs (by json tag or field name), and elements of arrays. Records given as JSON text in a
+// string or []byte are decoded first. A missing field is null.
+//
+// Comparisons are ==, !=, <, <=, > and >=, comparing numbers numerically and strings
+// lexically, and =~ matching a string against a regular expression literal. Expressions
+// combine with &&, || and !, and the functions are:
+//
+//	has(path)                true if the field exists
+//	sample(rate)             true for a random fraction rate of the records
+//	hash_sample(path, rate)  true for a fraction rate of the records chosen by the field's hash
+//
+// Operands are paths, double or single quoted strings, numbers, true, false and null.
+//
+// The zero value has no expression and keeps every record.
+type ExpressionFilter struct {
+	expr string
+	root exprNode
+}
+
+// NewExpressionFilter parses expr into a filter.
+func NewExpressionFilter(expr string) (*ExpressionFilter, error) {
+	f := &ExpressionFilter{}
+	if err := f.UnmarshalText([]byte(expr)); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// KeepRecord returns true if the expression is true for r, or if there is no expression.
+func (f *ExpressionFilter) KeepRecord(r interface{}) bool {
+	if f.root == nil {
+		return true
+	}
+	keep, _ := f.root.eval(decodeRecord(r)).(bool)
+	return keep
+}
+
+// String returns the expression.
+func (f *ExpressionFilter) String() string {
+	return f.expr
+}
+
+// UnmarshalText parses an expression, so that filters can be read from JSON or other text
+// based configuration.
+func (f *ExpressionFilter) UnmarshalText(text []byte) error {
+	p := &exprParser{}
+	if err := p.lex(string(text)); err != nil {
+		return err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return fmt.Errorf("filter expression: unexpected %q at offset %d", t.text, t.pos)
+	}
+	f.expr, f.root = string(text), root
+	return nil
+}
+
+// MarshalText returns the expression.
+func (f *ExpressionFilter) MarshalText() ([]byte, error) {
+	return []byte(f.expr), nil
+}
+
+// decodeRecord decodes records holding JSON text, leaving other records as they are.
+func decodeRecord(r interface{}) interface{} {
+	var data []byte
+	switch x := r.(type) {
+	case string:
+		data = []byte(x)
+	case []byte:
+		data = x
+	default:
+		return r
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || (data[0] != '{' && data[0] != '[') {
+		return r
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return r
+	}
+	return v
+}
+
+// splitPath splits a path such as $.items[0].sku into its parts.
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.Replace(strings.Replace(path, "[", ".", -1), "]", "", -1)
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// lookupPath returns the value at path in v and whether it exists.
+func lookupPath(v interface{}, path []string) (interface{}, bool) {
+	for _, part := range path {
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+			if rv.IsNil() {
+				return nil, false
+			}
+			rv = rv.Elem()
+		}
+
+		switch rv.Kind() {
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			e := rv.MapIndex(reflect.ValueOf(part).Convert(rv.Type().Key()))
+			if !e.IsValid() {
+				return nil, false
+			}
+			v = e.Interface()
+		case reflect.Slice, reflect.Array:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= rv.Len() {
+				return nil, false
+			}
+			v = rv.Index(idx).Interface()
+		case reflect.Struct:
+			field, ok := structField(rv, part)
+			if !ok {
+				return nil, false
+			}
+			v = field.Interface()
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// structField finds the exported field named name by its json tag or, failing that, its name.
+func structField(rv reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == name || (tag == "" && f.Name == name) {
+			return rv.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+type exprNode interface {
+	eval(r interface{}) interface{}
+}
+
+type orNode []exprNode
+
+func (n orNode) eval(r interface{}) interface{} {
+	for _, c := range n {
+		if b, _ := c.eval(r).(bool); b {
+			return true
+		}
+	}
+	return false
+}
+
+type andNode []exprNode
+
+func (n andNode) eval(r interface{}) interface{} {
+	for _, c := range n {
+		if b, _ := c.eval(r).(bool); !b {
+			return false
+		}
+	}
+	return true
+}
+
+type notNode struct{ x exprNode }
+
+func (n notNode) eval(r interface{}) interface{} {
+	b, _ := n.x.eval(r).(bool)
+	return !b
+}
+
+type literalNode struct{ v interface{} }
+
+func (n literalNode) eval(r interface{}) interface{} {
+	return n.v
+}
+
+type pathNode []string
+
+func (n pathNode) eval(r interface{}) interface{} {
+	v, _ := lookupPath(r, n)
+	return v
+}
+
+type hasNode []string
+
+func (n hasNode) eval(r interface{}) interface{} {
+	_, ok := lookupPath(r, n)
+	return ok
+}
+
+type sampleNode float64
+
+func (n sampleNode) eval(r interface{}) interface{} {
+	return rand.Float64() < float64(n)
+}
+
+type hashSampleNode struct {
+	path []string
+	rate float64
+}
+
+func (n hashSampleNode) eval(r interface{}) interface{} {
+	v, ok := lookupPath(r, n.path)
+	return ok && hashSample(fmt.Sprint(v), n.rate)
+}
+
+type matchNode struct {
+	x  exprNode
+	re *regexp.Regexp
+}
+
+func (n matchNode) eval(r interface{}) interface{} {
+	s, ok := n.x.eval(r).(string)
+	return ok && n.re.MatchString(s)
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n compareNode) eval(r interface{}) interface{} {
+	l, rv := n.left.eval(r), n.right.eval(r)
+
+	lf, lnum := exprNumber(l)
+	rf, rnum := exprNumber(rv)
+	if lnum && rnum {
+		switch n.op {
+		case "==":
+			return lf == rf
+		case "!=":
+			return lf != rf
+		case "<":
+			return lf < rf
+		case "<=":
+			return lf <= rf
+		case ">":
+			return lf > rf
+		case ">=":
+			return lf >= rf
+		}
+	}
+
+	ls, lstr := l.(string)
+	rs, rstr := rv.(string)
+	if lstr && rstr {
+		switch n.op {
+		case "<":
+			return ls < rs
+		case "<=":
+			return ls <= rs
+		case ">":
+			return ls > rs
+		case ">=":
+			return ls >= rs
+		}
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(l, rv)
+	case "!=":
+		return !reflect.DeepEqual(l, rv)
+	}
+	return false
+}
+
+// exprNumber converts numeric values to float64.
+func exprNumber(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case nil, bool, string:
+		return 0, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPath
+	tokString
+	tokNumber
+	tokOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// exprParser is a recursive descent parser for filter expressions:
+//
+//	or      = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | primary
+//	primary = "(" or ")" | call | operand [ op operand ]
+type exprParser struct {
+	tokens []exprToken
+	next   int
+}
+
+func (p *exprParser) lex(s string) error {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var text bytes.Buffer
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				text.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return fmt.Errorf("filter expression: unterminated string at offset %d", i)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokString, text: text.String(), pos: i})
+			i = j + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || s[j] == 'e' || s[j] == 'E' || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokNumber, text: s[i:j], pos: i})
+			i = j
+		case c == '$' || c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || s[j] == '_' || s[j] == '[' || s[j] == ']' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokPath, text: s[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!", "(", ")", ","} {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("filter expression: unexpected %q at offset %d", c, i)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, exprToken{kind: tokEOF, text: "end of expression", pos: len(s)})
+	return nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.next]
+}
+
+func (p *exprParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return fmt.Errorf("filter expression: expected %q at offset %d, found %q", op, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := orNode{n}
+	for p.accept("||") {
+		if n, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		or = append(or, n)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	n, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	and := andNode{n}
+	for p.accept("&&") {
+		if n, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		and = append(and, n)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") {
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.accept("(") {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	}
+
+	t := p.peek()
+	if t.kind == tokPath && p.tokens[p.next+1].kind == tokOp && p.tokens[p.next+1].text == "(" {
+		p.next += 2
+		return p.parseCall(t)
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	if op.kind != tokOp {
+		return left, nil
+	}
+	switch op.text {
+	case "=~":
+		p.next++
+		pattern := p.peek()
+		if pattern.kind != tokString {
+			return nil, fmt.Errorf("filter expression: =~ needs a string pattern at offset %d", pattern.pos)
+		}
+		p.next++
+		re, err := regexp.Compile(pattern.text)
+		if err != nil {
+			return nil, fmt.Errorf("filter expression: bad pattern at offset %d: %v", pattern.pos, err)
+		}
+		return matchNode{x: left, re: re}, nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return compareNode{op: op.text, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	var n exprNode
+	switch name.text {
+	case "has":
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		n = hasNode(path)
+	case "sample":
+		rate, err := p.parseRate()
+		if err != nil {
+			return nil, err
+		}
+		n = sampleNode(rate)
+	case "hash_sample":
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(","); err != nil {
+			return nil, err
+		}
+		rate, err := p.parseRate()
+		if err != nil {
+			return nil, err
+		}
+		n = hashSampleNode{path: path, rate: rate}
+	default:
+		return nil, fmt.Errorf("filter expression: unknown function %s at offset %d", name.text, name.pos)
+	}
+	return n, p.expect(")")
+}
+
+func (p *exprParser) parsePath() ([]string, error) {
+	t := p.peek()
+	if t.kind != tokPath {
+		return nil, fmt.Errorf("filter expression: expected a path at offset %d, found %q", t.pos, t.text)
+	}
+	p.next++
+	return splitPath(t.text), nil
+}
+
+func (p *exprParser) parseRate() (float64, error) {
+	t := p.peek()
+	rate, err := strconv.ParseFloat(t.text, 64)
+	if t.kind != tokNumber || err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("filter expression: expected a rate between 0 and 1 at offset %d, found %q", t.pos, t.text)
+	}
+	p.next++
+	return rate, nil
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokString:
+		p.next++
+		return literalNode{t.text}, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("filter expression: bad number %q at offset %d", t.text, t.pos)
+		}
+		p.next++
+		return literalNode{f}, nil
+	case tokPath:
+		p.next++
+		switch t.text {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		case "null":
+			return literalNode{nil}, nil
+		}
+		return pathNode(splitPath(t.text)), nil
+	}
+	return nil, fmt.Errorf("filter expression: expected an operand at offset %d, found %q", t.pos, t.text)
+}
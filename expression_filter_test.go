@@ -0,0 +1,121 @@
+package connector
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type expressionTestEvent struct {
+	Type  string `json:"type"`
+	Count int
+	User  *expressionTestUser `json:"user"`
+}
+
+type expressionTestUser struct {
+	ID      string `json:"id"`
+	Country string `json:"country"`
+}
+
+func TestExpressionFilter(t *testing.T) {
+	click := `{"type":"click","count":3,"path":"/checkout","user":{"id":"u1","country":"US"},"items":[{"sku":"a1"}]}`
+	view := []byte(`{"type":"view","count":12,"path":"/health/live","user":{"id":"u2","country":"FR"}}`)
+	event := &expressionTestEvent{Type: "click", Count: 7, User: &expressionTestUser{ID: "u3", Country: "CA"}}
+	records := []interface{}{click, view, event, "not json"}
+
+	testCases := []struct {
+		expr string
+		keep []bool
+	}{
+		{expr: `type == "click"`, keep: []bool{true, false, true, false}},
+		{expr: `type != 'click'`, keep: []bool{false, true, false, true}},
+		{expr: `count > 5`, keep: []bool{false, true, false, false}},
+		{expr: `Count >= 7 || $.count <= 3`, keep: []bool{true, false, true, false}},
+		{expr: `user.country == "US" || user.country == "CA"`, keep: []bool{true, false, true, false}},
+		{expr: `!(path =~ "^/health")`, keep: []bool{true, false, true, true}},
+		{expr: `has(items[0].sku) && $.items.0.sku == "a1"`, keep: []bool{true, false, false, false}},
+		{expr: `has(user) && !has(items)`, keep: []bool{false, true, true, false}},
+		{expr: `missing == null`, keep: []bool{true, true, true, true}},
+		{expr: `type == "click" && (user.id < "u2" || Count == 7)`, keep: []bool{true, false, true, false}},
+		{expr: `sample(1) && !sample(0)`, keep: []bool{true, true, true, true}},
+		{expr: `hash_sample(user.id, 1)`, keep: []bool{true, true, true, false}},
+		{expr: `hash_sample(user.id, 0)`, keep: []bool{false, false, false, false}},
+	}
+
+	for _, tc := range testCases {
+		f, err := NewExpressionFilter(tc.expr)
+		if err != nil {
+			t.Errorf("NewExpressionFilter(%v) returned %v", tc.expr, err)
+			continue
+		}
+		for i, want := range tc.keep {
+			if keep := f.KeepRecord(records[i]); keep != want {
+				t.Errorf("%v: KeepRecord(record %d) = %v want %v", tc.expr, i, keep, want)
+			}
+		}
+	}
+}
+
+func TestExpressionFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`type ==`,
+		`type == "click`,
+		`(type == "click"`,
+		`type == "click")`,
+		`path =~ type`,
+		`path =~ "("`,
+		`unknown(type)`,
+		`sample(2)`,
+		`hash_sample(user.id)`,
+		`type # 1`,
+	} {
+		if _, err := NewExpressionFilter(expr); err == nil {
+			t.Errorf("NewExpressionFilter(%v) = nil error want an error", expr)
+		}
+	}
+}
+
+func TestExpressionFilterUnmarshalJSON(t *testing.T) {
+	var config struct {
+		Filter *ExpressionFilter
+	}
+	if err := json.Unmarshal([]byte(`{"Filter": "type == \"click\""}`), &config); err != nil {
+		t.Fatalf("json.Unmarshal() returned %v", err)
+	}
+	if !config.Filter.KeepRecord(`{"type":"click"}`) || config.Filter.String() != `type == "click"` {
+		t.Errorf("unmarshaled filter %v does not keep clicks", config.Filter)
+	}
+}
+
+func TestExpressionFilterZeroValue(t *testing.T) {
+	var f ExpressionFilter
+	if !f.KeepRecord(`{"type":"click"}`) {
+		t.Errorf("zero ExpressionFilter KeepRecord() = false want true")
+	}
+}
+
+func TestHashSampleFilter(t *testing.T) {
+	f := HashSampleFilter{Rate: 0.5, Field: "user.id"}
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		r := map[string]interface{}{"user": map[string]interface{}{"id": i}}
+		keep := f.KeepRecord(r)
+		if keep != f.KeepRecord(r) {
+			t.Fatalf("KeepRecord() is not deterministic for user %d", i)
+		}
+		if keep {
+			kept++
+		}
+	}
+	if kept < 400 || kept > 600 {
+		t.Errorf("HashSampleFilter{Rate: 0.5} kept %d of 1000 want about 500", kept)
+	}
+
+	byKey := HashSampleFilter{Rate: 0, Key: func(r interface{}) string { return r.(string) }}
+	if byKey.KeepRecord("a") {
+		t.Errorf("HashSampleFilter{Rate: 0} kept a record")
+	}
+	if (SampleFilter{Rate: 0}).KeepRecord("a") || !(SampleFilter{Rate: 1}).KeepRecord("a") {
+		t.Errorf("SampleFilter with a rate of 0 or 1 is not exact")
+	}
+}
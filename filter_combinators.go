@@ -0,0 +1,101 @@
+package connector
+
+// FilterFunc adapts a function to the Filter interface.
+type FilterFunc func(r interface{}) bool
+
+// KeepRecord returns f(r).
+func (f FilterFunc) KeepRecord(r interface{}) bool {
+	return f(r)
+}
+
+// RecordFilterFunc adapts a function to the RecordFilter interface. KeepRecord passes it a
+// nil *Record.
+type RecordFilterFunc func(record interface{}, r *Record) bool
+
+// KeepRecord returns f(record, nil).
+func (f RecordFilterFunc) KeepRecord(record interface{}) bool {
+	return f(record, nil)
+}
+
+// KeepRecordWithMetadata returns f(record, r).
+func (f RecordFilterFunc) KeepRecordWithMetadata(record interface{}, r *Record) bool {
+	return f(record, r)
+}
+
+// AndFilter keeps records every one of its filters keeps. It stops at the first filter that
+// drops the record, and keeps everything when empty.
+type AndFilter []Filter
+
+// KeepRecord returns true if every filter keeps r.
+func (f AndFilter) KeepRecord(r interface{}) bool {
+	for _, filter := range f {
+		if !filter.KeepRecord(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// KeepRecordWithMetadata is KeepRecord, passing r on to filters that are RecordFilters.
+func (f AndFilter) KeepRecordWithMetadata(record interface{}, r *Record) bool {
+	for _, filter := range f {
+		if !keepRecord(filter, record, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// OrFilter keeps records any of its filters keeps. It stops at the first filter that keeps
+// the record, and drops everything when empty.
+type OrFilter []Filter
+
+// KeepRecord returns true if any filter keeps r.
+func (f OrFilter) KeepRecord(r interface{}) bool {
+	for _, filter := range f {
+		if filter.KeepRecord(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeepRecordWithMetadata is KeepRecord, passing r on to filters that are RecordFilters.
+func (f OrFilter) KeepRecordWithMetadata(record interface{}, r *Record) bool {
+	for _, filter := range f {
+		if keepRecord(filter, record, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// NotFilter keeps the records its filter drops.
+type NotFilter struct {
+	Filter Filter
+}
+
+// KeepRecord returns true if the filter drops r.
+func (f NotFilter) KeepRecord(r interface{}) bool {
+	return !f.Filter.KeepRecord(r)
+}
+
+// KeepRecordWithMetadata is KeepRecord, passing r on to the filter if it is a RecordFilter.
+func (f NotFilter) KeepRecordWithMetadata(record interface{}, r *Record) bool {
+	return !keepRecord(f.Filter, record, r)
+}
+
+// And returns a filter keeping records all of filters keep.
+func And(filters ...Filter) Filter {
+	return AndFilter(filters)
+}
+
+// Or returns a filter keeping records any of filters keeps.
+func Or(filters ...Filter) Filter {
+	return OrFilter(filters)
+}
+
+// Not returns a filter keeping the records filter drops.
+func Not(filter Filter) Filter {
+	return NotFilter{Filter: filter}
+}
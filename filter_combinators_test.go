@@ -0,0 +1,31 @@
+package connector
+
+import "testing"
+
+func TestFilterCombinators(t *testing.T) {
+	even := FilterFunc(func(r interface{}) bool { return r.(int)%2 == 0 })
+	small := FilterFunc(func(r interface{}) bool { return r.(int) < 5 })
+
+	records := []int{0, 1, 2, 5, 6, 7}
+	testCases := []struct {
+		name   string
+		filter Filter
+		keep   []bool
+	}{
+		{name: "And", filter: And(even, small), keep: []bool{true, false, true, false, false, false}},
+		{name: "Or", filter: Or(even, small), keep: []bool{true, true, true, false, true, false}},
+		{name: "Not", filter: Not(even), keep: []bool{false, true, false, true, false, true}},
+		{name: "empty And", filter: And(), keep: []bool{true, true, true, true, true, true}},
+		{name: "empty Or", filter: Or(), keep: []bool{false, false, false, false, false, false}},
+		{name: "nested", filter: And(Not(small), Or(even, &AllPassFilter{})), keep: []bool{false, false, false, true, true, true}},
+	}
+
+	for _, tc := range testCases {
+		for i, want := range tc.keep {
+			r := records[i]
+			if keep := tc.filter.KeepRecord(r); keep != want {
+				t.Errorf("%s: KeepRecord(%v) = %v want %v", tc.name, r, keep, want)
+			}
+		}
+	}
+}
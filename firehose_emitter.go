@@ -0,0 +1,113 @@
+package connector
+
+import (
+	"fmt"
+
+	"github.com/AdRoll/goamz/aws"
+	l4g "github.com/ezoic/log4go"
+)
+
+// PutRecordBatch limits: entries per call, bytes per call and bytes per entry.
+const (
+	maxFirehoseBatchCount  = 500
+	maxFirehoseBatchSize   = 4 * 1024 * 1024
+	maxFirehoseRecordSize  = 1000 * 1024
+	firehosePutRecordBatch = "Firehose_20150804.PutRecordBatch"
+)
+
+// FirehoseEmitter is an implementation of Emitter that sends the buffered records to a Kinesis
+// Firehose delivery stream with PutRecordBatch. Entries rejected in a response are retried on
+// their own.
+type FirehoseEmitter struct {
+	DeliveryStreamName string
+	Region             string
+
+	// Endpoint overrides the Firehose endpoint for the region, e.g. to use a local stand-in.
+	Endpoint string
+
+	// Auth signs requests. When nil, credentials are read from the environment on every Emit.
+	Auth *aws.Auth
+
+	// Delimiter is appended to every record, since Firehose concatenates records as is.
+	Delimiter string
+}
+
+type firehoseRecord struct {
+	Data []byte
+}
+
+type firehosePutRecordBatchRequest struct {
+	DeliveryStreamName string
+	Records            []firehoseRecord
+}
+
+type firehosePutRecordBatchResponse struct {
+	FailedPutCount   int
+	RequestResponses []struct {
+		RecordId     string
+		ErrorCode    string
+		ErrorMessage string
+	}
+}
+
+// Emit is invoked when the buffer is full. It puts every buffered record onto the delivery stream.
+func (e FirehoseEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	client, err := newAwsClient("firehose", e.Region, e.Endpoint, e.Auth)
+	if err != nil {
+		return err
+	}
+
+	records := make([][]byte, 0, b.NumRecordsInBuffer())
+	sizes := make([]int, 0, b.NumRecordsInBuffer())
+	for _, r := range b.Records() {
+		data := append(t.FromRecord(r), e.Delimiter...)
+		if len(data) > maxFirehoseRecordSize {
+			return fmt.Errorf("firehose record of %d bytes exceeds the %d byte limit", len(data), maxFirehoseRecordSize)
+		}
+		records = append(records, data)
+		sizes = append(sizes, len(data))
+	}
+
+	infoString := "firehose emitter on shard " + shardID
+	for _, r := range batchRanges(sizes, maxFirehoseBatchCount, maxFirehoseBatchSize) {
+		err = sendWithRetry(indexes(r[0], r[1]), func(ids []int) ([]int, error) {
+			return e.putRecordBatch(client, records, ids)
+		}, infoString)
+		if err != nil {
+			l4g.Error("PutRecordBatch ERROR: %v", err)
+			return err
+		}
+	}
+
+	l4g.Info("[%v] records emitted to firehose [%s] on shard [%v]", b.NumRecordsInBuffer(), e.DeliveryStreamName, shardID)
+	return nil
+}
+
+// putRecordBatch sends the records at ids and returns the ids of the entries that failed. The
+// response lists results in request order.
+func (e FirehoseEmitter) putRecordBatch(client *awsClient, records [][]byte, ids []int) ([]int, error) {
+	req := firehosePutRecordBatchRequest{DeliveryStreamName: e.DeliveryStreamName}
+	for _, id := range ids {
+		req.Records = append(req.Records, firehoseRecord{Data: records[id]})
+	}
+
+	var resp firehosePutRecordBatchResponse
+	if err := client.callJSON(firehosePutRecordBatch, req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.FailedPutCount == 0 {
+		return nil, nil
+	}
+
+	var failed []int
+	for idx, r := range resp.RequestResponses {
+		if r.ErrorCode != "" && idx < len(ids) {
+			l4g.Debug("firehose record failed: %s: %s", r.ErrorCode, r.ErrorMessage)
+			failed = append(failed, ids[idx])
+		}
+	}
+	if len(failed) == 0 {
+		return nil, fmt.Errorf("PutRecordBatch to [%s] reported %d failures without failed entries", e.DeliveryStreamName, resp.FailedPutCount)
+	}
+	return failed, nil
+}
@@ -0,0 +1,58 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// firehoseStandIn accepts PutRecordBatch calls, failing the second record of the first call.
+func firehoseStandIn(t *testing.T, calls *[][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target := r.Header.Get("X-Amz-Target"); target != firehosePutRecordBatch {
+			t.Errorf("X-Amz-Target = %v want %v", target, firehosePutRecordBatch)
+		}
+		var req firehosePutRecordBatchRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var data []string
+		resp := map[string]interface{}{"FailedPutCount": 0}
+		var results []map[string]string
+		for idx, rec := range req.Records {
+			data = append(data, string(rec.Data))
+			if len(*calls) == 0 && idx == 1 {
+				results = append(results, map[string]string{"ErrorCode": "ServiceUnavailableException", "ErrorMessage": "slow down"})
+				resp["FailedPutCount"] = 1
+				continue
+			}
+			results = append(results, map[string]string{"RecordId": fmt.Sprint(idx)})
+		}
+		resp["RequestResponses"] = results
+		*calls = append(*calls, data)
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestFirehoseEmitter(t *testing.T) {
+	var calls [][]string
+	server := firehoseStandIn(t, &calls)
+	defer server.Close()
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	for i, s := range []string{"a", "b", "c"} {
+		b.ProcessRecord(s, fmt.Sprint(i+1), 0)
+	}
+
+	e := FirehoseEmitter{DeliveryStreamName: "stream", Endpoint: server.URL, Auth: testAwsAuth, Delimiter: "\n"}
+	if err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+
+	want := [][]string{{"a\n", "b\n", "c\n"}, {"b\n"}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("PutRecordBatch calls = %q want %q", calls, want)
+	}
+}
@@ -0,0 +1,248 @@
+package connector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// HTTPBodyFormat is how HTTPEmitter joins the buffered records into a request body.
+type HTTPBodyFormat string
+
+// Body formats supported by HTTPEmitter. Both expect the Transformer to produce JSON.
+const (
+	HTTPJSONArray HTTPBodyFormat = ""
+	HTTPNDJSON    HTTPBodyFormat = "ndjson"
+)
+
+// HTTPStatusAction tells HTTPEmitter what to do with a response that is not a 2xx.
+type HTTPStatusAction int
+
+const (
+	// HTTPDefault retries statuses the RecoverableErrorTester registry considers transient,
+	// 429 and 5xx unless other testers are registered, and fails on the others.
+	HTTPDefault HTTPStatusAction = iota
+	// HTTPRetry sends the request again after the backoff or the response's Retry-After.
+	HTTPRetry
+	// HTTPDrop logs the failure and treats the buffer as delivered.
+	HTTPDrop
+	// HTTPFail returns the failure from Emit.
+	HTTPFail
+)
+
+// maxRetryAfter caps how long a Retry-After header can make HTTPEmitter wait.
+const maxRetryAfter = 5 * time.Minute
+
+// HTTPError is a response from an HTTPEmitter endpoint with a status other than 2xx.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// HTTPEmitter is an implementation of Emitter that POSTs each buffer to a webhook as a JSON
+// array or as newline delimited JSON.
+//
+// With a SigningKey, requests carry an X-Signature-Timestamp header with the Unix time and an
+// X-Signature header of "sha256=" and the hex HMAC-SHA256 of the timestamp, a period and the
+// body as sent. Receivers should reject stale timestamps to prevent replays.
+type HTTPEmitter struct {
+	URL     string
+	Format  HTTPBodyFormat
+	Headers map[string]string
+
+	// Gzip compresses request bodies and sets Content-Encoding.
+	Gzip bool
+
+	// SigningKey enables HMAC request signing when set.
+	SigningKey []byte
+
+	// OnStatus decides what to do with a response that is not a 2xx. Returning HTTPDefault, or
+	// leaving OnStatus nil, applies the default classification.
+	OnStatus func(status int, body []byte) HTTPStatusAction
+
+	// MaxAttempts caps the requests made for a buffer, 10 when zero.
+	MaxAttempts int
+
+	// HTTP is the client requests are sent with, http.DefaultClient when nil.
+	HTTP *http.Client
+}
+
+// Emit is invoked when the buffer is full. It sends every buffered record in one request.
+func (e HTTPEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	body, err := e.body(b, t)
+	if err != nil {
+		return err
+	}
+
+	maxAttempts := e.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 10
+	}
+
+	infoString := "http emitter on shard " + shardID
+	var retryAfter time.Duration
+	for i := 0; i < maxAttempts; i++ {
+		if i > 0 && retryAfter > 0 {
+			l4g.Info("waiting %s as asked by [%s] for %s", retryAfter, e.URL, infoString)
+			time.Sleep(retryAfter)
+		} else {
+			HandleAwsWaitTimeExp(i, infoString)
+		}
+
+		err = e.send(body)
+		if err == nil {
+			l4g.Info("[%v] records sent to [%s] on shard [%v]", b.NumRecordsInBuffer(), e.URL, shardID)
+			return nil
+		}
+
+		retryAfter = 0
+		action := HTTPDefault
+		if httpErr, ok := err.(*HTTPError); ok {
+			retryAfter = httpErr.RetryAfter
+			if e.OnStatus != nil {
+				action = e.OnStatus(httpErr.StatusCode, []byte(httpErr.Body))
+			}
+		}
+		if action == HTTPDefault {
+			action = HTTPFail
+			if IsRecoverableError(err) {
+				action = HTTPRetry
+			}
+		}
+
+		switch action {
+		case HTTPDrop:
+			l4g.Warn("dropping [%v] records after %v from [%s] on shard [%v]", b.NumRecordsInBuffer(), err, e.URL, shardID)
+			return nil
+		case HTTPFail:
+			l4g.Error("HTTP emitter ERROR: %v", err)
+			return err
+		}
+		l4g.Warn("recoverable http error %v for %s", err, infoString)
+	}
+
+	l4g.Error("HTTP emitter ERROR: %v", err)
+	return err
+}
+
+// body joins the buffered records in Format.
+func (e HTTPEmitter) body(b Buffer, t Transformer) ([]byte, error) {
+	var body bytes.Buffer
+	switch e.Format {
+	case HTTPJSONArray:
+		body.WriteByte('[')
+		for i, r := range b.Records() {
+			if i > 0 {
+				body.WriteByte(',')
+			}
+			body.Write(bytes.TrimSpace(t.FromRecord(r)))
+		}
+		body.WriteByte(']')
+	case HTTPNDJSON:
+		for _, r := range b.Records() {
+			body.Write(bytes.TrimSpace(t.FromRecord(r)))
+			body.WriteByte('\n')
+		}
+	default:
+		return nil, fmt.Errorf("unknown http emitter body format %q", e.Format)
+	}
+
+	if !e.Gzip {
+		return body.Bytes(), nil
+	}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	if _, err := w.Write(body.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return gz.Bytes(), nil
+}
+
+func (e HTTPEmitter) send(body []byte) error {
+	req, err := http.NewRequest("POST", e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if e.Format == HTTPNDJSON {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if e.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	if e.SigningKey != nil {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Signature-Timestamp", ts)
+		req.Header.Set("X-Signature", "sha256="+hmacSignature(e.SigningKey, ts, body))
+	}
+
+	client := e.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Body:       string(respBody),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// hmacSignature is the hex HMAC-SHA256 of the timestamp, a period and the body.
+func hmacSignature(key []byte, ts string, body []byte) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(ts + "."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date. It returns
+// zero when the header is missing or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		d = t.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
@@ -0,0 +1,133 @@
+package connector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func httpTestBuffer(records ...string) *RecordBuffer {
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	for i, r := range records {
+		b.ProcessRecord(r, string(rune('1'+i)), 0)
+	}
+	return b
+}
+
+func TestHTTPEmitterBody(t *testing.T) {
+	testCases := []struct {
+		format HTTPBodyFormat
+		body   string
+	}{
+		{format: HTTPJSONArray, body: `[{"a":1},{"b":2}]`},
+		{format: HTTPNDJSON, body: "{\"a\":1}\n{\"b\":2}\n"},
+	}
+
+	for idx, tc := range testCases {
+		e := HTTPEmitter{Format: tc.format}
+		body, err := e.body(httpTestBuffer(`{"a":1}`, "{\"b\":2}\n"), StringToStringTransformer{})
+		if err != nil || string(body) != tc.body {
+			t.Errorf("test case %d: body() = %q, %v want %q", idx, body, err, tc.body)
+		}
+	}
+}
+
+func TestHTTPEmitterSend(t *testing.T) {
+	key := []byte("secret")
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent, _ := ioutil.ReadAll(r.Body)
+		zr, err := gzip.NewReader(bytes.NewReader(sent))
+		if err != nil {
+			t.Errorf("request body is not gzipped: %v", err)
+			return
+		}
+		body, _ := ioutil.ReadAll(zr)
+		got = append(got, string(body))
+
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Authorization = %v want %v", r.Header.Get("Authorization"), "Bearer token")
+		}
+		ts := r.Header.Get("X-Signature-Timestamp")
+		if sig := r.Header.Get("X-Signature"); sig != "sha256="+hmacSignature(key, ts, sent) {
+			t.Errorf("X-Signature = %v does not sign the body", sig)
+		}
+
+		if len(got) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	e := HTTPEmitter{URL: server.URL, Gzip: true, SigningKey: key, Headers: map[string]string{"Authorization": "Bearer token"}}
+	start := time.Now()
+	if err := e.Emit(httpTestBuffer(`{"a":1}`), StringToStringTransformer{}, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+
+	if len(got) != 2 || got[1] != `[{"a":1}]` {
+		t.Errorf("requests = %q want the body twice", got)
+	}
+	if time.Since(start) < time.Second {
+		t.Errorf("Emit() retried after %s want at least the 1s Retry-After", time.Since(start))
+	}
+}
+
+func TestHTTPEmitterOnStatus(t *testing.T) {
+	status := http.StatusConflict
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		status   int
+		action   HTTPStatusAction
+		requests int
+		isError  bool
+	}{
+		{status: http.StatusConflict, action: HTTPDrop, requests: 1, isError: false},
+		{status: http.StatusConflict, action: HTTPFail, requests: 1, isError: true},
+		{status: http.StatusConflict, action: HTTPDefault, requests: 1, isError: true},
+		{status: http.StatusConflict, action: HTTPRetry, requests: 2, isError: true},
+		{status: http.StatusBadGateway, action: HTTPDefault, requests: 2, isError: true},
+	}
+
+	for idx, tc := range testCases {
+		status, requests = tc.status, 0
+		action := tc.action
+		e := HTTPEmitter{URL: server.URL, MaxAttempts: 2, OnStatus: func(int, []byte) HTTPStatusAction { return action }}
+		err := e.Emit(httpTestBuffer(`{}`), StringToStringTransformer{}, "shardId-000000000000")
+		if (err != nil) != tc.isError || requests != tc.requests {
+			t.Errorf("test case %d: Emit() = %v after %d requests want error %v after %d", idx, err, requests, tc.isError, tc.requests)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	testCases := []struct {
+		header string
+		want   time.Duration
+	}{
+		{header: "", want: 0},
+		{header: "7", want: 7 * time.Second},
+		{header: "Sat, 02 Jan 2016 03:04:35 GMT", want: 30 * time.Second},
+		{header: "Sat, 02 Jan 2016 03:00:00 GMT", want: 0},
+		{header: "86400", want: maxRetryAfter},
+		{header: "soon", want: 0},
+	}
+
+	for idx, tc := range testCases {
+		if d := parseRetryAfter(tc.header, now); d != tc.want {
+			t.Errorf("test case %d: parseRetryAfter(%v) = %v want %v", idx, tc.header, d, tc.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package connector
+
+import (
+	"encoding/json"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// JSONTransformer is a TypedDecodingTransformer decoding records of type T from JSON. The
+// Pipeline drops records that fail to decode.
+type JSONTransformer[T any] struct{}
+
+// DecodeRecord decodes the data of r into a T.
+func (t JSONTransformer[T]) DecodeRecord(r *Record) (T, error) {
+	var record T
+	err := json.Unmarshal(r.Data, &record)
+	return record, err
+}
+
+// ToRecord decodes data into a T. Data that fails to decode is logged and returned as the zero
+// value.
+func (t JSONTransformer[T]) ToRecord(data []byte) T {
+	var r T
+	if err := json.Unmarshal(data, &r); err != nil {
+		l4g.Warn("cannot decode record %q: %v", data, err)
+	}
+	return r
+}
+
+// FromRecord encodes r as JSON.
+func (t JSONTransformer[T]) FromRecord(r T) []byte {
+	data, err := json.Marshal(r)
+	if err != nil {
+		l4g.Warn("cannot encode record %+v: %v", r, err)
+	}
+	return data
+}
@@ -0,0 +1,52 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ezoic/go-kinesis"
+)
+
+func Test_JSONTransformer(t *testing.T) {
+	tr := JSONTransformer[typedClick]{}
+
+	r := tr.ToRecord([]byte(`{"user":"a","page":"/"}`))
+	if want := (typedClick{User: "a", Page: "/"}); r != want {
+		t.Errorf("ToRecord() = %v want %v", r, want)
+	}
+	if got, want := string(tr.FromRecord(r)), `{"user":"a","page":"/"}`; got != want {
+		t.Errorf("FromRecord() = %v want %v", got, want)
+	}
+	if got := tr.ToRecord([]byte(`not json`)); got != (typedClick{}) {
+		t.Errorf("ToRecord() of invalid json = %v want the zero value", got)
+	}
+	if _, err := tr.DecodeRecord(&Record{Data: []byte(`not json`)}); err == nil {
+		t.Errorf("DecodeRecord() of invalid json returned no error")
+	}
+}
+
+func Test_JSONTransformerDropsInvalidRecords(t *testing.T) {
+	reader := &fakeShardReader{batches: [][]kinesis.GetRecordsRecords{{
+		{Data: []byte(`{"user":"a","page":"/"}`), SequenceNumber: "1"},
+		{Data: []byte(`not json`), SequenceNumber: "2"},
+		{Data: []byte(`{"user":"c","page":"/x"}`), SequenceNumber: "3"},
+	}}}
+	c := &memoryCheckpoint{shardID: "shard"}
+	e := &typedClickEmitter{}
+
+	p := TypedPipeline[typedClick]{
+		Buffer:      &TypedRecordBuffer[typedClick]{NumRecordsToBuffer: 10},
+		Checkpoint:  c,
+		Emitter:     e,
+		StreamName:  "stream",
+		Transformer: JSONTransformer[typedClick]{},
+	}.Pipeline()
+	p.processShard(reader, "shard")
+
+	if want := []typedClick{{User: "a", Page: "/"}, {User: "c", Page: "/x"}}; !reflect.DeepEqual(e.records, want) {
+		t.Errorf("emitted records = %v want %v", e.records, want)
+	}
+	if c.sequenceNumber != "3" {
+		t.Errorf("checkpoint = %v want 3", c.sequenceNumber)
+	}
+}
@@ -0,0 +1,135 @@
+package connector
+
+import (
+	"fmt"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// KafkaMessage is a message produced by KafkaEmitter.
+type KafkaMessage struct {
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+// KafkaProducer produces messages to Kafka. Adapting a client's synchronous producer keeps the
+// connector free of a Kafka dependency; with sarama, SendMessages maps the messages to
+// ProducerMessages for a SyncProducer and its ProducerErrors to KafkaProducerErrors.
+type KafkaProducer interface {
+	// SendMessages returns once every message is acknowledged or has failed. Failures of some
+	// of the messages are reported as KafkaProducerErrors.
+	SendMessages(messages []*KafkaMessage) error
+}
+
+// KafkaProducerError is the failure of one message.
+type KafkaProducerError struct {
+	Message *KafkaMessage
+	Err     error
+}
+
+// KafkaProducerErrors lists the messages of a SendMessages call that failed.
+type KafkaProducerErrors []KafkaProducerError
+
+func (e KafkaProducerErrors) Error() string {
+	return fmt.Sprintf("kafka: failed to deliver %d messages, first error: %v", len(e), e[0].Err)
+}
+
+// KafkaEmitter is an implementation of Emitter that mirrors the buffered records into Kafka.
+// Emit returns only once the producer has every message acknowledged, so the Pipeline
+// checkpoints only after durable delivery; configure the producer to wait for all in-sync
+// replicas (acks=all) for that to hold. When messages fail with a recoverable error, every
+// message from the first failed one onward is sent again, so that no message is delivered for
+// the first time ahead of one it followed; those that had been delivered are duplicated.
+// Register a RecoverableErrorTester for the client's retriable errors. The producer must not
+// reorder messages of a partition itself, so use the idempotent producer or limit it to one
+// request in flight per connection (max.in.flight.requests.per.connection=1).
+type KafkaEmitter struct {
+	Producer KafkaProducer
+
+	// Topic is the topic records are produced to, unless TopicFor routes them.
+	Topic string
+
+	// TopicFor returns the topic of a record. Returning an empty string uses Topic.
+	TopicFor func(record interface{}, data []byte) string
+
+	// Key returns the message key of a record. When nil, the record's Kinesis partition key is
+	// used, which keeps the records of a key in order within a Kafka partition. Records
+	// buffered without metadata are keyed by the source shard ID.
+	Key func(record interface{}, data []byte) []byte
+}
+
+// Emit is invoked when the buffer is full. It produces every buffered record and waits for
+// the acknowledgements.
+func (e KafkaEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	metadata := BufferMetadata(b)
+	messages := make([]*KafkaMessage, 0, b.NumRecordsInBuffer())
+	for i, r := range b.Records() {
+		data := t.FromRecord(r)
+		m := &KafkaMessage{Topic: e.Topic, Key: []byte(shardID), Value: data}
+		if i < len(metadata) && metadata[i] != nil {
+			m.Key = []byte(metadata[i].PartitionKey)
+		}
+		if e.TopicFor != nil {
+			if topic := e.TopicFor(r, data); topic != "" {
+				m.Topic = topic
+			}
+		}
+		if m.Topic == "" {
+			return fmt.Errorf("kafka emitter has no topic for a record on shard %s", shardID)
+		}
+		if e.Key != nil {
+			m.Key = e.Key(r, data)
+		}
+		messages = append(messages, m)
+	}
+
+	err := sendWithRetry(indexes(0, len(messages)), func(ids []int) ([]int, error) {
+		return e.send(messages, ids)
+	}, "kafka emitter on shard "+shardID)
+	if err != nil {
+		l4g.Error("Kafka emitter ERROR: %v", err)
+		return err
+	}
+
+	l4g.Info("[%v] records produced to kafka on shard [%v]", b.NumRecordsInBuffer(), shardID)
+	return nil
+}
+
+// send produces the messages at ids and returns the ids from the first message that failed
+// with a recoverable error onward.
+func (e KafkaEmitter) send(messages []*KafkaMessage, ids []int) ([]int, error) {
+	batch := make([]*KafkaMessage, len(ids))
+	idOf := make(map[*KafkaMessage]int, len(ids))
+	for n, id := range ids {
+		batch[n] = messages[id]
+		idOf[messages[id]] = id
+	}
+
+	err := e.Producer.SendMessages(batch)
+	if err == nil {
+		return nil, nil
+	}
+	failures, ok := err.(KafkaProducerErrors)
+	if !ok {
+		return nil, err
+	}
+
+	first := len(ids)
+	for _, f := range failures {
+		id, ok := idOf[f.Message]
+		if !ok {
+			return nil, fmt.Errorf("kafka producer reported a failed message that was not sent: %v", f.Err)
+		}
+		if !IsRecoverableError(f.Err) {
+			return nil, f.Err
+		}
+		for n := 0; n < first; n++ {
+			if ids[n] == id {
+				first = n
+				break
+			}
+		}
+	}
+	return ids[first:], nil
+}
@@ -0,0 +1,75 @@
+package connector
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// fakeKafkaProducer acknowledges every message except those failed with an error on their
+// first attempt.
+type fakeKafkaProducer struct {
+	fail  map[string]error
+	calls [][]string
+}
+
+func (p *fakeKafkaProducer) SendMessages(messages []*KafkaMessage) error {
+	var sent []string
+	var failures KafkaProducerErrors
+	for _, m := range messages {
+		sent = append(sent, fmt.Sprintf("%s/%s/%s", m.Topic, m.Key, m.Value))
+		if err, ok := p.fail[string(m.Value)]; ok {
+			delete(p.fail, string(m.Value))
+			failures = append(failures, KafkaProducerError{Message: m, Err: err})
+		}
+	}
+	p.calls = append(p.calls, sent)
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+func TestKafkaEmitter(t *testing.T) {
+	p := &fakeKafkaProducer{fail: map[string]error{"b": &HTTPError{StatusCode: 503}}}
+	e := KafkaEmitter{
+		Producer: p,
+		Topic:    "events",
+		TopicFor: func(r interface{}, data []byte) string {
+			if string(data) == "c" {
+				return "other"
+			}
+			return ""
+		},
+	}
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	b.ProcessRecordWithMetadata("a", &Record{PartitionKey: "user-1", SequenceNumber: "1"})
+	b.ProcessRecordWithMetadata("b", &Record{PartitionKey: "user-2", SequenceNumber: "2"})
+	b.ProcessRecord("c", "3", 0)
+	if err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+
+	want := [][]string{
+		{"events/user-1/a", "events/user-2/b", "other/shardId-000000000000/c"},
+		{"events/user-2/b", "other/shardId-000000000000/c"},
+	}
+	if !reflect.DeepEqual(p.calls, want) {
+		t.Errorf("SendMessages calls = %q want %q", p.calls, want)
+	}
+}
+
+func TestKafkaEmitterUnrecoverable(t *testing.T) {
+	p := &fakeKafkaProducer{fail: map[string]error{"a": fmt.Errorf("message too large")}}
+	e := KafkaEmitter{Producer: p, Topic: "events", Key: func(r interface{}, data []byte) []byte { return data }}
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	b.ProcessRecord("a", "1", 0)
+	if err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000"); err == nil {
+		t.Errorf("Emit() = nil want an error")
+	}
+	if want := [][]string{{"events/a/a"}}; !reflect.DeepEqual(p.calls, want) {
+		t.Errorf("SendMessages calls = %q want %q", p.calls, want)
+	}
+}
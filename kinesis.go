@@ -1,6 +1,7 @@
 package connector
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/ezoic/go-kinesis"
@@ -51,3 +52,96 @@ func StreamExists(k *kinesis.Kinesis, streamName string) bool {
 	}
 	return false
 }
+
+// kinesisPutRecord is one entry of a PutRecords request.
+type kinesisPutRecord struct {
+	Data         []byte
+	PartitionKey string
+}
+
+// PutRecords limits: entries per call, bytes per call and bytes per entry. Sizes count the
+// data and the partition key.
+const (
+	maxPutRecordsCount    = 500
+	maxPutRecordsSize     = 5 * 1024 * 1024
+	maxKinesisRecordSize  = 1024 * 1024
+	maxPartitionKeyLength = 256
+)
+
+// putRecords puts records onto stream with as few PutRecords calls as the request limits allow.
+// Entries the response reports as failed, and whole calls that fail with a recoverable error,
+// are retried with the aws backoff. Entries that succeeded are never resubmitted.
+func putRecords(k *kinesis.Kinesis, stream string, records []kinesisPutRecord, infoString string) error {
+	batches, err := kinesisBatches(records)
+	if err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		if err = putRecordsBatch(k, stream, batch, infoString); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kinesisBatches splits records, in order, into PutRecords sized batches.
+func kinesisBatches(records []kinesisPutRecord) ([][]kinesisPutRecord, error) {
+	sizes := make([]int, len(records))
+	for i, r := range records {
+		n := len(r.Data) + len(r.PartitionKey)
+		if n > maxKinesisRecordSize {
+			return nil, fmt.Errorf("kinesis record of %d bytes exceeds the %d byte limit", n, maxKinesisRecordSize)
+		}
+		if len([]rune(r.PartitionKey)) > maxPartitionKeyLength || r.PartitionKey == "" {
+			return nil, fmt.Errorf("kinesis partition key %q must be 1 to %d characters", r.PartitionKey, maxPartitionKeyLength)
+		}
+		sizes[i] = n
+	}
+
+	var batches [][]kinesisPutRecord
+	for _, r := range batchRanges(sizes, maxPutRecordsCount, maxPutRecordsSize) {
+		batches = append(batches, records[r[0]:r[1]])
+	}
+	return batches, nil
+}
+
+func putRecordsBatch(k *kinesis.Kinesis, stream string, records []kinesisPutRecord, infoString string) error {
+	var err error
+	for i := 0; i < 10; i++ {
+		HandleAwsWaitTimeExp(i, infoString)
+
+		args := kinesis.NewArgs()
+		args.Add("StreamName", stream)
+		for _, r := range records {
+			args.AddRecord(r.Data, r.PartitionKey)
+		}
+
+		var resp *kinesis.PutRecordsResp
+		resp, err = k.PutRecords(args)
+		if err != nil {
+			if IsRecoverableError(err) {
+				l4g.Warn("recoverable PutRecords error %v for %s", err, infoString)
+				continue
+			}
+			return err
+		}
+		if resp.FailedRecordCount == 0 {
+			return nil
+		}
+
+		// keep only the failed entries; the response lists results in request order
+		var failed []kinesisPutRecord
+		for idx, r := range resp.Records {
+			if r.ErrorCode != "" && idx < len(records) {
+				failed = append(failed, records[idx])
+				err = &kinesis.Error{Code: r.ErrorCode, Message: r.ErrorMessage}
+			}
+		}
+		if len(failed) == 0 {
+			return fmt.Errorf("PutRecords to [%s] reported %d failures without failed entries", stream, resp.FailedRecordCount)
+		}
+		l4g.Warn("%d of %d records failed PutRecords to [%s] for %s: %v", len(failed), len(records), stream, infoString, err)
+		records = failed
+	}
+	return err
+}
@@ -0,0 +1,246 @@
+package connector
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+)
+
+// kplMagic prefixes every record aggregated in the Kinesis Producer Library format.
+var kplMagic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+// kplAggregator packs user records into KPL aggregated records, which consumers using the KCL
+// or a KPL deaggregation library unpack transparently. The format is the magic bytes, an
+// AggregatedRecord protobuf message and the MD5 of that message:
+//
+//	message AggregatedRecord {
+//	  repeated string partition_key_table = 1;
+//	  repeated string explicit_hash_key_table = 2;
+//	  repeated Record records = 3;
+//	}
+//	message Record {
+//	  required uint64 partition_key_index = 1;
+//	  optional uint64 explicit_hash_key_index = 2;
+//	  required bytes data = 3;
+//	}
+type kplAggregator struct {
+	partitionKey string
+	keys         []string
+	keyIndex     map[string]int
+	records      bytes.Buffer
+	count        int
+}
+
+// size is the encoded size of the aggregated record if it were built now, plus its partition key.
+func (a *kplAggregator) size() int {
+	n := len(kplMagic) + md5.Size + a.records.Len() + len(a.partitionKey)
+	for _, k := range a.keys {
+		n += 1 + protoVarintSize(uint64(len(k))) + len(k)
+	}
+	return n
+}
+
+// add appends a user record. The first record's partition key becomes the partition key of
+// the aggregated record, so aggregateRecords gives each aggregator a single key.
+func (a *kplAggregator) add(data []byte, partitionKey string) {
+	if a.keyIndex == nil {
+		a.keyIndex = map[string]int{}
+		a.partitionKey = partitionKey
+	}
+	idx, ok := a.keyIndex[partitionKey]
+	if !ok {
+		idx = len(a.keys)
+		a.keys = append(a.keys, partitionKey)
+		a.keyIndex[partitionKey] = idx
+	}
+
+	var r bytes.Buffer
+	protoVarintField(&r, 1, uint64(idx))
+	protoBytesField(&r, 3, data)
+
+	protoBytesField(&a.records, 3, r.Bytes())
+	a.count++
+}
+
+// recordSize is how much adding a user record would grow the aggregated record, at most.
+func (a *kplAggregator) recordSize(data []byte, partitionKey string) int {
+	inner := 1 + protoVarintSize(uint64(len(a.keys))) + 1 + protoVarintSize(uint64(len(data))) + len(data)
+	n := 1 + protoVarintSize(uint64(inner)) + inner
+	if _, ok := a.keyIndex[partitionKey]; !ok {
+		n += 1 + protoVarintSize(uint64(len(partitionKey))) + len(partitionKey)
+	}
+	return n
+}
+
+// record returns the aggregated record and resets the aggregator.
+func (a *kplAggregator) record() kinesisPutRecord {
+	var msg bytes.Buffer
+	for _, k := range a.keys {
+		protoBytesField(&msg, 1, []byte(k))
+	}
+	msg.Write(a.records.Bytes())
+
+	sum := md5.Sum(msg.Bytes())
+	data := make([]byte, 0, len(kplMagic)+msg.Len()+len(sum))
+	data = append(data, kplMagic...)
+	data = append(data, msg.Bytes()...)
+	data = append(data, sum[:]...)
+
+	r := kinesisPutRecord{Data: data, PartitionKey: a.partitionKey}
+	*a = kplAggregator{}
+	return r
+}
+
+// aggregateRecords packs records into as few KPL aggregated records as the Kinesis record size
+// limit allows. Records are only aggregated with others of the same partition key, so that each
+// user record still lands on the shard its key hashes to and stays in order with its key.
+func aggregateRecords(records []kinesisPutRecord) []kinesisPutRecord {
+	var out []kinesisPutRecord
+	var keys []string
+	aggregators := map[string]*kplAggregator{}
+	for _, r := range records {
+		a, ok := aggregators[r.PartitionKey]
+		if !ok {
+			a = &kplAggregator{}
+			aggregators[r.PartitionKey] = a
+			keys = append(keys, r.PartitionKey)
+		}
+		if a.count > 0 && a.size()+a.recordSize(r.Data, r.PartitionKey) > maxKinesisRecordSize {
+			out = append(out, a.record())
+		}
+		a.add(r.Data, r.PartitionKey)
+	}
+	for _, k := range keys {
+		if a := aggregators[k]; a.count > 0 {
+			out = append(out, a.record())
+		}
+	}
+	return out
+}
+
+// deaggregateRecord unpacks the user records of a KPL aggregated record. It reports false for
+// data that is not an aggregated record, including one whose checksum does not match, which is
+// then taken to be a plain record that happens to start with the magic bytes.
+func deaggregateRecord(data []byte) ([]kinesisPutRecord, bool) {
+	if !bytes.HasPrefix(data, kplMagic) || len(data) < len(kplMagic)+md5.Size {
+		return nil, false
+	}
+	msg := data[len(kplMagic) : len(data)-md5.Size]
+	sum := md5.Sum(msg)
+	if !bytes.Equal(sum[:], data[len(data)-md5.Size:]) {
+		return nil, false
+	}
+
+	var keys []string
+	var records []kinesisPutRecord
+	err := decodeProto(msg, func(field int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			keys = append(keys, string(b))
+		case 3:
+			var r kinesisPutRecord
+			var keyIdx uint64
+			err := decodeProto(b, func(field int, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					keyIdx = v
+				case 3:
+					r.Data = b
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if keyIdx >= uint64(len(keys)) {
+				return errKplMalformed
+			}
+			r.PartitionKey = keys[keyIdx]
+			records = append(records, r)
+		}
+		return nil
+	})
+	return records, err == nil
+}
+
+var errKplMalformed = errors.New("malformed aggregated record")
+
+// decodeProto calls f with the number and value of every field of a protobuf message, the
+// varint for varint fields and the bytes for length delimited ones.
+func decodeProto(b []byte, f func(field int, v uint64, b []byte) error) error {
+	for len(b) > 0 {
+		tag, n := decodeVarint(b)
+		if n == 0 {
+			return errKplMalformed
+		}
+		b = b[n:]
+		switch tag & 7 {
+		case 0:
+			v, n := decodeVarint(b)
+			if n == 0 {
+				return errKplMalformed
+			}
+			b = b[n:]
+			if err := f(int(tag>>3), v, nil); err != nil {
+				return err
+			}
+		case 2:
+			l, n := decodeVarint(b)
+			if n == 0 || l > uint64(len(b)-n) {
+				return errKplMalformed
+			}
+			b = b[n:]
+			if err := f(int(tag>>3), 0, b[:l]); err != nil {
+				return err
+			}
+			b = b[l:]
+		default:
+			return errKplMalformed
+		}
+	}
+	return nil
+}
+
+// decodeVarint returns the varint at the start of b and its length, or a length of 0 if b
+// does not start with a complete varint.
+func decodeVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i, c := range b {
+		if i == 10 {
+			break
+		}
+		v |= uint64(c&0x7f) << (7 * uint(i))
+		if c < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func protoVarintSize(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+func protoVarint(b *bytes.Buffer, v uint64) {
+	for v >= 0x80 {
+		b.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	b.WriteByte(byte(v))
+}
+
+func protoVarintField(b *bytes.Buffer, field int, v uint64) {
+	protoVarint(b, uint64(field)<<3)
+	protoVarint(b, v)
+}
+
+func protoBytesField(b *bytes.Buffer, field int, v []byte) {
+	protoVarint(b, uint64(field)<<3|2)
+	protoVarint(b, uint64(len(v)))
+	b.Write(v)
+}
@@ -0,0 +1,83 @@
+package connector
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAggregateRecordsRoundTrip(t *testing.T) {
+	records := []kinesisPutRecord{
+		{Data: []byte("one"), PartitionKey: "a"},
+		{Data: []byte("two"), PartitionKey: "b"},
+		{Data: []byte("three"), PartitionKey: "a"},
+	}
+
+	aggregated := aggregateRecords(records)
+	if len(aggregated) != 2 {
+		t.Fatalf("aggregateRecords() returned %d records want 2", len(aggregated))
+	}
+
+	var result []kinesisPutRecord
+	for i, key := range []string{"a", "b"} {
+		if aggregated[i].PartitionKey != key {
+			t.Errorf("record %d PartitionKey = %v want %v", i, aggregated[i].PartitionKey, key)
+		}
+		r, ok := deaggregateRecord(aggregated[i].Data)
+		if !ok {
+			t.Fatalf("record %d is not an aggregated record", i)
+		}
+		for _, u := range r {
+			if u.PartitionKey != aggregated[i].PartitionKey {
+				t.Errorf("record %d holds a user record of key %v", i, u.PartitionKey)
+			}
+		}
+		result = append(result, r...)
+	}
+
+	expected := []kinesisPutRecord{records[0], records[2], records[1]}
+	if len(result) != len(expected) {
+		t.Fatalf("deaggregated %d records want %d", len(result), len(expected))
+	}
+	for i, r := range expected {
+		if !bytes.Equal(result[i].Data, r.Data) || result[i].PartitionKey != r.PartitionKey {
+			t.Errorf("record %d = %s/%s want %s/%s", i, result[i].PartitionKey, result[i].Data, r.PartitionKey, r.Data)
+		}
+	}
+}
+
+func TestAggregateRecordsSplitsAtSizeLimit(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 300*1024)
+	records := repeatRecord(kinesisPutRecord{Data: data, PartitionKey: "k"}, 7)
+
+	aggregated := aggregateRecords(records)
+	if len(aggregated) != 3 {
+		t.Fatalf("aggregateRecords() returned %d records want 3", len(aggregated))
+	}
+
+	total := 0
+	for _, a := range aggregated {
+		if len(a.Data)+len(a.PartitionKey) > maxKinesisRecordSize {
+			t.Errorf("aggregated record of %d bytes is over the limit", len(a.Data))
+		}
+		result, ok := deaggregateRecord(a.Data)
+		if !ok {
+			t.Fatalf("aggregated record is not an aggregated record")
+		}
+		total += len(result)
+	}
+	if total != len(records) {
+		t.Errorf("deaggregated %d records want %d", total, len(records))
+	}
+}
+
+func TestDeaggregateRecordRejectsPlainRecords(t *testing.T) {
+	aggregated := aggregateRecords([]kinesisPutRecord{{Data: []byte("one"), PartitionKey: "a"}})[0].Data
+	corrupt := append([]byte{}, aggregated...)
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	for idx, data := range [][]byte{[]byte("plain"), []byte(`{"user":"a"}`), corrupt, kplMagic} {
+		if _, ok := deaggregateRecord(data); ok {
+			t.Errorf("test case %d: deaggregateRecord(%q) = ok want not aggregated", idx, data)
+		}
+	}
+}
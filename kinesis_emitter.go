@@ -0,0 +1,51 @@
+package connector
+
+import (
+	"github.com/ezoic/go-kinesis"
+	l4g "github.com/ezoic/log4go"
+)
+
+// KinesisEmitter is an implementation of Emitter that forwards the buffered records to another
+// Kinesis stream. Records are serialized with the Transformer and sent with as few PutRecords
+// calls as the 500 record and 5 MB request limits allow; entries rejected in a response are
+// retried on their own.
+type KinesisEmitter struct {
+	Ksis       *kinesis.Kinesis
+	StreamName string
+
+	// PartitionKey returns the partition key for a record and its serialized data. When nil,
+	// the source shard ID is used, which sends all records of a source shard to one target
+	// shard and caps them at its throughput. Records are not kept in order either way: entries
+	// rejected in a response are retried after later ones were written.
+	PartitionKey func(record interface{}, data []byte) string
+
+	// Aggregate packs records into KPL aggregated records, cutting the number of Kinesis
+	// records put. Consumers must deaggregate, as the KCL does.
+	Aggregate bool
+}
+
+// Emit is invoked when the buffer is full. It puts every buffered record onto StreamName.
+func (e KinesisEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	records := make([]kinesisPutRecord, 0, b.NumRecordsInBuffer())
+	for _, r := range b.Records() {
+		data := t.FromRecord(r)
+		key := shardID
+		if e.PartitionKey != nil {
+			key = e.PartitionKey(r, data)
+		}
+		records = append(records, kinesisPutRecord{Data: data, PartitionKey: key})
+	}
+
+	if e.Aggregate {
+		records = aggregateRecords(records)
+	}
+
+	err := putRecords(e.Ksis, e.StreamName, records, "kinesis emitter on shard "+shardID)
+	if err != nil {
+		l4g.Error("PutRecords ERROR: %v", err)
+		return err
+	}
+
+	l4g.Info("[%v] records emitted to [%s] as [%v] kinesis records on shard [%v]", b.NumRecordsInBuffer(), e.StreamName, len(records), shardID)
+	return nil
+}
@@ -0,0 +1,56 @@
+package connector
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKinesisBatches(t *testing.T) {
+	small := kinesisPutRecord{Data: []byte("x"), PartitionKey: "k"}
+	big := kinesisPutRecord{Data: bytes.Repeat([]byte("x"), maxKinesisRecordSize-1), PartitionKey: "k"}
+
+	testCases := []struct {
+		records []kinesisPutRecord
+		sizes   []int
+	}{
+		{records: nil, sizes: nil},
+		{records: repeatRecord(small, 3), sizes: []int{3}},
+		{records: repeatRecord(small, 1201), sizes: []int{500, 500, 201}},
+		{records: repeatRecord(big, 11), sizes: []int{5, 5, 1}},
+	}
+
+	for idx, tc := range testCases {
+		batches, err := kinesisBatches(tc.records)
+		if err != nil {
+			t.Fatalf("test case %d: kinesisBatches() returned %s", idx, err)
+		}
+		if len(batches) != len(tc.sizes) {
+			t.Fatalf("test case %d: got %d batches want %d", idx, len(batches), len(tc.sizes))
+		}
+		for i, b := range batches {
+			if len(b) != tc.sizes[i] {
+				t.Errorf("test case %d: batch %d has %d records want %d", idx, i, len(b), tc.sizes[i])
+			}
+		}
+	}
+}
+
+func TestKinesisBatchesRejectsInvalidRecords(t *testing.T) {
+	tooBig := kinesisPutRecord{Data: bytes.Repeat([]byte("x"), maxKinesisRecordSize), PartitionKey: "k"}
+	if _, err := kinesisBatches([]kinesisPutRecord{tooBig}); err == nil {
+		t.Errorf("expected an error for a record over the size limit")
+	}
+
+	noKey := kinesisPutRecord{Data: []byte("x")}
+	if _, err := kinesisBatches([]kinesisPutRecord{noKey}); err == nil {
+		t.Errorf("expected an error for an empty partition key")
+	}
+}
+
+func repeatRecord(r kinesisPutRecord, n int) []kinesisPutRecord {
+	records := make([]kinesisPutRecord, n)
+	for i := range records {
+		records[i] = r
+	}
+	return records
+}
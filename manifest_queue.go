@@ -0,0 +1,205 @@
+package connector
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueuedFile is an S3 object waiting in a ManifestQueue to be loaded.
+type QueuedFile struct {
+	Path     string
+	QueuedAt time.Time
+}
+
+// ManifestQueue durably tracks uploaded S3 objects until they are loaded by a manifest COPY.
+// Queues are partitioned by shard so each shard's pipeline only loads the files it uploaded.
+// Pushing a path that is already queued must not queue it twice.
+type ManifestQueue interface {
+	Push(shardID string, path string) error
+	Pending(shardID string) ([]QueuedFile, error)
+	Remove(shardID string, paths []string) error
+}
+
+// FileManifestQueue is a ManifestQueue kept in one file per shard under Dir on local disk.
+// It survives process restarts on the same host, but is not seen by other hosts, so it must not
+// be used with a LeaseCoordinator that can move shards between hosts.
+type FileManifestQueue struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// Push appends path to the shard's queue file and syncs it to disk.
+func (q *FileManifestQueue) Push(shardID string, path string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, err := q.read(shardID)
+	if err != nil {
+		return err
+	}
+	for _, f := range pending {
+		if f.Path == path {
+			return nil
+		}
+	}
+
+	if err = os.MkdirAll(q.Dir, 0755); err != nil {
+		return err
+	}
+	fh, err := os.OpenFile(q.file(shardID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	if _, err = fmt.Fprintf(fh, "%d\t%s\n", time.Now().UnixNano(), path); err != nil {
+		return err
+	}
+	return fh.Sync()
+}
+
+// Pending returns the shard's queued files in the order they were pushed.
+func (q *FileManifestQueue) Pending(shardID string) ([]QueuedFile, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.read(shardID)
+}
+
+// Remove drops paths from the shard's queue. The file is rewritten and renamed into place
+// so a crash leaves either the old or the new queue.
+func (q *FileManifestQueue) Remove(shardID string, paths []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, err := q.read(shardID)
+	if err != nil {
+		return err
+	}
+
+	remove := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		remove[p] = true
+	}
+
+	tmp := q.file(shardID) + ".tmp"
+	fh, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(fh)
+	for _, f := range pending {
+		if !remove[f.Path] {
+			fmt.Fprintf(w, "%d\t%s\n", f.QueuedAt.UnixNano(), f.Path)
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = fh.Sync()
+	}
+	fh.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, q.file(shardID))
+}
+
+func (q *FileManifestQueue) read(shardID string) ([]QueuedFile, error) {
+	fh, err := os.Open(q.file(shardID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var files []QueuedFile
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(parts) != 2 {
+			// a torn write at the end of the file, the upload will be replayed from the checkpoint
+			continue
+		}
+		ns, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, QueuedFile{Path: parts[1], QueuedAt: time.Unix(0, ns)})
+	}
+	return files, scanner.Err()
+}
+
+func (q *FileManifestQueue) file(shardID string) string {
+	return filepath.Join(q.Dir, filepath.Base(shardID)+".queue")
+}
+
+// MysqlManifestQueue is a ManifestQueue kept in a MySQL table, so the queue follows the shard
+// when its lease moves to another host.
+type MysqlManifestQueue struct {
+	TableName string
+	Db        *sql.DB
+}
+
+// EnsureSchema creates the queue table if it does not exist.
+func (q *MysqlManifestQueue) EnsureSchema() error {
+	_, err := q.Db.Exec("CREATE TABLE IF NOT EXISTS " + parseMysqlTableName(q.TableName).quoted() + " (" +
+		"shard_id VARCHAR(128) NOT NULL, " +
+		"s3_file VARCHAR(767) NOT NULL, " +
+		"queued_at BIGINT NOT NULL, " +
+		"PRIMARY KEY (shard_id, s3_file), " +
+		"KEY idx_queued_at (shard_id, queued_at)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	return err
+}
+
+// Push queues path for the shard, ignoring it if already queued.
+func (q *MysqlManifestQueue) Push(shardID string, path string) error {
+	_, err := q.Db.Exec("INSERT IGNORE INTO "+parseMysqlTableName(q.TableName).quoted()+" (shard_id, s3_file, queued_at) VALUES (?, ?, ?)", shardID, path, time.Now().UnixNano())
+	return err
+}
+
+// Pending returns the shard's queued files in the order they were pushed.
+func (q *MysqlManifestQueue) Pending(shardID string) ([]QueuedFile, error) {
+	rows, err := q.Db.Query("SELECT s3_file, queued_at FROM "+parseMysqlTableName(q.TableName).quoted()+" WHERE shard_id = ? ORDER BY queued_at, s3_file", shardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []QueuedFile
+	for rows.Next() {
+		var path string
+		var ns int64
+		if err = rows.Scan(&path, &ns); err != nil {
+			return nil, err
+		}
+		files = append(files, QueuedFile{Path: path, QueuedAt: time.Unix(0, ns)})
+	}
+	return files, rows.Err()
+}
+
+// Remove drops paths from the shard's queue.
+func (q *MysqlManifestQueue) Remove(shardID string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	args := []interface{}{shardID}
+	marks := make([]string, len(paths))
+	for i, p := range paths {
+		marks[i] = "?"
+		args = append(args, p)
+	}
+	_, err := q.Db.Exec("DELETE FROM "+parseMysqlTableName(q.TableName).quoted()+" WHERE shard_id = ? AND s3_file IN ("+strings.Join(marks, ", ")+")", args...)
+	return err
+}
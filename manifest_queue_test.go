@@ -0,0 +1,70 @@
+package connector
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testManifestQueue(t *testing.T, q ManifestQueue) {
+	for _, p := range []string{"a", "b", "a", "c"} {
+		if err := q.Push("shard", p); err != nil {
+			t.Fatalf("Push(%v) returned %s", p, err)
+		}
+	}
+	if err := q.Push("othershard", "z"); err != nil {
+		t.Fatalf("Push() returned %s", err)
+	}
+
+	pending, err := q.Pending("shard")
+	if err != nil {
+		t.Fatalf("Pending() returned %s", err)
+	}
+	if len(pending) != 3 || pending[0].Path != "a" || pending[1].Path != "b" || pending[2].Path != "c" {
+		t.Fatalf("Pending() = %+v, want a, b, c", pending)
+	}
+
+	if err = q.Remove("shard", []string{"a", "c"}); err != nil {
+		t.Fatalf("Remove() returned %s", err)
+	}
+	pending, _ = q.Pending("shard")
+	if len(pending) != 1 || pending[0].Path != "b" {
+		t.Errorf("Pending() after Remove() = %+v, want b", pending)
+	}
+
+	pending, _ = q.Pending("othershard")
+	if len(pending) != 1 || pending[0].Path != "z" {
+		t.Errorf("Pending() for another shard = %+v, want z", pending)
+	}
+}
+
+func TestFileManifestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifestqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testManifestQueue(t, &FileManifestQueue{Dir: dir})
+
+	// a new queue on the same directory sees what was left behind
+	pending, err := (&FileManifestQueue{Dir: dir}).Pending("shard")
+	if err != nil || len(pending) != 1 || pending[0].Path != "b" {
+		t.Errorf("Pending() after reopening = %+v, %v", pending, err)
+	}
+}
+
+func Test_MysqlManifestQueue(t *testing.T) {
+	rc, _ := sql.Open("mysql", os.Getenv("CHECKPOINT_MYSQL_DSN"))
+
+	q := &MysqlManifestQueue{TableName: "KinesisConnector.TestManifestQueue", Db: rc}
+	if err := q.EnsureSchema(); err != nil {
+		t.Fatalf("EnsureSchema() returned %s", err)
+	}
+	rc.Exec("DELETE FROM KinesisConnector.TestManifestQueue")
+
+	testManifestQueue(t, q)
+
+	rc.Exec("DROP TABLE KinesisConnector.TestManifestQueue")
+}
@@ -0,0 +1,180 @@
+package connector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// Sink is one of the Emitters a MultiEmitter sends buffers to.
+type Sink struct {
+	Name    string
+	Emitter Emitter
+
+	// BestEffort sinks are logged and reported when they fail but do not fail the Emit, so the
+	// Pipeline checkpoints past the buffer regardless.
+	BestEffort bool
+
+	// Attempts is the sink's retry budget: how many times the buffer is emitted to it while it
+	// fails with recoverable errors, with the aws backoff in between. One when zero.
+	Attempts int
+}
+
+// SinkResult is the outcome of emitting a buffer to one sink.
+type SinkResult struct {
+	Name     string
+	Err      error
+	Attempts int
+
+	// Skipped is set for sinks not attempted because an earlier required sink failed.
+	Skipped bool
+}
+
+// Succeeded reports whether the sink received the buffer.
+func (r SinkResult) Succeeded() bool {
+	return r.Err == nil && !r.Skipped
+}
+
+// MultiEmitError is returned by MultiEmitter when a required sink fails. Results holds the
+// outcome of every sink, so callers can tell which ones received the buffer.
+type MultiEmitError struct {
+	Results []SinkResult
+}
+
+func (e *MultiEmitError) Error() string {
+	var failed []string
+	for _, r := range e.Results {
+		if r.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", r.Name, r.Err))
+		}
+	}
+	return "emit failed for " + strings.Join(failed, "; ")
+}
+
+// MultiEmitter is an implementation of Emitter that sends each buffer to several sinks, so one
+// Pipeline can e.g. archive to S3 and load Redshift without reading the shard twice.
+//
+// Emit fails when any required sink fails, and the Pipeline then replays the buffer to every
+// sink, including those that had already received it. Sinks should therefore be idempotent,
+// as the Redshift emitters are with a LoadCheckpoint.
+//
+// A MultiEmitter is a ShardFlusher flushing every sink that is one, so sinks that hold data back,
+// e.g. a RedshiftBatchEmitter, are flushed by the Pipeline as if they were its own Emitter.
+type MultiEmitter struct {
+	Sinks []Sink
+
+	// Parallel emits to every sink at once. Otherwise sinks are emitted to in order and a
+	// failing required sink skips the ones after it.
+	Parallel bool
+
+	// Report, when set, receives the outcome of every sink for each buffer.
+	Report func(shardID string, results []SinkResult)
+}
+
+// Emit is invoked when the buffer is full. It sends the buffer to every sink.
+func (e MultiEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	results := make([]SinkResult, len(e.Sinks))
+	if e.Parallel {
+		var wg sync.WaitGroup
+		for i := range e.Sinks {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = e.emit(e.Sinks[i], b, t, shardID)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		failed := false
+		for i, s := range e.Sinks {
+			if failed {
+				results[i] = SinkResult{Name: s.Name, Skipped: true}
+				continue
+			}
+			results[i] = e.emit(s, b, t, shardID)
+			failed = results[i].Err != nil && !s.BestEffort
+		}
+	}
+
+	if e.Report != nil {
+		e.Report(shardID, results)
+	}
+
+	for i, r := range results {
+		if r.Err != nil && !e.Sinks[i].BestEffort {
+			return &MultiEmitError{Results: results}
+		}
+	}
+	return nil
+}
+
+// FlushInterval is the shortest FlushInterval of the sinks, or 0 when no sink has one.
+func (e MultiEmitter) FlushInterval() time.Duration {
+	var interval time.Duration
+	for _, s := range e.Sinks {
+		if d := flushInterval(s.Emitter); d > 0 && (interval == 0 || d < interval) {
+			interval = d
+		}
+	}
+	return interval
+}
+
+// FlushShard flushes every sink that is a ShardFlusher. Like Emit, it fails when a required
+// sink fails, after flushing the others.
+func (e MultiEmitter) FlushShard(shardID string, final bool) error {
+	var results []SinkResult
+	failed := false
+	for _, s := range e.Sinks {
+		if !holdsShardData(s.Emitter) {
+			continue
+		}
+
+		r := SinkResult{Name: s.Name, Attempts: 1, Err: flushShard(s.Emitter, shardID, final)}
+		if r.Err != nil && s.BestEffort {
+			l4g.Error("best effort sink [%s] failed to flush on shard [%v], continuing: %v", s.Name, shardID, r.Err)
+		} else if r.Err != nil {
+			failed = true
+		}
+		results = append(results, r)
+	}
+
+	if failed {
+		return &MultiEmitError{Results: results}
+	}
+	return nil
+}
+
+func (e MultiEmitter) wrappedEmitters() []interface{} {
+	emitters := make([]interface{}, len(e.Sinks))
+	for i, s := range e.Sinks {
+		emitters[i] = s.Emitter
+	}
+	return emitters
+}
+
+func (e MultiEmitter) emit(s Sink, b Buffer, t Transformer, shardID string) SinkResult {
+	attempts := s.Attempts
+	if attempts == 0 {
+		attempts = 1
+	}
+
+	r := SinkResult{Name: s.Name}
+	for i := 0; i < attempts; i++ {
+		HandleAwsWaitTimeExp(i, "sink "+s.Name+" on shard "+shardID)
+
+		r.Attempts++
+		r.Err = s.Emitter.Emit(b, t, shardID)
+		if r.Err == nil || IsRecoverableError(r.Err) == false {
+			break
+		}
+		l4g.Warn("recoverable error %v from sink [%s] on shard [%v]", r.Err, s.Name, shardID)
+	}
+
+	if r.Err != nil && s.BestEffort {
+		l4g.Error("best effort sink [%s] failed on shard [%v], continuing: %v", s.Name, shardID, r.Err)
+	}
+	return r
+}
@@ -0,0 +1,150 @@
+package connector
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEmitter fails its first failures emits with err and counts every emit.
+type fakeEmitter struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	emits    int
+}
+
+func (e *fakeEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.emits++
+	if e.emits <= e.failures {
+		return e.err
+	}
+	return nil
+}
+
+func TestMultiEmitter(t *testing.T) {
+	recoverable := &HTTPError{StatusCode: 503}
+	fatal := fmt.Errorf("fatal")
+
+	testCases := []struct {
+		parallel  bool
+		sinks     []*fakeEmitter
+		policies  []Sink
+		emits     []int
+		succeeded []bool
+		isError   bool
+	}{
+		// every sink succeeds
+		{
+			sinks:     []*fakeEmitter{{}, {}},
+			policies:  []Sink{{}, {}},
+			emits:     []int{1, 1},
+			succeeded: []bool{true, true},
+		},
+		// a recoverable failure is retried within the sink's budget
+		{
+			sinks:     []*fakeEmitter{{failures: 1, err: recoverable}, {}},
+			policies:  []Sink{{Attempts: 2}, {}},
+			emits:     []int{2, 1},
+			succeeded: []bool{true, true},
+		},
+		// a failing best effort sink does not fail the emit
+		{
+			sinks:     []*fakeEmitter{{failures: 5, err: fatal}, {}},
+			policies:  []Sink{{BestEffort: true, Attempts: 3}, {}},
+			emits:     []int{1, 1},
+			succeeded: []bool{false, true},
+		},
+		// a failing required sink skips the rest in sequence
+		{
+			sinks:     []*fakeEmitter{{failures: 5, err: recoverable}, {}},
+			policies:  []Sink{{Attempts: 2}, {}},
+			emits:     []int{2, 0},
+			succeeded: []bool{false, false},
+			isError:   true,
+		},
+		// but not in parallel
+		{
+			parallel:  true,
+			sinks:     []*fakeEmitter{{failures: 5, err: fatal}, {}},
+			policies:  []Sink{{}, {}},
+			emits:     []int{1, 1},
+			succeeded: []bool{false, true},
+			isError:   true,
+		},
+	}
+
+	for idx, tc := range testCases {
+		e := MultiEmitter{Parallel: tc.parallel}
+		for i, s := range tc.sinks {
+			p := tc.policies[i]
+			p.Name, p.Emitter = fmt.Sprint("sink", i), s
+			e.Sinks = append(e.Sinks, p)
+		}
+		var reported []SinkResult
+		e.Report = func(shardID string, results []SinkResult) { reported = results }
+
+		b := &RecordBuffer{NumRecordsToBuffer: 10}
+		b.ProcessRecord("a", "1", 0)
+		err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000")
+
+		if (err != nil) != tc.isError {
+			t.Errorf("test case %d: Emit() = %v want error %v", idx, err, tc.isError)
+		}
+		if multiErr, ok := err.(*MultiEmitError); err != nil && (!ok || !reflect.DeepEqual(multiErr.Results, reported)) {
+			t.Errorf("test case %d: Emit() = %#v want a MultiEmitError with the reported results", idx, err)
+		}
+
+		var emits []int
+		var succeeded []bool
+		for i, s := range tc.sinks {
+			emits = append(emits, s.emits)
+			succeeded = append(succeeded, reported[i].Succeeded())
+		}
+		if !reflect.DeepEqual(emits, tc.emits) {
+			t.Errorf("test case %d: emits = %v want %v", idx, emits, tc.emits)
+		}
+		if !reflect.DeepEqual(succeeded, tc.succeeded) {
+			t.Errorf("test case %d: succeeded = %v want %v", idx, succeeded, tc.succeeded)
+		}
+	}
+}
+
+// typedFlushingEmitter is a TypedEmitter that is a ShardFlusher.
+type typedFlushingEmitter struct {
+	flushingEmitter
+}
+
+func (e *typedFlushingEmitter) Emit(b TypedBuffer[string], t TypedTransformer[string], shardID string) error {
+	return nil
+}
+
+func TestMultiEmitterFlushesSinks(t *testing.T) {
+	flushing := &flushingEmitter{shardEmitter: shardEmitter{records: map[string][]interface{}{}}}
+	typed := &typedFlushingEmitter{}
+	failing := &fakeEmitter{}
+	e := MultiEmitter{Sinks: []Sink{
+		{Name: "plain", Emitter: failing},
+		{Name: "batch", Emitter: flushing},
+		{Name: "typed", Emitter: UntypedEmitter[string](typed)},
+	}}
+
+	if got := e.FlushInterval(); got != time.Nanosecond {
+		t.Errorf("FlushInterval() = %v want %v", got, time.Nanosecond)
+	}
+	if err := e.FlushShard("shard", true); err != nil {
+		t.Errorf("FlushShard() = %v want nil", err)
+	}
+	if !reflect.DeepEqual(flushing.flushes, []bool{true}) || !reflect.DeepEqual(typed.flushes, []bool{true}) {
+		t.Errorf("flushes = %v and %v want a final flush of each", flushing.flushes, typed.flushes)
+	}
+
+	plain := MultiEmitter{Sinks: []Sink{{Name: "plain", Emitter: failing}}}
+	if got := plain.FlushInterval(); got != 0 || holdsShardData(plain) {
+		t.Errorf("FlushInterval() without flushing sinks = %v, holds data %v want 0, false", got, holdsShardData(plain))
+	}
+}
@@ -0,0 +1,220 @@
+package connector
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// mysqlMigration is a single versioned change to the checkpoint table. Migrations are
+// applied in order and each one must be safe to run against a table that was created
+// by hand before EnsureSchema existed.
+type mysqlMigration struct {
+	Version     int
+	Description string
+	Apply       func(conn *sql.Conn, table mysqlTableName) error
+}
+
+// mysqlCheckpointMigrations is the ordered list of checkpoint table migrations.
+// New migrations must be appended with the next version number; never edit an existing one.
+var mysqlCheckpointMigrations = []mysqlMigration{
+	{
+		Version:     1,
+		Description: "create checkpoint table",
+		Apply: func(conn *sql.Conn, table mysqlTableName) error {
+			return mysqlExec(conn, "CREATE TABLE IF NOT EXISTS "+table.quoted()+" ("+
+				"checkpoint_key VARCHAR(255) NOT NULL, "+
+				"sequence_number VARCHAR(128) NOT NULL, "+
+				"last_updated DATETIME NULL, "+
+				"PRIMARY KEY (checkpoint_key)"+
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+		},
+	},
+	{
+		Version:     2,
+		Description: "add last_arrival_time and server_id",
+		Apply: func(conn *sql.Conn, table mysqlTableName) error {
+			err := mysqlAddColumn(conn, table, "last_arrival_time", "INT NOT NULL DEFAULT 0")
+			if err != nil {
+				return err
+			}
+			return mysqlAddColumn(conn, table, "server_id", "VARCHAR(255) NOT NULL DEFAULT ''")
+		},
+	},
+	{
+		Version:     3,
+		Description: "add is_closed",
+		Apply: func(conn *sql.Conn, table mysqlTableName) error {
+			return mysqlAddColumn(conn, table, "is_closed", "TINYINT(1) NOT NULL DEFAULT 0")
+		},
+	},
+	{
+		Version:     4,
+		Description: "index server_id",
+		Apply: func(conn *sql.Conn, table mysqlTableName) error {
+			return mysqlAddIndex(conn, table, "idx_server_id", "server_id")
+		},
+	},
+}
+
+// EnsureSchema creates the checkpoint table if it does not exist and applies any
+// migrations that have not yet been recorded for it. Applied versions are stored in a
+// companion table named <TableName>_schema_version. It is safe to call from several
+// processes at once; a MySQL named lock serializes the migrations.
+func (c *MysqlCheckpoint) EnsureSchema() error {
+	table := parseMysqlTableName(c.TableName)
+	versionTable := table.withSuffix("_schema_version")
+
+	ctx := context.Background()
+	conn, err := c.Db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// GET_LOCK is scoped to the session, so everything below must run on the same conn
+	lockName := "kinesis_connector_schema:" + c.TableName
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, 60).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("could not acquire schema lock %s", lockName)
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+
+	err = mysqlExec(conn, "CREATE TABLE IF NOT EXISTS "+versionTable.quoted()+" ("+
+		"version INT NOT NULL, "+
+		"description VARCHAR(255) NOT NULL, "+
+		"applied_at DATETIME NOT NULL, "+
+		"PRIMARY KEY (version)"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	if err != nil {
+		return err
+	}
+
+	current, err := mysqlSchemaVersion(conn, versionTable)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mysqlCheckpointMigrations {
+		if m.Version <= current {
+			continue
+		}
+
+		l4g.Info("applying checkpoint schema migration %d (%s) to %s", m.Version, m.Description, c.TableName)
+		if err = m.Apply(conn, table); err != nil {
+			return fmt.Errorf("checkpoint schema migration %d (%s) failed: %v", m.Version, m.Description, err)
+		}
+
+		_, err = conn.ExecContext(ctx, "INSERT INTO "+versionTable.quoted()+" (version, description, applied_at) VALUES (?, ?, ?)", m.Version, m.Description, time.Now().UTC().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mysqlSchemaVersion returns the highest migration version recorded, or 0 if none.
+func mysqlSchemaVersion(conn *sql.Conn, versionTable mysqlTableName) (int, error) {
+	var v sql.NullInt64
+	err := conn.QueryRowContext(context.Background(), "SELECT MAX(version) FROM "+versionTable.quoted()).Scan(&v)
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64), nil
+}
+
+func mysqlExec(conn *sql.Conn, stmt string) error {
+	l4g.Finest(stmt)
+	_, err := conn.ExecContext(context.Background(), stmt)
+	return err
+}
+
+// mysqlAddColumn adds a column unless it already exists. MySQL has no ADD COLUMN IF NOT EXISTS.
+func mysqlAddColumn(conn *sql.Conn, table mysqlTableName, column string, definition string) error {
+	var n int
+	err := conn.QueryRowContext(context.Background(),
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = "+table.schemaExpr()+" AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		table.args(column)...).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	return mysqlExec(conn, "ALTER TABLE "+table.quoted()+" ADD COLUMN "+quoteMysqlIdentifier(column)+" "+definition)
+}
+
+// mysqlAddIndex adds a secondary index unless one with the same name already exists.
+func mysqlAddIndex(conn *sql.Conn, table mysqlTableName, index string, columns ...string) error {
+	var n int
+	err := conn.QueryRowContext(context.Background(),
+		"SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = "+table.schemaExpr()+" AND TABLE_NAME = ? AND INDEX_NAME = ?",
+		table.args(index)...).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteMysqlIdentifier(col)
+	}
+	return mysqlExec(conn, "CREATE INDEX "+quoteMysqlIdentifier(index)+" ON "+table.quoted()+" ("+strings.Join(quoted, ", ")+")")
+}
+
+// mysqlTableName is a table name optionally qualified with its database, e.g. KinesisConnector.Checkpoint.
+type mysqlTableName struct {
+	Schema string
+	Name   string
+}
+
+func parseMysqlTableName(s string) mysqlTableName {
+	s = strings.Replace(s, "`", "", -1)
+	if i := strings.Index(s, "."); i >= 0 {
+		return mysqlTableName{Schema: s[:i], Name: s[i+1:]}
+	}
+	return mysqlTableName{Name: s}
+}
+
+func (t mysqlTableName) withSuffix(suffix string) mysqlTableName {
+	return mysqlTableName{Schema: t.Schema, Name: t.Name + suffix}
+}
+
+func (t mysqlTableName) quoted() string {
+	if t.Schema == "" {
+		return quoteMysqlIdentifier(t.Name)
+	}
+	return quoteMysqlIdentifier(t.Schema) + "." + quoteMysqlIdentifier(t.Name)
+}
+
+// schemaExpr is the information_schema filter for the table's database; unqualified
+// names live in the connection's current database.
+func (t mysqlTableName) schemaExpr() string {
+	if t.Schema == "" {
+		return "DATABASE()"
+	}
+	return "?"
+}
+
+// args builds the bind arguments matching schemaExpr followed by the table name and extra.
+func (t mysqlTableName) args(extra string) []interface{} {
+	if t.Schema == "" {
+		return []interface{}{t.Name, extra}
+	}
+	return []interface{}{t.Schema, t.Name, extra}
+}
+
+func quoteMysqlIdentifier(s string) string {
+	return "`" + strings.Replace(s, "`", "``", -1) + "`"
+}
@@ -0,0 +1,76 @@
+package connector
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func Test_parseMysqlTableName(t *testing.T) {
+	testCases := []struct {
+		in     string
+		quoted string
+	}{
+		{in: "Checkpoint", quoted: "`Checkpoint`"},
+		{in: "KinesisConnector.TestCheckpoint", quoted: "`KinesisConnector`.`TestCheckpoint`"},
+		{in: "`KinesisConnector`.`TestCheckpoint`", quoted: "`KinesisConnector`.`TestCheckpoint`"},
+	}
+
+	for idx, tc := range testCases {
+		r := parseMysqlTableName(tc.in).quoted()
+		if r != tc.quoted {
+			t.Errorf("test case %d: quoted() = %v, want %v", idx, r, tc.quoted)
+		}
+	}
+
+	r := parseMysqlTableName("KinesisConnector.TestCheckpoint").withSuffix("_schema_version").quoted()
+	if r != "`KinesisConnector`.`TestCheckpoint_schema_version`" {
+		t.Errorf("withSuffix() = %v", r)
+	}
+}
+
+func Test_mysqlCheckpointMigrationsOrdered(t *testing.T) {
+	for i, m := range mysqlCheckpointMigrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d, want %d", i, m.Version, i+1)
+		}
+	}
+}
+
+func Test_MysqlEnsureSchema(t *testing.T) {
+	rc, _ := sql.Open("mysql", os.Getenv("CHECKPOINT_MYSQL_DSN"))
+	table := "KinesisConnector.TestCheckpointSchema"
+
+	rc.Exec("DROP TABLE IF EXISTS KinesisConnector.TestCheckpointSchema")
+	rc.Exec("DROP TABLE IF EXISTS KinesisConnector.TestCheckpointSchema_schema_version")
+
+	c := MysqlCheckpoint{AppName: "app", StreamName: "stream", TableName: table, Db: rc, ServerId: "testserverid"}
+
+	// running it twice must be a no-op the second time
+	for i := 0; i < 2; i++ {
+		if err := c.EnsureSchema(); err != nil {
+			t.Fatalf("EnsureSchema() run %d returned %s", i, err)
+		}
+	}
+
+	var version int
+	err := rc.QueryRow("SELECT MAX(version) FROM KinesisConnector.TestCheckpointSchema_schema_version").Scan(&version)
+	if err != nil {
+		t.Fatalf("cannot read schema version, %s", err)
+	}
+	if version != len(mysqlCheckpointMigrations) {
+		t.Errorf("schema version = %v, want %v", version, len(mysqlCheckpointMigrations))
+	}
+
+	if c.CheckpointExists("shard") {
+		t.Errorf("CheckpointExists() = true on a new table")
+	}
+	c.SetCheckpoint("shard", "fakeSeqNum", 0)
+	c.SetClosed("shard", true)
+	if !c.CheckpointExists("shard") || !c.CheckpointIsClosed("shard") {
+		t.Errorf("checkpoint was not stored in the migrated table")
+	}
+
+	rc.Exec("DROP TABLE IF EXISTS KinesisConnector.TestCheckpointSchema")
+	rc.Exec("DROP TABLE IF EXISTS KinesisConnector.TestCheckpointSchema_schema_version")
+}
@@ -24,6 +24,7 @@ import (
 type Pipeline struct {
 	Buffer                    Buffer
 	Checkpoint                Checkpoint
+	Dedup                     *Deduplicator
 	Emitter                   Emitter
 	Filter                    Filter
 	StreamName                string
@@ -32,19 +33,61 @@ type Pipeline struct {
 	CheckpointFilteredRecords bool
 	GetRecordsLimit           int
 	LeaseCoordinator          *klease.Coordinator
-	PipelineLock              *sync.Mutex
-	RunningPipes              map[string]bool
+
+	// Deaggregate unpacks records aggregated by the KPL into their user records, which are
+	// transformed, filtered and buffered one by one with their SubSequenceNumber. The Buffer
+	// must be a MetadataBuffer, as RecordBuffer is, to tell the user records of an aggregated
+	// record apart; other buffers keep only the first of them.
+	Deaggregate bool
+
+	// Running, when set, has the shard removed once the pipeline stops processing it.
+	Running *ShardSet
+
+	// Deprecated: use Running. RunningPipes has the shard set to false when ownership is
+	// lost, under PipelineLock or, when that is nil, a lock shared by all pipelines.
+	PipelineLock *sync.Mutex
+	RunningPipes map[string]bool
+}
+
+// shardReader is the part of the Kinesis client a Pipeline reads shards with.
+type shardReader interface {
+	GetShardIterator(args *kinesis.RequestArgs) (*kinesis.GetShardIteratorResp, error)
+	GetRecords(args *kinesis.RequestArgs) (*kinesis.GetRecordsResp, error)
 }
 
+// runningPipesLock guards RunningPipes maps given without a PipelineLock.
+var runningPipesLock sync.Mutex
+
 // ProcessShard kicks off the process of a Kinesis Shard.
 // It is a long running process that will continue to read from the shard.
+//
+// The Buffer and Checkpoint hold the state of one shard: ProcessShard panics if another shard
+// is being processed with either of them. Use a Runner to build a Pipeline per shard.
 func (p Pipeline) ProcessShard(ksis *kinesis.Kinesis, shardID string) {
+	p.processShard(ksis, shardID)
+}
+
+func (p Pipeline) processShard(ksis shardReader, shardID string) {
+	defer p.Running.Remove(shardID)
+
+	if err := claimShardState(shardID, p.Buffer, p.Checkpoint); err != nil {
+		log.Panicf("ProcessShard ERROR: stream %s, shard %s: %v\n", p.StreamName, shardID, err)
+	}
+	defer releaseShardState(p.Buffer, p.Checkpoint)
+	if p.Dedup != nil {
+		defer p.Dedup.Release(shardID)
+	}
+
 	expiredIteratorCount := 0
 
 	for true {
 
 		err := p.processShardInternal(ksis, shardID, &expiredIteratorCount)
 		if err == nil {
+			if err = p.flushEmitter(shardID, true); err != nil {
+				time.Sleep(100 * time.Millisecond)
+				log.Panicf("ProcessShard ERROR: stream %s, shard %s has been closed but its emitter could not be flushed: %v\n", p.StreamName, shardID, err)
+			}
 			p.Checkpoint.SetClosed(shardID, true)
 			l4g.Info("stream %s, shard %s has been closed", p.StreamName, shardID)
 			if p.LeaseCoordinator != nil {
@@ -65,15 +108,18 @@ func (p Pipeline) ProcessShard(ksis *kinesis.Kinesis, shardID string) {
 			}
 		} else if err.Error() == "LostOwnership" {
 			l4g.Info("\n\n\nstream %s, shard %s has changed owners\n\n\n", p.StreamName, shardID)
+			if err = p.flushEmitter(shardID, true); err != nil {
+				l4g.Error("stream %s, shard %s has changed owners but its emitter could not be flushed: %v", p.StreamName, shardID, err)
+			}
 			//let kauto know we are off so we have the ability to start this shard again if we ever regain ownership
 			if p.RunningPipes != nil {
-				if p.PipelineLock != nil {
-					p.PipelineLock.Lock()
+				lock := p.PipelineLock
+				if lock == nil {
+					lock = &runningPipesLock
 				}
+				lock.Lock()
 				p.RunningPipes[shardID] = false
-				if p.PipelineLock != nil {
-					p.PipelineLock.Unlock()
-				}
+				lock.Unlock()
 			}
 			return
 		} else {
@@ -85,7 +131,7 @@ func (p Pipeline) ProcessShard(ksis *kinesis.Kinesis, shardID string) {
 
 }
 
-func (p Pipeline) processShardInternal(ksis *kinesis.Kinesis, shardID string, expiredIteratorCount *int) error {
+func (p Pipeline) processShardInternal(ksis shardReader, shardID string, expiredIteratorCount *int) error {
 
 	args := kinesis.NewArgs()
 	args.Add("ShardId", shardID)
@@ -111,6 +157,14 @@ func (p Pipeline) processShardInternal(ksis *kinesis.Kinesis, shardID string, ex
 
 	shardIterator := shardInfo.ShardIterator
 
+	// flushTick drives emitters that hold data back between buffers
+	var flushTick <-chan time.Time
+	if f, ok := p.Emitter.(ShardFlusher); ok && f.FlushInterval() > 0 {
+		ticker := time.NewTicker(f.FlushInterval())
+		defer ticker.Stop()
+		flushTick = ticker.C
+	}
+
 	consecutiveErrorAttempts := 0
 	//provisionedThroughputExceededCount := 0
 
@@ -158,15 +212,37 @@ func (p Pipeline) processShardInternal(ksis *kinesis.Kinesis, shardID string, ex
 		}
 
 		if len(recordSet.Records) > 0 {
-			for _, v := range recordSet.Records {
-				data := v.GetData()
+			metadata := p.recordMetadata(recordSet.Records, shardID)
+			records := make([]interface{}, len(metadata))
+			kept := make([]bool, len(metadata))
+			var keptRecords []interface{}
+			for i, m := range metadata {
+				r, err := toRecord(p.Transformer, m)
+				if err != nil {
+					l4g.Warn("dropping record %v that cannot be decoded on stream %s, shard %s: %v", m.SequenceNumber, p.StreamName, shardID, err)
+				}
 
-				r := p.Transformer.ToRecord(data)
+				metadata[i], records[i], kept[i] = m, r, err == nil && keepRecord(p.Filter, r, m)
+				if kept[i] {
+					keptRecords = append(keptRecords, r)
+				}
+			}
+
+			// look the page's ids up in the dedup store at once rather than per record
+			if p.Dedup != nil {
+				p.Dedup.Prefetch(shardID, keptRecords)
+			}
 
-				if p.Filter.KeepRecord(r) {
-					p.Buffer.ProcessRecord(r, v.SequenceNumber, int(v.ApproximateArrivalTimestamp))
+			for i, m := range metadata {
+				r := records[i]
+				if kept[i] && (p.Dedup == nil || !p.Dedup.Duplicate(shardID, r)) {
+					if mb, ok := p.Buffer.(MetadataBuffer); ok {
+						mb.ProcessRecordWithMetadata(r, m)
+					} else {
+						p.Buffer.ProcessRecord(r, m.SequenceNumber, m.arrivalTime())
+					}
 				} else if p.CheckpointFilteredRecords {
-					p.Buffer.ProcessRecord(nil, v.SequenceNumber, int(v.ApproximateArrivalTimestamp))
+					p.Buffer.ProcessRecord(nil, m.SequenceNumber, m.arrivalTime())
 				}
 			}
 		} else if recordSet.NextShardIterator == "" {
@@ -186,30 +262,139 @@ func (p Pipeline) processShardInternal(ksis *kinesis.Kinesis, shardID string, ex
 			}
 		}
 
+		select {
+		case <-flushTick:
+			if err = p.flushEmitter(shardID, false); err != nil {
+				return err
+			}
+		default:
+		}
+
 		shardIterator = recordSet.NextShardIterator
 
 		// Should only call getRecords on kinesis 5 times per second per shard
 		// This is here to throttle incase we are pulling too fast
 		//time.Sleep(time.Millisecond * 200)
 	}
+}
+
+// recordMetadata wraps the records of a GetRecords page, unpacking aggregated records into
+// their user records when the Pipeline Deaggregates.
+func (p Pipeline) recordMetadata(records []kinesis.GetRecordsRecords, shardID string) []*Record {
+	metadata := make([]*Record, 0, len(records))
+	for _, v := range records {
+		m := &Record{
+			Data:                        v.GetData(),
+			PartitionKey:                v.PartitionKey,
+			SequenceNumber:              v.SequenceNumber,
+			ApproximateArrivalTimestamp: kinesisArrivalTime(v.ApproximateArrivalTimestamp),
+			ShardID:                     shardID,
+			StreamName:                  p.StreamName,
+		}
 
+		userRecords, ok := deaggregateRecord(m.Data)
+		if !p.Deaggregate || !ok {
+			metadata = append(metadata, m)
+			continue
+		}
+		for i, u := range userRecords {
+			um := *m
+			um.Data, um.PartitionKey, um.SubSequenceNumber = u.Data, u.PartitionKey, int64(i)
+			metadata = append(metadata, &um)
+		}
+	}
+	return metadata
+}
+
+// shardOwners maps the Buffer and Checkpoint of every pipeline being processed to its shard.
+var shardOwners = struct {
+	sync.Mutex
+	m map[interface{}]string
+}{m: map[interface{}]string{}}
+
+// shardStateKey returns the identity of a Buffer or Checkpoint, or nil for values that are not
+// pointers and so cannot be shared. Adapters are keyed by the value they wrap.
+func shardStateKey(v interface{}) interface{} {
+	if w, ok := v.(interface{ unwrap() interface{} }); ok {
+		v = w.unwrap()
+	}
+	if v == nil || reflect.ValueOf(v).Kind() != reflect.Ptr {
+		return nil
+	}
+	return v
+}
+
+// claimShardState marks values as used by shardID, failing if another pipeline uses one.
+func claimShardState(shardID string, values ...interface{}) error {
+	shardOwners.Lock()
+	defer shardOwners.Unlock()
+
+	for _, v := range values {
+		if k := shardStateKey(v); k != nil {
+			if owner, ok := shardOwners.m[k]; ok {
+				return fmt.Errorf("%T is already used by shard %s, each shard needs its own", v, owner)
+			}
+		}
+	}
+	for _, v := range values {
+		if k := shardStateKey(v); k != nil {
+			shardOwners.m[k] = shardID
+		}
+	}
 	return nil
 }
 
+func releaseShardState(values ...interface{}) {
+	shardOwners.Lock()
+	defer shardOwners.Unlock()
+
+	for _, v := range values {
+		if k := shardStateKey(v); k != nil {
+			delete(shardOwners.m, k)
+		}
+	}
+}
+
 func (p Pipeline) flushBuffer(shardID string) error {
 	//we lost ownership. stop working.
 	if p.LeaseCoordinator != nil && p.LeaseCoordinator.GetCurrentlyHeldLease(shardID) == nil {
+		if p.Dedup != nil {
+			p.Dedup.Release(shardID)
+		}
 		return errors.New("LostOwnership")
 	}
 
 	if p.Buffer.NumRecordsInBuffer() > 0 {
 		err := p.Emitter.Emit(p.Buffer, p.Transformer, shardID)
 		if err != nil {
+			// the buffer will be read again, so its records must not be taken as duplicates
+			if p.Dedup != nil {
+				p.Dedup.Release(shardID)
+			}
 			return err
 		}
 	}
+	if p.Dedup != nil {
+		// the buffer was delivered, so checkpoint it even if the ids only made it into memory
+		if err := p.Dedup.Commit(shardID); err != nil {
+			l4g.Warn("could not store delivered dedup ids on shard [%v], keeping them in memory: %v", shardID, err)
+		}
+	}
 	p.Checkpoint.SetCheckpoint(shardID, p.Buffer.LastSequenceNumber(), p.Buffer.LastApproximateArrivalTime())
 	p.Buffer.Flush()
 
 	return nil
 }
+
+// flushEmitter flushes the Emitter if it is a ShardFlusher. Unless final, it stops when the
+// lease has been lost, leaving the final flush to the caller.
+func (p Pipeline) flushEmitter(shardID string, final bool) error {
+	f, ok := p.Emitter.(ShardFlusher)
+	if !ok {
+		return nil
+	}
+	if !final && p.LeaseCoordinator != nil && p.LeaseCoordinator.GetCurrentlyHeldLease(shardID) == nil {
+		return errors.New("LostOwnership")
+	}
+	return f.FlushShard(shardID, final)
+}
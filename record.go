@@ -0,0 +1,95 @@
+package connector
+
+import (
+	"math"
+	"time"
+)
+
+// Record is a Kinesis record as read from a shard, with the metadata Kinesis and the Pipeline
+// know about it.
+type Record struct {
+	Data           []byte
+	PartitionKey   string
+	SequenceNumber string
+
+	// SubSequenceNumber is the index of a user record within the KPL aggregated record it was
+	// unpacked from, which shares its SequenceNumber. It is 0 for records that were not
+	// aggregated or when the Pipeline does not Deaggregate.
+	SubSequenceNumber int64
+
+	ApproximateArrivalTimestamp time.Time
+	ShardID                     string
+	StreamName                  string
+}
+
+// arrivalTime returns the int the Buffer keeps for the record's arrival, in Unix seconds.
+func (r *Record) arrivalTime() int {
+	return int(r.ApproximateArrivalTimestamp.Unix())
+}
+
+// kinesisArrivalTime converts an ApproximateArrivalTimestamp in fractional Unix seconds.
+func kinesisArrivalTime(ts float64) time.Time {
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// RecordTransformer is a Transformer that is also given a record's metadata, e.g. to stamp the
+// partition key or arrival time into columns of the model. The Pipeline calls
+// ToRecordWithMetadata instead of ToRecord when its Transformer implements it.
+type RecordTransformer interface {
+	Transformer
+	ToRecordWithMetadata(r *Record) interface{}
+}
+
+// DecodingTransformer is a Transformer that reports records it cannot decode. The Pipeline calls
+// DecodeRecord instead of ToRecord or ToRecordWithMetadata when its Transformer implements it,
+// and drops records failing to decode the way it drops filtered ones.
+type DecodingTransformer interface {
+	Transformer
+	DecodeRecord(r *Record) (interface{}, error)
+}
+
+// toRecord transforms the data of r with t, passing it r if t takes its metadata.
+func toRecord(t Transformer, r *Record) (interface{}, error) {
+	if dt, ok := t.(DecodingTransformer); ok {
+		return dt.DecodeRecord(r)
+	}
+	if rt, ok := t.(RecordTransformer); ok {
+		return rt.ToRecordWithMetadata(r), nil
+	}
+	return t.ToRecord(r.Data), nil
+}
+
+// RecordFilter is a Filter that is also given a record's metadata. The Pipeline calls
+// KeepRecordWithMetadata instead of KeepRecord when its Filter implements it.
+type RecordFilter interface {
+	Filter
+	KeepRecordWithMetadata(record interface{}, r *Record) bool
+}
+
+// MetadataBuffer is a Buffer keeping the metadata of its records, for emitters to read with
+// BufferMetadata. The Pipeline calls ProcessRecordWithMetadata instead of ProcessRecord when its
+// Buffer implements it. RecordBuffer is a MetadataBuffer.
+type MetadataBuffer interface {
+	Buffer
+	ProcessRecordWithMetadata(record interface{}, r *Record)
+	Metadata() []*Record
+}
+
+// BufferMetadata returns the metadata of the records of a Buffer or TypedBuffer, in the order
+// of its Records, or nil if the buffer does not keep metadata. Entries are nil for records
+// buffered without it.
+func BufferMetadata(b interface{}) []*Record {
+	if mb, ok := b.(interface{ Metadata() []*Record }); ok {
+		return mb.Metadata()
+	}
+	return nil
+}
+
+// keepRecord applies f to record, passing it r if f is a RecordFilter.
+func keepRecord(f Filter, record interface{}, r *Record) bool {
+	if rf, ok := f.(RecordFilter); ok && r != nil {
+		return rf.KeepRecordWithMetadata(record, r)
+	}
+	return f.KeepRecord(record)
+}
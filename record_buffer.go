@@ -1,10 +1,17 @@
 package connector
 
-import "time"
+import (
+	"time"
+
+	l4g "github.com/ezoic/log4go"
+)
 
 // RecordBuffer is a basic implementation of the Buffer interface.
 // It buffer's records and answers questions on when it should be periodically flushed.
-type RecordBuffer struct {
+type RecordBuffer = TypedRecordBuffer[interface{}]
+
+// TypedRecordBuffer is RecordBuffer holding records of type T. It implements TypedBuffer[T].
+type TypedRecordBuffer[T any] struct {
 	NumRecordsToBuffer         int
 	MaxTimeBetweenFlush        time.Duration
 	lastApproximateArrivalTime int
@@ -12,58 +19,119 @@ type RecordBuffer struct {
 	lastFlush           time.Time
 	firstSequenceNumber string
 	lastSequenceNumber  string
-	recordsInBuffer     []interface{}
+	recordsInBuffer     []T
+	metadataInBuffer    []*Record
 	sequencesInBuffer   SequenceList
+
+	// acceptedSequenceNumber is the last sequence number accepted since the flush, and
+	// lastSubSequenceNumber the last of its user records when it was an aggregated record.
+	acceptedSequenceNumber string
+	lastSubSequenceNumber  int64
 }
 
-// ProcessRecord adds a message to the buffer.
-func (b *RecordBuffer) ProcessRecord(record interface{}, sequenceNumber string, approximateArrivalTime int) {
+// ProcessRecord adds a message to the buffer. A nil record only advances the sequence number.
+func (b *TypedRecordBuffer[T]) ProcessRecord(record T, sequenceNumber string, approximateArrivalTime int) {
+	if b.processSequence(sequenceNumber, approximateArrivalTime) && any(record) != nil {
+		b.recordsInBuffer = append(b.recordsInBuffer, record)
+		b.metadataInBuffer = append(b.metadataInBuffer, nil)
+	}
+}
+
+// ProcessRecordWithMetadata adds a message to the buffer as ProcessRecord, keeping its metadata.
+// The user records of a deaggregated record share its sequence number and are told apart by
+// their SubSequenceNumber, which must increase.
+func (b *TypedRecordBuffer[T]) ProcessRecordWithMetadata(record T, r *Record) {
+	if !b.processSubSequence(r) {
+		if !b.processSequence(r.SequenceNumber, r.arrivalTime()) {
+			return
+		}
+		b.lastSubSequenceNumber = r.SubSequenceNumber
+	}
+	if any(record) != nil {
+		b.recordsInBuffer = append(b.recordsInBuffer, record)
+		b.metadataInBuffer = append(b.metadataInBuffer, r)
+	}
+}
+
+// processSubSequence reports whether r is a later user record of the aggregated record accepted
+// last, recording it if so.
+func (b *TypedRecordBuffer[T]) processSubSequence(r *Record) bool {
+	if r.SubSequenceNumber <= b.lastSubSequenceNumber || r.SequenceNumber != b.acceptedSequenceNumber {
+		return false
+	}
+	b.lastSubSequenceNumber = r.SubSequenceNumber
+	return true
+}
+
+// SkipRecord advances the sequence number past a record that is not buffered.
+func (b *TypedRecordBuffer[T]) SkipRecord(sequenceNumber string, approximateArrivalTime int) {
+	b.processSequence(sequenceNumber, approximateArrivalTime)
+}
+
+// processSequence records sequenceNumber, returning false if it was already processed.
+func (b *TypedRecordBuffer[T]) processSequence(sequenceNumber string, approximateArrivalTime int) bool {
 	if b.lastFlush.IsZero() {
 		b.lastFlush = time.Now()
 	}
 
-	if len(b.sequencesInBuffer) == 0 {
+	if b.sequencesInBuffer.Len() == 0 {
 		b.firstSequenceNumber = sequenceNumber
 	}
 
 	b.lastSequenceNumber = sequenceNumber
 	b.lastApproximateArrivalTime = approximateArrivalTime
 
-	if !b.sequenceExists(sequenceNumber) {
-		if record != nil {
-			b.recordsInBuffer = append(b.recordsInBuffer, record)
-		}
-		b.sequencesInBuffer = b.sequencesInBuffer.Append(sequenceNumber)
+	// the other user records of the aggregated record accepted last, e.g. skipped ones, leave
+	// the ones after them acceptable
+	if sequenceNumber == b.acceptedSequenceNumber {
+		return false
+	}
+
+	outOfOrder := b.sequencesInBuffer.OutOfOrder()
+	if !b.sequencesInBuffer.Append(sequenceNumber) {
+		return false
 	}
+	b.acceptedSequenceNumber = sequenceNumber
+	b.lastSubSequenceNumber = 0
+	if b.sequencesInBuffer.OutOfOrder() > outOfOrder {
+		l4g.Warn("sequence number %s arrived out of order", sequenceNumber)
+	}
+	return true
 }
 
 // Records returns the records in the buffer.
-func (b *RecordBuffer) Records() []interface{} {
+func (b *TypedRecordBuffer[T]) Records() []T {
 	return b.recordsInBuffer
 }
 
+// Metadata returns the metadata of the records in the buffer, nil for records added with
+// ProcessRecord.
+func (b *TypedRecordBuffer[T]) Metadata() []*Record {
+	return b.metadataInBuffer
+}
+
 // NumRecordsInBuffer returns the number of messages in the buffer.
-func (b RecordBuffer) NumRecordsInBuffer() int {
+func (b TypedRecordBuffer[T]) NumRecordsInBuffer() int {
 	return len(b.recordsInBuffer)
 }
 
 // Flush empties the buffer and resets the sequence counter.
-func (b *RecordBuffer) Flush() {
+func (b *TypedRecordBuffer[T]) Flush() {
 	b.lastFlush = time.Now()
 	b.recordsInBuffer = b.recordsInBuffer[:0]
-	b.sequencesInBuffer = b.sequencesInBuffer[:0]
+	b.metadataInBuffer = b.metadataInBuffer[:0]
+	b.sequencesInBuffer.Reset()
+	b.acceptedSequenceNumber = ""
+	b.lastSubSequenceNumber = 0
 }
 
 // Checks if the sequence already exists in the buffer.
-func (b *RecordBuffer) sequenceExists(sequenceNumber string) bool {
-	if b.sequencesInBuffer == nil {
-		b.sequencesInBuffer = make(SequenceList, 0)
-	}
+func (b *TypedRecordBuffer[T]) sequenceExists(sequenceNumber string) bool {
 	return b.sequencesInBuffer.SequenceExists(sequenceNumber)
 }
 
 // ShouldFlush determines if the buffer has reached its target size.
-func (b *RecordBuffer) ShouldFlush() bool {
+func (b *TypedRecordBuffer[T]) ShouldFlush() bool {
 	if len(b.recordsInBuffer) >= b.NumRecordsToBuffer {
 		return true
 	}
@@ -75,15 +143,21 @@ func (b *RecordBuffer) ShouldFlush() bool {
 }
 
 // FirstSequenceNumber returns the sequence number of the first message in the buffer.
-func (b *RecordBuffer) FirstSequenceNumber() string {
+func (b *TypedRecordBuffer[T]) FirstSequenceNumber() string {
 	return b.firstSequenceNumber
 }
 
+// SequenceRanges returns the ranges of sequence numbers processed since the last flush.
+// More than one range means records arrived out of order.
+func (b *TypedRecordBuffer[T]) SequenceRanges() []SequenceRange {
+	return b.sequencesInBuffer.Ranges()
+}
+
 // LastSequenceNumber returns the sequence number of the last message in the buffer.
-func (b *RecordBuffer) LastSequenceNumber() string {
+func (b *TypedRecordBuffer[T]) LastSequenceNumber() string {
 	return b.lastSequenceNumber
 }
 
-func (b *RecordBuffer) LastApproximateArrivalTime() int {
+func (b *TypedRecordBuffer[T]) LastApproximateArrivalTime() int {
 	return b.lastApproximateArrivalTime
 }
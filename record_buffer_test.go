@@ -1,6 +1,7 @@
 package connector
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
@@ -39,6 +40,37 @@ func TestProcessRecord(t *testing.T) {
 	}
 }
 
+func TestProcessRecordSubSequences(t *testing.T) {
+	b := RecordBuffer{}
+	process := []struct {
+		record string
+		seq    string
+		sub    int64
+	}{
+		{"a0", "1", 0},
+		{"a1", "1", 1},
+		{"", "1", 2}, // skipped user record
+		{"a3", "1", 3},
+		{"a1 again", "1", 1},
+		{"b1", "2", 1}, // first user record filtered out
+		{"b2", "2", 2},
+		{"a0 replayed", "1", 0},
+		{"a1 replayed", "1", 1},
+	}
+	for _, p := range process {
+		if p.record == "" {
+			b.ProcessRecord(nil, p.seq, 0)
+			continue
+		}
+		b.ProcessRecordWithMetadata(p.record, &Record{SequenceNumber: p.seq, SubSequenceNumber: p.sub})
+	}
+
+	want := []interface{}{"a0", "a1", "a3", "b1", "b2"}
+	if !reflect.DeepEqual(b.Records(), want) {
+		t.Errorf("Records() = %v want %v", b.Records(), want)
+	}
+}
+
 func TestSequenceExists(t *testing.T) {
 	var r1, s1 = TestRecord{}, "1"
 	var r2, s2 = TestRecord{}, "2"
@@ -57,6 +89,25 @@ func TestSequenceExists(t *testing.T) {
 	}
 }
 
+func TestSequenceRanges(t *testing.T) {
+	b := RecordBuffer{}
+	for _, s := range []string{"3", "4", "1", "4"} {
+		b.ProcessRecord(TestRecord{}, s, int(time.Now().Unix()))
+	}
+
+	if b.NumRecordsInBuffer() != 3 {
+		t.Errorf("NumRecordsInBuffer() = %v want %v", b.NumRecordsInBuffer(), 3)
+	}
+	if got := len(b.SequenceRanges()); got != 2 {
+		t.Errorf("len(SequenceRanges()) = %v want %v", got, 2)
+	}
+
+	b.Flush()
+	if got := len(b.SequenceRanges()); got != 0 {
+		t.Errorf("len(SequenceRanges()) after Flush() = %v want %v", got, 0)
+	}
+}
+
 func TestFlush(t *testing.T) {
 	var r1, s1 = TestRecord{}, "1"
 	b := RecordBuffer{}
@@ -0,0 +1,110 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_kinesisArrivalTime(t *testing.T) {
+	got := kinesisArrivalTime(1500000000.25)
+	if want := time.Unix(1500000000, 250000000); !got.Equal(want) {
+		t.Errorf("kinesisArrivalTime() = %v want %v", got, want)
+	}
+	if r := (&Record{ApproximateArrivalTimestamp: got}); r.arrivalTime() != 1500000000 {
+		t.Errorf("arrivalTime() = %v want %v", r.arrivalTime(), 1500000000)
+	}
+}
+
+func Test_BufferMetadata(t *testing.T) {
+	m1 := &Record{SequenceNumber: "1", PartitionKey: "a", ApproximateArrivalTimestamp: time.Unix(100, 0)}
+	m3 := &Record{SequenceNumber: "3", PartitionKey: "b", ApproximateArrivalTimestamp: time.Unix(300, 0)}
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	var mb MetadataBuffer = b
+	mb.ProcessRecordWithMetadata("one", m1)
+	b.ProcessRecord("two", "2", 200)
+	b.ProcessRecord(nil, "2.5", 250)
+	mb.ProcessRecordWithMetadata("three", m3)
+	mb.ProcessRecordWithMetadata("three again", m3)
+
+	if want := []interface{}{"one", "two", "three"}; !reflect.DeepEqual(b.Records(), want) {
+		t.Errorf("Records() = %v want %v", b.Records(), want)
+	}
+	if want := []*Record{m1, nil, m3}; !reflect.DeepEqual(BufferMetadata(b), want) {
+		t.Errorf("BufferMetadata() = %v want %v", BufferMetadata(b), want)
+	}
+	if b.LastSequenceNumber() != "3" || b.LastApproximateArrivalTime() != 300 {
+		t.Errorf("last sequence = %v at %v want 3 at 300", b.LastSequenceNumber(), b.LastApproximateArrivalTime())
+	}
+
+	b.Flush()
+	if got := BufferMetadata(b); len(got) != 0 {
+		t.Errorf("BufferMetadata() after Flush() = %v", got)
+	}
+	if got := BufferMetadata(&routeBuffer{}); got != nil {
+		t.Errorf("BufferMetadata() of an empty route = %v want nil", got)
+	}
+}
+
+func Test_keepRecordWithMetadata(t *testing.T) {
+	byKey := RecordFilterFunc(func(record interface{}, r *Record) bool {
+		return r != nil && r.PartitionKey == "a"
+	})
+	short := FilterFunc(func(record interface{}) bool {
+		return len(record.(string)) < 5
+	})
+
+	cases := []struct {
+		filter Filter
+		record string
+		key    string
+		want   bool
+	}{
+		{byKey, "x", "a", true},
+		{byKey, "x", "b", false},
+		{And(byKey, short), "x", "a", true},
+		{And(byKey, short), "xxxxxx", "a", false},
+		{Or(byKey, short), "xxxxxx", "a", true},
+		{Or(byKey, short), "xxxxxx", "b", false},
+		{Not(byKey), "x", "b", true},
+	}
+	for i, c := range cases {
+		if got := keepRecord(c.filter, c.record, &Record{PartitionKey: c.key}); got != c.want {
+			t.Errorf("case %d: keepRecord(%v, %v) = %v want %v", i, c.record, c.key, got, c.want)
+		}
+	}
+
+	if got := keepRecord(byKey, "x", nil); got != false {
+		t.Errorf("keepRecord() without metadata = %v want %v", got, false)
+	}
+}
+
+// stampingTransformer copies the partition key into the record.
+type stampingTransformer struct {
+	JSONTransformer[typedClick]
+}
+
+func (t stampingTransformer) ToRecordWithMetadata(r *Record) typedClick {
+	c := t.ToRecord(r.Data)
+	c.Page = r.PartitionKey
+	return c
+}
+
+func Test_TypedRecordMetadata(t *testing.T) {
+	b := &TypedRecordBuffer[typedClick]{NumRecordsToBuffer: 10}
+	p := TypedPipeline[typedClick]{Buffer: b, Transformer: stampingTransformer{}}.Pipeline()
+
+	m := &Record{Data: []byte(`{"user":"a"}`), PartitionKey: "/home", SequenceNumber: "1"}
+	r := p.Transformer.(RecordTransformer).ToRecordWithMetadata(m)
+	if keepRecord(p.Filter, r, m) {
+		p.Buffer.(MetadataBuffer).ProcessRecordWithMetadata(r, m)
+	}
+
+	if want := []typedClick{{User: "a", Page: "/home"}}; !reflect.DeepEqual(b.Records(), want) {
+		t.Errorf("Records() = %v want %v", b.Records(), want)
+	}
+	if got := BufferMetadata(p.Buffer); len(got) != 1 || got[0] != m {
+		t.Errorf("BufferMetadata() = %v want [%v]", got, m)
+	}
+}
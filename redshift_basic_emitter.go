@@ -1,10 +1,9 @@
 package connector
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
-	"os"
 
 	// Postgres package is used when sql.Open is called
 	l4g "github.com/ezoic/log4go"
@@ -22,20 +21,62 @@ type RedshiftBasicEmtitter struct {
 	S3Prefix  string
 	TableName string
 	Db        *sql.DB
+
+	// LoadCheckpoint enables idempotent loads. When set, a row for the shard and TableName is
+	// written in the same transaction as the COPY, and a buffer whose last sequence number
+	// is not past the stored row is skipped as already loaded. Emitters loading different
+	// tables may share it; two emitters loading the same table from one shard must not.
+	LoadCheckpoint *RedshiftCheckpoint
+
+	// Upsert, when set, replaces rows matching the configured keys instead of appending.
+	Upsert *RedshiftUpsert
+
+	// Credentials authorizes the COPY. Defaults to RedshiftEnvCredentials.
+	Credentials RedshiftCredentials
+
+	// CopyOptions configures the COPY. Format, Jsonpaths and Delimiter above are used for
+	// whichever of its format fields are unset.
+	CopyOptions CopyOptions
+
+	// LoadErrorView is where rejected rows are looked up when a COPY fails, StlLoadErrors
+	// (the default) or SysLoadErrorDetail.
+	LoadErrorView string
+	// QuarantinePrefix, when set, makes a COPY that fails on bad rows non-fatal. The buffer
+	// is written under this prefix in S3Bucket for inspection and the emit succeeds.
+	QuarantinePrefix string
 }
 
 // Emit is invoked when the buffer is full. This method leverages the S3Emitter and
 // then issues a copy command to Redshift data store.
 func (e RedshiftBasicEmtitter) Emit(b Buffer, t Transformer, shardID string) error {
+	if c := e.loadCheckpoint(); c != nil {
+		loaded, _, err := c.read(e.Db, shardID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			if CompareSequenceNumbers(b.LastSequenceNumber(), loaded) <= 0 {
+				l4g.Info("buffer [%v-%v] already loaded into redshift table [%v] for shard [%v], skipping", b.FirstSequenceNumber(), b.LastSequenceNumber(), e.TableName, shardID)
+				return nil
+			}
+			if b, err = unloadedBuffer(b, loaded); err != nil {
+				return err
+			}
+		}
+	}
+
 	s3Emitter := S3Emitter{S3Prefix: e.S3Prefix, S3Bucket: e.S3Bucket}
-	s3err := s3Emitter.Emit(b, t, shardID)
+	s3File, _, s3err := s3Emitter.put(b, t, shardID)
 	if s3err != nil {
 		return s3err
 	}
-	s3File := s3Emitter.S3FileName(b.FirstSequenceNumber(), b.LastSequenceNumber())
 
-	stmt := e.copyStatement(s3File)
+	copyTable := e.TableName
+	if e.Upsert != nil {
+		copyTable = e.Upsert.stageTable(e.TableName)
+	}
 
+	var skipped bool
 	var err error
 	for i := 0; i < 10; i++ {
 
@@ -43,20 +84,12 @@ func (e RedshiftBasicEmtitter) Emit(b Buffer, t Transformer, shardID string) err
 		// s3 file has not appeared to the database yet
 		HandleAwsWaitTimeExp(i, "redshift emitter on shard "+shardID)
 
-		var tx *sql.Tx
-		tx, err = e.Db.Begin()
+		// build the statement on every attempt so that temporary credentials that expired
+		// during the backoff are fetched again
+		var stmt string
+		stmt, err = e.copyStatementInto(copyTable, s3File)
 		if err == nil {
-
-			// load into the database
-			_, err = tx.Exec(stmt)
-			l4g.Fine("error:%v", err)
-			if err != nil {
-				l4g.Warn("rolling back transaction for insert with file %v, %v on shard [%v]", s3File, err, shardID)
-				tx.Rollback()
-			} else {
-				err = tx.Commit()
-			}
-
+			skipped, err = e.attempt(stmt, b, s3File, shardID)
 		}
 
 		// if the request succeeded, or its an unrecoverable error, break out of the loop
@@ -71,6 +104,15 @@ func (e RedshiftBasicEmtitter) Emit(b Buffer, t Transformer, shardID string) err
 
 	}
 
+	if skipped {
+		l4g.Info("[%v] already loaded into redshift table [%v] for shard [%v], skipping", s3File, e.TableName, shardID)
+		return nil
+	}
+
+	if lerr, ok := err.(*LoadError); ok && e.QuarantinePrefix != "" {
+		return e.quarantine(b, t, shardID, lerr)
+	}
+
 	if err != nil {
 		return err
 	}
@@ -79,22 +121,165 @@ func (e RedshiftBasicEmtitter) Emit(b Buffer, t Transformer, shardID string) err
 	return nil
 }
 
+// attempt runs one load transaction on a dedicated connection, so that a failed COPY can be
+// looked up in the load error view from the same session.
+func (e RedshiftBasicEmtitter) attempt(stmt string, b Buffer, s3File string, shardID string) (bool, error) {
+	ctx := context.Background()
+	conn, err := e.Db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	// load into the database
+	skipped, err := e.load(tx, stmt, b, s3File, shardID)
+	l4g.Fine("error:%v", err)
+	if err != nil {
+		l4g.Warn("rolling back transaction for insert with file %v, %v on shard [%v]", s3File, err, shardID)
+		tx.Rollback()
+		if lerr := redshiftLoadErrors(conn, e.LoadErrorView, err); lerr != nil {
+			return false, lerr
+		}
+		return false, err
+	}
+	if skipped {
+		tx.Rollback()
+		return true, nil
+	}
+	return false, tx.Commit()
+}
+
+// quarantine keeps the rejected buffer in S3 under QuarantinePrefix and lets the pipeline
+// move past it.
+func (e RedshiftBasicEmtitter) quarantine(b Buffer, t Transformer, shardID string, lerr *LoadError) error {
+	s3Emitter := S3Emitter{S3Prefix: e.QuarantinePrefix, S3Bucket: e.S3Bucket}
+	s3File, _, err := s3Emitter.put(b, t, shardID)
+	if err != nil {
+		return err
+	}
+	l4g.Error("quarantined [%v] records for redshift table [%v] to [s3://%v/%v] on shard [%v]: %v", b.NumRecordsInBuffer(), e.TableName, e.S3Bucket, s3File, shardID, lerr)
+	return nil
+}
+
+// load issues the COPY inside tx. With a LoadCheckpoint it first checks whether the buffer's
+// range was already loaded, reporting skipped if so, and records the new checkpoint before
+// the caller commits.
+func (e RedshiftBasicEmtitter) load(tx *sql.Tx, stmt string, b Buffer, s3File string, shardID string) (bool, error) {
+	c := e.loadCheckpoint()
+	if c == nil {
+		return false, e.copy(tx, stmt)
+	}
+
+	if err := c.lock(tx); err != nil {
+		return false, err
+	}
+
+	loaded, _, err := c.read(tx, shardID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	if err == nil && CompareSequenceNumbers(b.LastSequenceNumber(), loaded) <= 0 {
+		return true, nil
+	}
+	if err == nil && CompareSequenceNumbers(b.FirstSequenceNumber(), loaded) <= 0 {
+		// Emit trimmed the loaded records, so another process loaded part of this buffer since
+		// and it cannot be loaded without duplicating rows
+		return false, fmt.Errorf("buffer [%v-%v] overlaps checkpoint %v loaded concurrently on shard [%v]", b.FirstSequenceNumber(), b.LastSequenceNumber(), loaded, shardID)
+	}
+
+	if err = e.copy(tx, stmt); err != nil {
+		return false, err
+	}
+
+	return false, c.write(tx, shardID, b.LastSequenceNumber(), b.LastApproximateArrivalTime(), false, s3File)
+}
+
+// loadCheckpoint returns the LoadCheckpoint keyed by TableName, or nil without one.
+func (e RedshiftBasicEmtitter) loadCheckpoint() *RedshiftCheckpoint {
+	if e.LoadCheckpoint == nil {
+		return nil
+	}
+	return e.LoadCheckpoint.forTarget(e.TableName)
+}
+
+// unloadedBuffer returns the records of b after the loaded sequence number, when b straddles
+// it, e.g. after a restart replayed from a pipeline checkpoint that lagged the load checkpoint
+// with different buffer boundaries. It needs the buffer's record metadata to tell the records
+// apart, and fails without it rather than load records twice.
+func unloadedBuffer(b Buffer, loaded string) (Buffer, error) {
+	if CompareSequenceNumbers(b.FirstSequenceNumber(), loaded) > 0 {
+		return b, nil
+	}
+
+	records := b.Records()
+	metadata := BufferMetadata(b)
+	if len(metadata) != len(records) {
+		return nil, fmt.Errorf("buffer [%v-%v] overlaps loaded checkpoint %v and has no record metadata to skip the loaded records", b.FirstSequenceNumber(), b.LastSequenceNumber(), loaded)
+	}
+
+	rb := &routeBuffer{Buffer: b}
+	for i, m := range metadata {
+		if m == nil {
+			return nil, fmt.Errorf("buffer [%v-%v] overlaps loaded checkpoint %v and record %d has no metadata", b.FirstSequenceNumber(), b.LastSequenceNumber(), loaded, i)
+		}
+		if CompareSequenceNumbers(m.SequenceNumber, loaded) > 0 {
+			rb.records = append(rb.records, records[i])
+			rb.metadata = append(rb.metadata, m)
+		}
+	}
+	l4g.Warn("buffer [%v-%v] overlaps loaded checkpoint %v, skipping [%v] loaded records", b.FirstSequenceNumber(), b.LastSequenceNumber(), loaded, len(records)-len(rb.records))
+	return &unloadedRouteBuffer{rb}, nil
+}
+
+// unloadedRouteBuffer starts after the loaded checkpoint, so the file it is written to and the
+// overlap check in load see only the records not yet loaded.
+type unloadedRouteBuffer struct {
+	*routeBuffer
+}
+
+// FirstSequenceNumber returns the first sequence number after the loaded checkpoint.
+func (b *unloadedRouteBuffer) FirstSequenceNumber() string {
+	if len(b.metadata) > 0 {
+		return b.metadata[0].SequenceNumber
+	}
+	return b.routeBuffer.LastSequenceNumber()
+}
+
+// copy runs the COPY statement, through the staging table when upserting.
+func (e RedshiftBasicEmtitter) copy(tx *sql.Tx, stmt string) error {
+	if e.Upsert != nil {
+		return e.Upsert.exec(tx, e.TableName, stmt)
+	}
+	_, err := tx.Exec(stmt)
+	return err
+}
+
 // Creates the SQL copy statement issued to Redshift cluster.
-func (e RedshiftBasicEmtitter) copyStatement(s3File string) string {
-	b := new(bytes.Buffer)
-	b.WriteString(fmt.Sprintf("COPY %v ", e.TableName))
-	b.WriteString(fmt.Sprintf("FROM 's3://%v/%v' ", e.S3Bucket, s3File))
-	b.WriteString(fmt.Sprintf("CREDENTIALS 'aws_access_key_id=%v;", os.Getenv("AWS_ACCESS_KEY")))
-	b.WriteString(fmt.Sprintf("aws_secret_access_key=%v' ", os.Getenv("AWS_SECRET_KEY")))
-	switch e.Format {
-	case "json":
-		b.WriteString(fmt.Sprintf("json 'auto'"))
-	case "jsonpaths":
-		b.WriteString(fmt.Sprintf("json '%v'", e.Jsonpaths))
-	default:
-		b.WriteString(fmt.Sprintf("DELIMITER '%v'", e.Delimiter))
-	}
-	b.WriteString(";")
-	l4g.Debug(b.String())
-	return b.String()
+func (e RedshiftBasicEmtitter) copyStatement(s3File string) (string, error) {
+	return e.copyStatementInto(e.TableName, s3File)
+}
+
+// copyStatementInto creates the SQL copy statement loading s3File into table.
+func (e RedshiftBasicEmtitter) copyStatementInto(table string, s3File string) (string, error) {
+	creds := e.Credentials
+	if creds == nil {
+		creds = RedshiftEnvCredentials{}
+	}
+	c, err := creds.CopyCredentials()
+	if err != nil {
+		return "", err
+	}
+
+	o := e.CopyOptions.withLegacy(e.Format, e.Jsonpaths, e.Delimiter)
+	stmt, err := redshiftCopyStatement(table, fmt.Sprintf("s3://%v/%v", e.S3Bucket, s3File), c, o)
+	if err != nil {
+		return "", err
+	}
+	l4g.Debug(redactCredentials(stmt))
+	return stmt, nil
 }
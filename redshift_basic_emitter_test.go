@@ -17,9 +17,12 @@ func TestCopyStatement(t *testing.T) {
 		S3Prefix:  "test_prefix",
 		TableName: "test_table",
 	}
-	f := e.copyStatement("test_prefix/test.txt")
+	f, err := e.copyStatement("test_prefix/test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	copyStatement := fmt.Sprintf("COPY test_table FROM 's3://test_bucket/test_prefix/test.txt' CREDENTIALS 'aws_access_key_id=%v;aws_secret_access_key=%v' DELIMITER ',';", os.Getenv("AWS_ACCESS_KEY"), os.Getenv("AWS_SECRET_KEY"))
+	copyStatement := fmt.Sprintf("COPY \"test_table\" FROM 's3://test_bucket/test_prefix/test.txt' CREDENTIALS 'aws_access_key_id=%v;aws_secret_access_key=%v' DELIMITER ',';", os.Getenv("AWS_ACCESS_KEY"), os.Getenv("AWS_SECRET_KEY"))
 
 	if f != copyStatement {
 		t.Errorf("copyStatement() = %s want %s", f, copyStatement)
@@ -81,3 +84,37 @@ func Test_WriteValidDataToTable(t *testing.T) {
 	}
 
 }
+
+func Test_unloadedBuffer(t *testing.T) {
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	for i := 1; i <= 4; i++ {
+		b.ProcessRecordWithMetadata(fmt.Sprint("r", i), &Record{SequenceNumber: fmt.Sprint(i)})
+	}
+
+	cases := []struct {
+		loaded  string
+		records []interface{}
+		first   string
+	}{
+		{"0", []interface{}{"r1", "r2", "r3", "r4"}, "1"},
+		{"2", []interface{}{"r3", "r4"}, "3"},
+		{"3", []interface{}{"r4"}, "4"},
+	}
+	for _, c := range cases {
+		u, err := unloadedBuffer(b, c.loaded)
+		if err != nil {
+			t.Fatalf("unloadedBuffer(%v) returned %s", c.loaded, err)
+		}
+		if fmt.Sprint(u.Records()) != fmt.Sprint(c.records) || u.FirstSequenceNumber() != c.first || u.LastSequenceNumber() != "4" {
+			t.Errorf("unloadedBuffer(%v) = %v from %v to %v want %v from %v to 4", c.loaded, u.Records(), u.FirstSequenceNumber(), u.LastSequenceNumber(), c.records, c.first)
+		}
+	}
+
+	// without metadata the loaded records cannot be told apart
+	plain := &RecordBuffer{NumRecordsToBuffer: 10}
+	plain.ProcessRecord("r1", "1", 0)
+	plain.ProcessRecord("r2", "2", 0)
+	if _, err := unloadedBuffer(plain, "1"); err == nil {
+		t.Errorf("unloadedBuffer() without metadata returned no error")
+	}
+}
@@ -0,0 +1,118 @@
+package connector
+
+import (
+	"time"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// defaultBatchSize is the number of queued files loaded together when BatchSize is not set.
+const defaultBatchSize = 10
+
+// RedshiftBatchEmitter is an implementation of Emitter that does the work of S3ManifestEmitter and
+// RedshiftManifestEmitter in one process, without a manifest stream between them.
+//
+// Each buffer is uploaded to S3 and its path is pushed onto a durable ManifestQueue. Once the
+// shard's queue holds BatchSize files, or its oldest file has waited MaxBatchAge, the queued files
+// are loaded with a single manifest COPY through Loader and removed from the queue. It is a
+// ShardFlusher: the Pipeline enforces MaxBatchAge on shards that receive no records, and loads
+// whatever is queued when the shard is closed or its lease is lost. Files are removed from the
+// queue after their load commits; files found in the Loader's FileTable are not loaded again, so
+// a load repeated because the removal failed loads nothing.
+//
+// The buffers are checkpointed once queued, so a queue must be readable by whichever process
+// next reads the shard. A FileManifestQueue is only safe when the shard never moves to another
+// host: if the final load fails after the lease is lost, its files are never loaded.
+type RedshiftBatchEmitter struct {
+	S3Bucket string
+	S3Prefix string
+	Queue    ManifestQueue
+
+	// BatchSize is the number of queued files that triggers a load, 10 when zero.
+	BatchSize int
+
+	// MaxBatchAge is how long the oldest queued file waits before a load. Zero leaves files
+	// queued until BatchSize is reached or the shard stops.
+	MaxBatchAge time.Duration
+
+	// Loader configures the manifest COPY. Its S3Bucket defaults to S3Bucket above.
+	Loader RedshiftManifestEmitter
+}
+
+// Emit uploads the buffer to S3, queues the file and loads the shard's queue if it is due.
+func (e RedshiftBatchEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	// refuse to queue files that could never be loaded
+	if err := e.Loader.checkDb(); err != nil {
+		return err
+	}
+
+	s3Emitter := S3Emitter{S3Prefix: e.S3Prefix, S3Bucket: e.S3Bucket}
+	s3File, _, err := s3Emitter.put(b, t, shardID)
+	if err != nil {
+		return err
+	}
+
+	if err = e.Queue.Push(shardID, s3File); err != nil {
+		return err
+	}
+
+	return e.flush(shardID, false)
+}
+
+// Flush loads everything queued for the shard regardless of BatchSize and MaxBatchAge.
+func (e RedshiftBatchEmitter) Flush(shardID string) error {
+	return e.flush(shardID, true)
+}
+
+// FlushInterval has the Pipeline check the shard's queue twice every MaxBatchAge, so that
+// files of a quiet shard wait at most one and a half times MaxBatchAge.
+func (e RedshiftBatchEmitter) FlushInterval() time.Duration {
+	return e.MaxBatchAge / 2
+}
+
+// FlushShard loads the shard's queue if it is due, or regardless when final.
+func (e RedshiftBatchEmitter) FlushShard(shardID string, final bool) error {
+	return e.flush(shardID, final)
+}
+
+func (e RedshiftBatchEmitter) flush(shardID string, force bool) error {
+	pending, err := e.Queue.Pending(shardID)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 || (!force && !e.due(pending, time.Now())) {
+		return nil
+	}
+
+	files := make([]string, len(pending))
+	for i, f := range pending {
+		files[i] = f.Path
+	}
+
+	loader := e.Loader
+	if loader.S3Bucket == "" {
+		loader.S3Bucket = e.S3Bucket
+	}
+
+	if err = loader.copyFiles(files, shardID); err != nil {
+		return err
+	}
+
+	if err = e.Queue.Remove(shardID, files); err != nil {
+		l4g.Error("loaded [%v] files but could not remove them from the queue on shard [%v]: %v", len(files), shardID, err)
+		return err
+	}
+	return nil
+}
+
+// due reports whether the queued files should be loaded now.
+func (e RedshiftBatchEmitter) due(pending []QueuedFile, now time.Time) bool {
+	batchSize := e.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultBatchSize
+	}
+	if len(pending) >= batchSize {
+		return true
+	}
+	return e.MaxBatchAge > 0 && now.Sub(pending[0].QueuedAt) >= e.MaxBatchAge
+}
@@ -0,0 +1,80 @@
+package connector
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBatchEmitterDue(t *testing.T) {
+	now := time.Now()
+	e := RedshiftBatchEmitter{BatchSize: 3, MaxBatchAge: time.Minute}
+
+	testCases := []struct {
+		pending []QueuedFile
+		due     bool
+	}{
+		{pending: []QueuedFile{{Path: "a", QueuedAt: now}}, due: false},
+		{pending: []QueuedFile{{Path: "a", QueuedAt: now}, {Path: "b", QueuedAt: now}, {Path: "c", QueuedAt: now}}, due: true},
+		{pending: []QueuedFile{{Path: "a", QueuedAt: now.Add(-2 * time.Minute)}}, due: true},
+	}
+
+	for idx, tc := range testCases {
+		if r := e.due(tc.pending, now); r != tc.due {
+			t.Errorf("test case %d: due() = %v want %v", idx, r, tc.due)
+		}
+	}
+
+	e.MaxBatchAge = 0
+	if e.due([]QueuedFile{{Path: "a", QueuedAt: now.Add(-time.Hour)}}, now) {
+		t.Errorf("due() = true without a MaxBatchAge")
+	}
+
+	e.BatchSize = 0
+	pending := make([]QueuedFile, defaultBatchSize-1)
+	if e.due(pending, now) {
+		t.Errorf("due() = true for %d files without a BatchSize want false", len(pending))
+	}
+	if pending = append(pending, QueuedFile{}); !e.due(pending, now) {
+		t.Errorf("due() = false for %d files without a BatchSize want true", len(pending))
+	}
+}
+
+func TestBatchEmitterSkipsEmptyQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifestqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := RedshiftBatchEmitter{Queue: &FileManifestQueue{Dir: dir}, BatchSize: 1}
+
+	// nothing queued, so no load is attempted and the zero Loader is never used
+	if err := e.Flush("shard"); err != nil {
+		t.Errorf("Flush() on an empty queue returned %s", err)
+	}
+}
+
+func TestBatchEmitterWithoutDb(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifestqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := RedshiftBatchEmitter{Queue: &FileManifestQueue{Dir: dir}, BatchSize: 1}
+
+	// nothing is uploaded or queued
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	b.ProcessRecord("a", "1", 0)
+	if err := e.Emit(b, StringToStringTransformer{}, "shard"); err == nil {
+		t.Errorf("Emit() without a Loader Db returned no error")
+	}
+	if err := e.Queue.Push("shard", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Flush("shard"); err == nil {
+		t.Errorf("Flush() without a Loader Db returned no error")
+	}
+}
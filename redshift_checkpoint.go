@@ -0,0 +1,193 @@
+package connector
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// RedshiftCheckpoint implements the Checkpoint interface on a Redshift table.
+//
+// The same table doubles as the load control table for RedshiftBasicEmtitter: when the emitter's
+// LoadCheckpoint is set, the COPY and the checkpoint row are written in one transaction, so a
+// crash between loading and checkpointing can no longer load the same records twice. The emitter
+// keeps a row per shard and target table, apart from the Pipeline's row, so emitters loading
+// different tables, e.g. the routes of a RoutingEmitter, can share one RedshiftCheckpoint. Using
+// the RedshiftCheckpoint as the Pipeline's Checkpoint as well keeps all of the shard state in
+// Redshift.
+type RedshiftCheckpoint struct {
+	AppName    string
+	StreamName string
+	TableName  string
+	Db         *sql.DB
+
+	sequenceNumber string
+	isClosed       bool
+
+	// target is the table whose loads the rows track, or empty for the Pipeline's rows.
+	target string
+}
+
+// forTarget returns a RedshiftCheckpoint on the same table whose rows track loads into target.
+func (c *RedshiftCheckpoint) forTarget(target string) *RedshiftCheckpoint {
+	return &RedshiftCheckpoint{AppName: c.AppName, StreamName: c.StreamName, TableName: c.TableName, Db: c.Db, target: target}
+}
+
+// EnsureSchema creates the checkpoint table if it does not exist.
+func (c *RedshiftCheckpoint) EnsureSchema() error {
+	_, err := c.Db.Exec("CREATE TABLE IF NOT EXISTS " + quoteRedshiftIdentifier(c.TableName) + " (" +
+		"checkpoint_key VARCHAR(255) NOT NULL, " +
+		"sequence_number VARCHAR(128) NOT NULL, " +
+		"last_arrival_time BIGINT NOT NULL DEFAULT 0, " +
+		"is_closed BOOLEAN NOT NULL DEFAULT FALSE, " +
+		"s3_file VARCHAR(1024), " +
+		"last_updated TIMESTAMP NOT NULL, " +
+		"PRIMARY KEY (checkpoint_key))")
+	return err
+}
+
+// CheckpointExists determines if a checkpoint for a particular Shard exists.
+// Typically used to determine whether we should start processing the shard with
+// TRIM_HORIZON or AFTER_SEQUENCE_NUMBER (if checkpoint exists).
+func (c *RedshiftCheckpoint) CheckpointExists(shardID string) bool {
+	seq, isClosed, err := c.read(c.Db, shardID)
+	if err == nil {
+		c.sequenceNumber = seq
+		c.isClosed = isClosed
+		return true
+	}
+
+	if err == sql.ErrNoRows {
+		c.isClosed = false
+		return false
+	}
+
+	// something bad happened, better blow up the process
+	panic(err)
+}
+
+// CheckpointIsClosed reports whether the shard was marked closed by the last CheckpointExists call.
+func (c *RedshiftCheckpoint) CheckpointIsClosed(shardID string) bool {
+	return c.isClosed
+}
+
+// SequenceNumber returns the current checkpoint stored for the specified shard.
+func (c *RedshiftCheckpoint) SequenceNumber() string {
+	return c.sequenceNumber
+}
+
+// SetClosed marks the shard as closed, keeping the rest of the stored row, e.g. the last loaded
+// file.
+func (c *RedshiftCheckpoint) SetClosed(shardID string, isClosed bool) {
+	err := c.update(shardID, func(tx *sql.Tx) error {
+		row, err := c.readRow(tx, shardID)
+		if err == sql.ErrNoRows {
+			row.sequenceNumber = c.sequenceNumber
+		} else if err != nil {
+			return err
+		}
+		return c.write(tx, shardID, row.sequenceNumber, row.approximateArrivalTime, isClosed, row.s3File)
+	})
+	if err != nil {
+		panic(err)
+	}
+	c.isClosed = isClosed
+}
+
+// SetCheckpoint stores a checkpoint for a shard (e.g. sequence number of last record processed by application).
+// Upon failover, record processing is resumed from this point.
+func (c *RedshiftCheckpoint) SetCheckpoint(shardID string, sequenceNumber string, approximateArrivalTime int) {
+	err := c.update(shardID, func(tx *sql.Tx) error {
+		return c.write(tx, shardID, sequenceNumber, approximateArrivalTime, false, "")
+	})
+	if err != nil {
+		panic(err)
+	}
+	c.sequenceNumber = sequenceNumber
+}
+
+// update runs fn in its own transaction, retrying recoverable errors the same way
+// MysqlCheckpoint.SetCheckpoint does.
+func (c *RedshiftCheckpoint) update(shardID string, fn func(tx *sql.Tx) error) error {
+	const maxAttempts = 5
+	var err error
+	for i := 0; ; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(rand.Intn(30)+5) * time.Second)
+		}
+
+		var tx *sql.Tx
+		tx, err = c.Db.Begin()
+		if err == nil {
+			if err = fn(tx); err != nil {
+				tx.Rollback()
+			} else {
+				err = tx.Commit()
+			}
+		}
+
+		if err == nil || IsRecoverableError(err) == false || i >= maxAttempts {
+			return err
+		}
+		l4g.Warn("recoverable error setting checkpoint for %s: %s", c.key(shardID), err.Error())
+	}
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// read returns the stored sequence number for the shard, or sql.ErrNoRows.
+func (c *RedshiftCheckpoint) read(q queryRower, shardID string) (string, bool, error) {
+	var seq string
+	var isClosed bool
+	err := q.QueryRow("SELECT sequence_number, is_closed FROM "+quoteRedshiftIdentifier(c.TableName)+" WHERE checkpoint_key = $1", c.key(shardID)).Scan(&seq, &isClosed)
+	return seq, isClosed, err
+}
+
+// redshiftCheckpointRow is a stored checkpoint row.
+type redshiftCheckpointRow struct {
+	sequenceNumber         string
+	approximateArrivalTime int
+	s3File                 string
+}
+
+// readRow returns the stored row for the shard, or sql.ErrNoRows.
+func (c *RedshiftCheckpoint) readRow(q queryRower, shardID string) (redshiftCheckpointRow, error) {
+	var row redshiftCheckpointRow
+	var s3File sql.NullString
+	err := q.QueryRow("SELECT sequence_number, last_arrival_time, s3_file FROM "+quoteRedshiftIdentifier(c.TableName)+" WHERE checkpoint_key = $1", c.key(shardID)).Scan(&row.sequenceNumber, &row.approximateArrivalTime, &s3File)
+	row.s3File = s3File.String
+	return row, err
+}
+
+// write replaces the checkpoint row inside tx. Redshift has no upsert, so the row is
+// deleted and re-inserted; the caller's transaction keeps that atomic.
+func (c *RedshiftCheckpoint) write(tx *sql.Tx, shardID string, sequenceNumber string, approximateArrivalTime int, isClosed bool, s3File string) error {
+	_, err := tx.Exec("DELETE FROM "+quoteRedshiftIdentifier(c.TableName)+" WHERE checkpoint_key = $1", c.key(shardID))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO "+quoteRedshiftIdentifier(c.TableName)+" (checkpoint_key, sequence_number, last_arrival_time, is_closed, s3_file, last_updated) VALUES ($1, $2, $3, $4, $5, $6)",
+		c.key(shardID), sequenceNumber, approximateArrivalTime, isClosed, s3File, time.Now().UTC())
+	return err
+}
+
+// lock takes an exclusive lock on the checkpoint table for the rest of tx, so two
+// processes that both believe they own a shard cannot load the same range concurrently.
+func (c *RedshiftCheckpoint) lock(tx *sql.Tx) error {
+	_, err := tx.Exec("LOCK " + quoteRedshiftIdentifier(c.TableName))
+	return err
+}
+
+// key generates a unique key for storage of Checkpoint.
+func (c *RedshiftCheckpoint) key(shardID string) string {
+	if c.target != "" {
+		return fmt.Sprintf("%v:load:%v:%v:%v", c.AppName, c.StreamName, shardID, c.target)
+	}
+	return fmt.Sprintf("%v:checkpoint:%v:%v", c.AppName, c.StreamName, shardID)
+}
@@ -0,0 +1,102 @@
+package connector
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/stdlib"
+)
+
+func Test_RedshiftCheckpointKey(t *testing.T) {
+	k := "app:checkpoint:stream:shard"
+	c := RedshiftCheckpoint{AppName: "app", StreamName: "stream"}
+
+	r := c.key("shard")
+
+	if r != k {
+		t.Errorf("key() = %v, want %v", r, k)
+	}
+
+	k = "app:load:stream:shard:test.events"
+	if r = c.forTarget("test.events").key("shard"); r != k {
+		t.Errorf("forTarget().key() = %v, want %v", r, k)
+	}
+}
+
+func Test_RedshiftCheckpoint(t *testing.T) {
+	db, err := sql.Open("pgx", os.Getenv("REDSHIFT_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := RedshiftCheckpoint{AppName: "app", StreamName: "stream", TableName: "test.testcheckpoint", Db: db}
+	if err = c.EnsureSchema(); err != nil {
+		t.Fatalf("EnsureSchema() returned %s", err)
+	}
+	db.Exec("DELETE FROM test.testcheckpoint WHERE checkpoint_key = $1", c.key("shard"))
+
+	if c.CheckpointExists("shard") {
+		t.Fatal("CheckpointExists() = true before any checkpoint was set")
+	}
+
+	c.SetCheckpoint("shard", "fakeSeqNum", int(time.Now().Unix()))
+	if !c.CheckpointExists("shard") || c.SequenceNumber() != "fakeSeqNum" {
+		t.Errorf("SequenceNumber() = %v, want %v", c.SequenceNumber(), "fakeSeqNum")
+	}
+	if c.CheckpointIsClosed("shard") {
+		t.Errorf("CheckpointIsClosed() = true, want false")
+	}
+
+	c.SetClosed("shard", true)
+	if !c.CheckpointExists("shard") || !c.CheckpointIsClosed("shard") || c.SequenceNumber() != "fakeSeqNum" {
+		t.Errorf("SetClosed() did not keep the sequence number or mark the shard closed")
+	}
+
+	db.Exec("DELETE FROM test.testcheckpoint WHERE checkpoint_key = $1", c.key("shard"))
+}
+
+func Test_IdempotentLoadSkipsLoadedRange(t *testing.T) {
+	db, err := sql.Open("pgx", os.Getenv("REDSHIFT_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &RedshiftCheckpoint{AppName: "app", StreamName: "stream", TableName: "test.testcheckpoint", Db: db}
+	if err = c.EnsureSchema(); err != nil {
+		t.Fatalf("EnsureSchema() returned %s", err)
+	}
+	db.Exec("DELETE FROM test.testcheckpoint WHERE checkpoint_key = $1", c.forTarget("test.testtable").key("shardId-000000000003"))
+	db.Exec("DELETE FROM test.testtable WHERE id = 4321")
+
+	emitter := RedshiftBasicEmtitter{
+		TableName:      "test.testtable",
+		Format:         "json",
+		S3Bucket:       os.Getenv("REDSHIFT_S3_BUCKET"),
+		S3Prefix:       os.Getenv("REDSHIFT_S3_PREFIX"),
+		Db:             db,
+		LoadCheckpoint: c,
+	}
+	transformer := StringToStringTransformer{}
+
+	// emitting the same range twice simulates a crash after the COPY but before the pipeline checkpoint
+	for i := 0; i < 2; i++ {
+		buffer := &RecordBuffer{NumRecordsToBuffer: 1}
+		buffer.ProcessRecord("{\"id\":4321,\"value\":\"idempotent\"}", "22222222222222", int(time.Now().Unix()))
+		if err = emitter.Emit(buffer, transformer, "shardId-000000000003"); err != nil {
+			t.Fatalf("Emit() run %d returned %s", i, err)
+		}
+	}
+
+	var n int
+	if err = db.QueryRow("SELECT COUNT(*) FROM test.testtable WHERE id = 4321").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("loaded %v rows, want 1", n)
+	}
+
+	db.Exec("DELETE FROM test.testcheckpoint WHERE checkpoint_key = $1", c.forTarget("test.testtable").key("shardId-000000000003"))
+	db.Exec("DELETE FROM test.testtable WHERE id = 4321")
+}
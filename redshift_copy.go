@@ -0,0 +1,177 @@
+package connector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CopyFormat is the input format of a Redshift COPY.
+type CopyFormat string
+
+// Supported COPY input formats. CopyDelimited is the zero value.
+const (
+	CopyDelimited CopyFormat = ""
+	CopyJSON      CopyFormat = "json"
+	CopyJSONPaths CopyFormat = "jsonpaths"
+	CopyCSV       CopyFormat = "csv"
+)
+
+// CopyCompression is the compression of the files being loaded.
+type CopyCompression string
+
+// Supported COPY compression codecs. CopyUncompressed is the zero value.
+const (
+	CopyUncompressed CopyCompression = ""
+	CopyGzip         CopyCompression = "GZIP"
+	CopyLzop         CopyCompression = "LZOP"
+	CopyBzip2        CopyCompression = "BZIP2"
+	CopyZstd         CopyCompression = "ZSTD"
+)
+
+// CopyOptions are the data format and load parameters of a Redshift COPY. Zero values
+// leave the corresponding option out of the statement, so Redshift's default applies.
+type CopyOptions struct {
+	Format    CopyFormat
+	JSONPaths string // location of the jsonpaths file for CopyJSONPaths
+	Delimiter string // field delimiter for CopyDelimited and CopyCSV
+	CSVQuote  string // quote character for CopyCSV
+
+	// Columns limits and orders the target columns the input fields are loaded into.
+	Columns []string
+
+	Compression     CopyCompression
+	Region          string // region of the S3 bucket, when it differs from the cluster's
+	IgnoreHeader    int
+	TimeFormat      string
+	DateFormat      string
+	TruncateColumns bool
+	BlanksAsNull    bool
+	EmptyAsNull     bool
+	AcceptInvChars  bool
+	// AcceptInvCharsWith replaces invalid UTF-8 characters when AcceptInvChars is set.
+	AcceptInvCharsWith string
+
+	// CompUpdate and StatUpdate turn automatic compression analysis and statistics on or
+	// off. Nil leaves Redshift's default.
+	CompUpdate *bool
+	StatUpdate *bool
+
+	MaxError int
+	Manifest bool
+}
+
+// redshiftCopyStatement renders a COPY of from into table. credentials is the already
+// rendered authorization clause.
+func redshiftCopyStatement(table string, from string, credentials string, o CopyOptions) (string, error) {
+	q := new(redshiftSQL)
+	q.Raw("COPY ").Ident(table)
+	if len(o.Columns) > 0 {
+		q.Raw(" (")
+		for i, c := range o.Columns {
+			if i > 0 {
+				q.Raw(", ")
+			}
+			q.Ident(c)
+		}
+		q.Raw(")")
+	}
+	q.Raw(" FROM ").Literal(from)
+	q.Raw(" " + credentials)
+
+	if o.Region != "" {
+		q.Raw(" REGION ").Literal(o.Region)
+	}
+
+	switch o.Format {
+	case CopyJSON:
+		q.Raw(" json 'auto'")
+	case CopyJSONPaths:
+		q.Raw(" json ").Literal(o.JSONPaths)
+	case CopyCSV:
+		q.Raw(" CSV")
+		if o.CSVQuote != "" {
+			q.Raw(" QUOTE AS ").Literal(o.CSVQuote)
+		}
+		if o.Delimiter != "" {
+			q.Raw(" DELIMITER ").Literal(o.Delimiter)
+		}
+	case CopyDelimited:
+		q.Raw(" DELIMITER ").Literal(o.Delimiter)
+	default:
+		return "", fmt.Errorf("unknown redshift copy format %q", o.Format)
+	}
+
+	switch o.Compression {
+	case CopyUncompressed:
+	case CopyGzip, CopyLzop, CopyBzip2, CopyZstd:
+		q.Raw(" " + string(o.Compression))
+	default:
+		return "", fmt.Errorf("unknown redshift copy compression %q", o.Compression)
+	}
+
+	if o.IgnoreHeader > 0 {
+		q.Raw(fmt.Sprintf(" IGNOREHEADER %d", o.IgnoreHeader))
+	}
+	if o.TimeFormat != "" {
+		q.Raw(" TIMEFORMAT ").Literal(o.TimeFormat)
+	}
+	if o.DateFormat != "" {
+		q.Raw(" DATEFORMAT ").Literal(o.DateFormat)
+	}
+	if o.TruncateColumns {
+		q.Raw(" TRUNCATECOLUMNS")
+	}
+	if o.BlanksAsNull {
+		q.Raw(" BLANKSASNULL")
+	}
+	if o.EmptyAsNull {
+		q.Raw(" EMPTYASNULL")
+	}
+	if o.AcceptInvChars {
+		q.Raw(" ACCEPTINVCHARS")
+		if o.AcceptInvCharsWith != "" {
+			q.Raw(" AS ").Literal(o.AcceptInvCharsWith)
+		}
+	}
+	if o.CompUpdate != nil {
+		q.Raw(" COMPUPDATE " + onOff(*o.CompUpdate))
+	}
+	if o.StatUpdate != nil {
+		q.Raw(" STATUPDATE " + onOff(*o.StatUpdate))
+	}
+	if o.MaxError > 0 {
+		q.Raw(fmt.Sprintf(" MAXERROR %d", o.MaxError))
+	}
+	if o.Manifest {
+		q.Raw(" MANIFEST")
+	}
+	q.Raw(";")
+
+	return q.String(), nil
+}
+
+// withLegacy fills options still unset from the emitters' original Format, Jsonpaths and
+// Delimiter fields, so existing configurations render the same statement as before.
+func (o CopyOptions) withLegacy(format string, jsonpaths string, delimiter string) CopyOptions {
+	if o.Format == CopyDelimited {
+		// anything unrecognised always meant a delimited load
+		switch f := CopyFormat(strings.ToLower(format)); f {
+		case CopyJSON, CopyJSONPaths:
+			o.Format = f
+		}
+	}
+	if o.JSONPaths == "" {
+		o.JSONPaths = jsonpaths
+	}
+	if o.Delimiter == "" {
+		o.Delimiter = delimiter
+	}
+	return o
+}
+
+func onOff(b bool) string {
+	if b {
+		return "ON"
+	}
+	return "OFF"
+}
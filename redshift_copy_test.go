@@ -0,0 +1,117 @@
+package connector
+
+import (
+	"testing"
+)
+
+func TestRedshiftCopyStatement(t *testing.T) {
+	on, off := true, false
+
+	testCases := []struct {
+		options  CopyOptions
+		expected string
+	}{
+		{
+			options:  CopyOptions{Delimiter: "|"},
+			expected: `COPY "t" FROM 's3://b/f' IAM_ROLE 'r' DELIMITER '|';`,
+		},
+		{
+			options:  CopyOptions{Format: CopyJSON},
+			expected: `COPY "t" FROM 's3://b/f' IAM_ROLE 'r' json 'auto';`,
+		},
+		{
+			options:  CopyOptions{Format: CopyJSONPaths, JSONPaths: "s3://b/paths.json"},
+			expected: `COPY "t" FROM 's3://b/f' IAM_ROLE 'r' json 's3://b/paths.json';`,
+		},
+		{
+			options:  CopyOptions{Format: CopyCSV, CSVQuote: "'", IgnoreHeader: 1},
+			expected: `COPY "t" FROM 's3://b/f' IAM_ROLE 'r' CSV QUOTE AS '''' IGNOREHEADER 1;`,
+		},
+		{
+			options: CopyOptions{
+				Format:             CopyCSV,
+				Delimiter:          ";",
+				Columns:            []string{"id", "value"},
+				Compression:        CopyGzip,
+				Region:             "us-west-2",
+				TimeFormat:         "auto",
+				DateFormat:         "YYYY-MM-DD",
+				TruncateColumns:    true,
+				BlanksAsNull:       true,
+				EmptyAsNull:        true,
+				AcceptInvChars:     true,
+				AcceptInvCharsWith: "?",
+				CompUpdate:         &off,
+				StatUpdate:         &on,
+				MaxError:           5,
+				Manifest:           true,
+			},
+			expected: `COPY "t" ("id", "value") FROM 's3://b/f' IAM_ROLE 'r' REGION 'us-west-2' CSV DELIMITER ';' GZIP TIMEFORMAT 'auto' DATEFORMAT 'YYYY-MM-DD' TRUNCATECOLUMNS BLANKSASNULL EMPTYASNULL ACCEPTINVCHARS AS '?' COMPUPDATE OFF STATUPDATE ON MAXERROR 5 MANIFEST;`,
+		},
+	}
+
+	for idx, tc := range testCases {
+		result, err := redshiftCopyStatement("t", "s3://b/f", "IAM_ROLE 'r'", tc.options)
+		if err != nil {
+			t.Errorf("test case %d: redshiftCopyStatement() returned %s", idx, err)
+		}
+		if result != tc.expected {
+			t.Errorf("test case %d: redshiftCopyStatement() = %v want %v", idx, result, tc.expected)
+		}
+	}
+}
+
+func TestRedshiftCopyStatementInvalid(t *testing.T) {
+	if _, err := redshiftCopyStatement("t", "s3://b/f", "", CopyOptions{Format: "parquet"}); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+	if _, err := redshiftCopyStatement("t", "s3://b/f", "", CopyOptions{Compression: "snappy"}); err == nil {
+		t.Errorf("expected an error for an unknown compression")
+	}
+}
+
+func TestCopyOptionsWithLegacy(t *testing.T) {
+	testCases := []struct {
+		options  CopyOptions
+		format   string
+		expected CopyFormat
+	}{
+		{options: CopyOptions{}, format: "json", expected: CopyJSON},
+		{options: CopyOptions{}, format: "jsonpaths", expected: CopyJSONPaths},
+		{options: CopyOptions{}, format: "tsv", expected: CopyDelimited},
+		{options: CopyOptions{Format: CopyCSV}, format: "json", expected: CopyCSV},
+	}
+
+	for idx, tc := range testCases {
+		o := tc.options.withLegacy(tc.format, "paths", ",")
+		if o.Format != tc.expected {
+			t.Errorf("test case %d: Format = %v want %v", idx, o.Format, tc.expected)
+		}
+		if o.JSONPaths != "paths" || o.Delimiter != "," {
+			t.Errorf("test case %d: legacy fields not applied: %+v", idx, o)
+		}
+	}
+}
+
+func TestEmittersShareCopyOptions(t *testing.T) {
+	o := CopyOptions{Format: CopyCSV, Compression: CopyGzip}
+	creds := RedshiftIAMRole{Arn: "r"}
+
+	b := RedshiftBasicEmtitter{S3Bucket: "b", TableName: "t", CopyOptions: o, Credentials: creds}
+	basic, err := b.copyStatement("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if basic != `COPY "t" FROM 's3://b/f' IAM_ROLE 'r' CSV GZIP;` {
+		t.Errorf("copyStatement() = %v", basic)
+	}
+
+	m := RedshiftManifestEmitter{S3Bucket: "b", DataTable: "t", CopyOptions: o, Credentials: creds}
+	manifest, err := m.copyStmt("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest != `COPY "t" FROM 's3://b/f' IAM_ROLE 'r' CSV GZIP MANIFEST;` {
+		t.Errorf("copyStmt() = %v", manifest)
+	}
+}
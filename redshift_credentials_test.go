@@ -0,0 +1,87 @@
+package connector
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCopyCredentials(t *testing.T) {
+	testCases := []struct {
+		creds    RedshiftCredentials
+		expected string
+	}{
+		{creds: RedshiftIAMRole{Arn: "arn:aws:iam::123456789012:role/loader"}, expected: "IAM_ROLE 'arn:aws:iam::123456789012:role/loader'"},
+		{creds: RedshiftKeyCredentials{AccessKey: "AK", SecretKey: "SK"}, expected: "CREDENTIALS 'aws_access_key_id=AK;aws_secret_access_key=SK'"},
+		{creds: RedshiftKeyCredentials{AccessKey: "AK", SecretKey: "SK", SessionToken: "TK"}, expected: "CREDENTIALS 'aws_access_key_id=AK;aws_secret_access_key=SK;token=TK'"},
+		{creds: RedshiftCredentialsFunc(func() (string, string, string, error) { return "AK", "SK", "TK", nil }), expected: "CREDENTIALS 'aws_access_key_id=AK;aws_secret_access_key=SK;token=TK'"},
+	}
+
+	for idx, tc := range testCases {
+		result, err := tc.creds.CopyCredentials()
+		if err != nil {
+			t.Errorf("test case %d: CopyCredentials() returned %s", idx, err)
+		}
+		if result != tc.expected {
+			t.Errorf("test case %d: CopyCredentials() = %v want %v", idx, result, tc.expected)
+		}
+	}
+
+	_, err := RedshiftCredentialsFunc(func() (string, string, string, error) { return "", "", "", fmt.Errorf("expired") }).CopyCredentials()
+	if err == nil {
+		t.Errorf("expected provider error to be returned")
+	}
+	_, err = RedshiftIAMRole{}.CopyCredentials()
+	if err == nil {
+		t.Errorf("expected error for an empty role arn")
+	}
+}
+
+func TestRedactCredentials(t *testing.T) {
+	testCases := []struct {
+		stmt     string
+		expected string
+	}{
+		{
+			stmt:     "COPY t FROM 's3://b/f' CREDENTIALS 'aws_access_key_id=AK;aws_secret_access_key=SK;token=TK' json 'auto';",
+			expected: "COPY t FROM 's3://b/f' CREDENTIALS 'aws_access_key_id=***;aws_secret_access_key=***;token=***' json 'auto';",
+		},
+		{
+			stmt:     "COPY t FROM 's3://b/f' ACCESS_KEY_ID 'AK' SECRET_ACCESS_KEY 'SK' SESSION_TOKEN 'TK' json 'auto';",
+			expected: "COPY t FROM 's3://b/f' ACCESS_KEY_ID '***' SECRET_ACCESS_KEY '***' SESSION_TOKEN '***' json 'auto';",
+		},
+		{
+			stmt:     "COPY t FROM 's3://b/f' IAM_ROLE 'arn:aws:iam::123456789012:role/loader' json 'auto';",
+			expected: "COPY t FROM 's3://b/f' IAM_ROLE 'arn:aws:iam::123456789012:role/loader' json 'auto';",
+		},
+	}
+
+	for idx, tc := range testCases {
+		result := redactCredentials(tc.stmt)
+		if result != tc.expected {
+			t.Errorf("test case %d: redactCredentials() = %v want %v", idx, result, tc.expected)
+		}
+	}
+}
+
+func TestManifestEmitterCredentials(t *testing.T) {
+	e := RedshiftManifestEmitter{DataTable: "t", S3Bucket: "b", Format: "json", AccessKey: "AK", SecretKey: "SK"}
+
+	expected := "COPY \"t\" FROM 's3://b/m' CREDENTIALS 'aws_access_key_id=AK;aws_secret_access_key=SK' json 'auto' MANIFEST;"
+	result, err := e.copyStmt("m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != expected {
+		t.Errorf("copyStmt() = %v want %v", result, expected)
+	}
+
+	e.Credentials = RedshiftIAMRole{Arn: "arn:aws:iam::123456789012:role/loader"}
+	expected = "COPY \"t\" FROM 's3://b/m' IAM_ROLE 'arn:aws:iam::123456789012:role/loader' json 'auto' MANIFEST;"
+	result, err = e.copyStmt("m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != expected {
+		t.Errorf("copyStmt() = %v want %v", result, expected)
+	}
+}
@@ -0,0 +1,88 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// Views Redshift records COPY load errors in. Provisioned clusters have both;
+// Redshift Serverless only has sys_load_error_detail.
+const (
+	StlLoadErrors      = "stl_load_errors"
+	SysLoadErrorDetail = "sys_load_error_detail"
+)
+
+// maxLoadErrorRows bounds how many rows of a failed COPY are fetched.
+const maxLoadErrorRows = 100
+
+// LoadErrorRow is one rejected input row of a failed COPY.
+type LoadErrorRow struct {
+	File   string
+	Line   int64
+	Column string
+	Value  string
+	Code   int
+	Reason string
+}
+
+// LoadError is returned when a COPY fails because of bad input rows. It wraps the database
+// error and lists the rows Redshift rejected.
+type LoadError struct {
+	QueryID int64
+	Rows    []LoadErrorRow
+	Err     error
+}
+
+func (e *LoadError) Error() string {
+	b := new(bytes.Buffer)
+	b.WriteString(fmt.Sprintf("redshift COPY query %d rejected %d rows: %v", e.QueryID, len(e.Rows), e.Err))
+	for _, r := range e.Rows {
+		b.WriteString(fmt.Sprintf("; %s line %d column %s value %q: %s (%d)", r.File, r.Line, r.Column, r.Value, r.Reason, r.Code))
+	}
+	return b.String()
+}
+
+// redshiftLoadErrors looks up the rows rejected by the last COPY run on conn. It returns nil
+// when the session ran no COPY or the COPY failed for a reason other than bad input.
+func redshiftLoadErrors(conn *sql.Conn, view string, cause error) *LoadError {
+	ctx := context.Background()
+
+	var queryID int64
+	err := conn.QueryRowContext(ctx, "SELECT pg_last_copy_id()").Scan(&queryID)
+	if err != nil || queryID <= 0 {
+		return nil
+	}
+
+	var stmt string
+	switch view {
+	case SysLoadErrorDetail:
+		stmt = "SELECT TRIM(file_name), line_number, TRIM(column_name), '', error_code, TRIM(error_message) FROM sys_load_error_detail WHERE query_id = $1 ORDER BY line_number LIMIT $2"
+	default:
+		stmt = "SELECT TRIM(filename), line_number, TRIM(colname), TRIM(raw_field_value), err_code, TRIM(err_reason) FROM stl_load_errors WHERE query = $1 ORDER BY line_number LIMIT $2"
+	}
+
+	rows, err := conn.QueryContext(ctx, stmt, queryID, maxLoadErrorRows)
+	if err != nil {
+		l4g.Warn("cannot read %s for query %d: %v", view, queryID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	lerr := &LoadError{QueryID: queryID, Err: cause}
+	for rows.Next() {
+		var r LoadErrorRow
+		if err = rows.Scan(&r.File, &r.Line, &r.Column, &r.Value, &r.Code, &r.Reason); err != nil {
+			l4g.Warn("cannot scan %s for query %d: %v", view, queryID, err)
+			return nil
+		}
+		lerr.Rows = append(lerr.Rows, r)
+	}
+	if len(lerr.Rows) == 0 {
+		return nil
+	}
+	return lerr
+}
@@ -0,0 +1,79 @@
+package connector
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/stdlib"
+)
+
+func TestLoadErrorMessage(t *testing.T) {
+	e := &LoadError{
+		QueryID: 42,
+		Err:     fmt.Errorf("Load into table 'testtable' failed"),
+		Rows: []LoadErrorRow{
+			{File: "s3://bucket/file", Line: 3, Column: "id", Value: "abc", Code: 1207, Reason: "Invalid digit"},
+		},
+	}
+
+	expected := "redshift COPY query 42 rejected 1 rows: Load into table 'testtable' failed; s3://bucket/file line 3 column id value \"abc\": Invalid digit (1207)"
+	if e.Error() != expected {
+		t.Errorf("Error() = %v want %v", e.Error(), expected)
+	}
+}
+
+func TestCopyStatementMaxError(t *testing.T) {
+	e := RedshiftBasicEmtitter{
+		Format:      "json",
+		S3Bucket:    "bucket",
+		TableName:   "t",
+		CopyOptions: CopyOptions{MaxError: 10},
+		Credentials: RedshiftIAMRole{Arn: "arn"},
+	}
+	f, err := e.copyStatement("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(f, "json 'auto' MAXERROR 10;") {
+		t.Errorf("copyStatement() = %s, want MAXERROR 10", f)
+	}
+}
+
+func Test_WriteInvalidDataReturnsLoadError(t *testing.T) {
+	db, err := sql.Open("pgx", os.Getenv("REDSHIFT_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emitter := RedshiftBasicEmtitter{
+		TableName: "test.testtable",
+		Format:    "json",
+		S3Bucket:  os.Getenv("REDSHIFT_S3_BUCKET"),
+		S3Prefix:  os.Getenv("REDSHIFT_S3_PREFIX"),
+		Db:        db,
+	}
+	transformer := StringToStringTransformer{}
+	buffer := &RecordBuffer{NumRecordsToBuffer: 1}
+	buffer.ProcessRecord("{\"id\":\"notanumber\",\"value\":\"danisawesome\"}", "11111111111111", int(time.Now().Unix()))
+
+	err = emitter.Emit(buffer, transformer, "shardId-000000000002")
+	lerr, ok := err.(*LoadError)
+	if !ok {
+		t.Fatalf("expected a *LoadError, got %#v", err)
+	}
+	if len(lerr.Rows) == 0 || lerr.Rows[0].Column != "id" {
+		t.Errorf("expected the id column to be reported, got %+v", lerr.Rows)
+	}
+
+	// with a quarantine prefix the same buffer is set aside and the emit succeeds
+	emitter.QuarantinePrefix = os.Getenv("REDSHIFT_S3_PREFIX") + "/quarantine"
+	err = emitter.Emit(buffer, transformer, "shardId-000000000002")
+	if err != nil {
+		t.Fatalf("expected quarantined emit to succeed, got %s", err)
+	}
+}
@@ -1,11 +1,9 @@
 package connector
 
 import (
-	"bytes"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
@@ -27,17 +25,23 @@ type RedshiftManifestEmitter struct {
 	Jsonpaths     string
 	S3Bucket      string
 	SecretKey     string
+	Db            *sql.DB
+
+	// Upsert, when set, replaces rows matching the configured keys instead of appending.
+	Upsert *RedshiftUpsert
+
+	// CopyOptions configures the COPY. Format, Jsonpaths and Delimiter above are used for
+	// whichever of its format fields are unset. MANIFEST is always added.
+	CopyOptions CopyOptions
+
+	// Credentials authorizes the COPY. When nil, AccessKey and SecretKey are used if set,
+	// otherwise RedshiftEnvCredentials.
+	Credentials RedshiftCredentials
 }
 
 // Invoked when the buffer is full.
 // Emits a Manifest file to S3 and then performs the Redshift copy command.
 func (e RedshiftManifestEmitter) Emit(b Buffer, t Transformer, shardID string) error {
-	db, err := sql.Open("pgx", os.Getenv("REDSHIFT_URL"))
-
-	if err != nil {
-		return err
-	}
-
 	// Aggregate file paths as strings
 	files := []string{}
 	for _, r := range b.Records() {
@@ -45,73 +49,223 @@ func (e RedshiftManifestEmitter) Emit(b Buffer, t Transformer, shardID string) e
 		files = append(files, string(f))
 	}
 
+	return e.copyFiles(files, shardID)
+}
+
+// copyFiles writes a manifest of files to S3, COPYs it into DataTable and records the
+// files in FileTable. Files already recorded in FileTable are left out, so copying files a
+// second time, e.g. after a crash before they were acknowledged, loads nothing.
+func (e RedshiftManifestEmitter) copyFiles(files []string, shardID string) error {
+	if err := e.checkDb(); err != nil {
+		return err
+	}
+
 	// Manifest file name
 	date := time.Now().UTC().Format("2006/01/02")
-	manifestFileName := e.getManifestName(date, files)
 
-	// Issue manifest COPY to Redshift
-	err = e.writeManifestToS3(files, manifestFileName)
+	copyTable := e.DataTable
+	if e.Upsert != nil {
+		copyTable = e.Upsert.stageTable(e.DataTable)
+	}
+
+	var err error
+	var manifestFileName string
+	for i := 0; i < 10; i++ {
+
+		// handle aws backoff, this may be necessary if, for example, the
+		// manifest has not appeared to the database yet
+		HandleAwsWaitTimeExp(i, "redshift manifest emitter on shard "+shardID)
+
+		var tx *sql.Tx
+		tx, err = e.Db.Begin()
+		if err == nil {
+
+			// look up the loaded files, load the others and record them in the same transaction
+			manifestFileName, err = e.loadNew(tx, copyTable, date, files)
+			if err != nil {
+				l4g.Warn("rolling back transaction for %v files, %v on shard [%v]", len(files), err, shardID)
+				tx.Rollback()
+			} else {
+				err = tx.Commit()
+			}
+
+		}
+
+		// if the request succeeded, or its an unrecoverable error, break out of the loop
+		// because we are done
+		if err == nil || IsRecoverableError(err) == false {
+			break
+		}
+
+		// recoverable error, lets warn
+		l4g.Warn("recoverable redshift error %v on shard [%v]", err, shardID)
+
+	}
+
 	if err != nil {
 		return err
 	}
-	c := e.copyStmt(manifestFileName)
-	_, err = db.Exec(c)
 
+	if manifestFileName == "" {
+		l4g.Info("[%v] files were already copied to Redshift on shard [%v]", len(files), shardID)
+		return nil
+	}
+	l4g.Info("[%v] copied to Redshift on shard [%v]", manifestFileName, shardID)
+	return nil
+}
+
+// checkDb reports a missing Db, which the emitter cannot load without.
+func (e RedshiftManifestEmitter) checkDb() error {
+	if e.Db == nil {
+		return fmt.Errorf("redshift manifest emitter for %s has no Db", e.DataTable)
+	}
+	return nil
+}
+
+// loadNew writes a manifest of those files not yet in FileTable and loads it into table
+// inside tx. It returns the manifest name, or "" when every file was already loaded.
+func (e RedshiftManifestEmitter) loadNew(tx *sql.Tx, table string, date string, files []string) (string, error) {
+	files, err := e.unloadedFiles(tx, files)
+	if err != nil || len(files) == 0 {
+		return "", err
+	}
+
+	manifestFileName := e.getManifestName(date, files)
+	if err = e.writeManifestToS3(files, manifestFileName); err != nil {
+		return "", err
+	}
+
+	// build the statement on every attempt so that temporary credentials that expired
+	// during the backoff are fetched again
+	stmt, err := e.copyStmtInto(table, manifestFileName)
 	if err != nil {
-		return err
+		return "", err
 	}
+	return manifestFileName, e.load(tx, stmt, files)
+}
 
-	// Insert file paths into File Names table
-	i := e.fileInsertStmt(files)
-	_, err = db.Exec(i)
+// unloadedFiles returns those of files that are not in FileTable, in order. The file paths
+// are kept in the first column of FileTable, which fileInsertStmt fills.
+func (e RedshiftManifestEmitter) unloadedFiles(tx *sql.Tx, files []string) ([]string, error) {
+	columns, err := redshiftColumns(tx, e.FileTable)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("file table %v has no columns", e.FileTable)
+	}
+
+	stmt, args := e.fileSelectStmt(columns[0], files)
+	rows, err := tx.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loaded := map[string]bool{}
+	for rows.Next() {
+		var f string
+		if err = rows.Scan(&f); err != nil {
+			return nil, err
+		}
+		loaded[f] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 
+	unloaded := make([]string, 0, len(files))
+	for _, f := range files {
+		if loaded[f] {
+			l4g.Info("skipping [%v], already in %v", f, e.FileTable)
+			continue
+		}
+		unloaded = append(unloaded, f)
+	}
+	return unloaded, nil
+}
+
+// load issues the COPY and inserts the file paths into FileTable inside tx.
+func (e RedshiftManifestEmitter) load(tx *sql.Tx, stmt string, files []string) error {
+	var err error
+	if e.Upsert != nil {
+		err = e.Upsert.exec(tx, e.DataTable, stmt)
+	} else {
+		_, err = tx.Exec(stmt)
+	}
 	if err != nil {
 		return err
 	}
 
-	l4g.Info("[%v] copied to Redshift on shard [%v]", manifestFileName, shardID)
-	return nil
+	// Insert file paths into File Names table
+	stmt, args := e.fileInsertStmt(files)
+	_, err = tx.Exec(stmt, args...)
+	return err
 }
 
-// Creates the INSERT statement for the file names database table.
-func (e RedshiftManifestEmitter) fileInsertStmt(fileNames []string) string {
-	i := new(bytes.Buffer)
-	i.WriteString("('")
-	i.WriteString(strings.Join(fileNames, "'),('"))
-	i.WriteString("')")
+// Creates the INSERT statement for the file names database table. The file names are
+// passed as bind parameters.
+func (e RedshiftManifestEmitter) fileInsertStmt(fileNames []string) (string, []interface{}) {
+	q := new(redshiftSQL)
+	q.Raw("INSERT INTO ").Ident(e.FileTable).Raw(" VALUES ")
+	for i, f := range fileNames {
+		if i > 0 {
+			q.Raw(",")
+		}
+		q.Raw("(").Bind(f).Raw(")")
+	}
+	q.Raw(";")
 
-	b := new(bytes.Buffer)
-	b.WriteString("INSERT INTO ")
-	b.WriteString(e.FileTable)
-	b.WriteString(" VALUES ")
-	b.WriteString(i.String())
-	b.WriteString(";")
+	return q.String(), q.Args()
+}
 
-	return b.String()
+// fileSelectStmt creates the SELECT of those file names found in column of the file names
+// database table. The file names are passed as bind parameters.
+func (e RedshiftManifestEmitter) fileSelectStmt(column string, fileNames []string) (string, []interface{}) {
+	q := new(redshiftSQL)
+	q.Raw("SELECT ").Ident(column).Raw(" FROM ").Ident(e.FileTable).Raw(" WHERE ").Ident(column).Raw(" IN (")
+	for i, f := range fileNames {
+		if i > 0 {
+			q.Raw(",")
+		}
+		q.Bind(f)
+	}
+	q.Raw(");")
+
+	return q.String(), q.Args()
 }
 
 // Creates the COPY statment for Redshift insertion.
-func (e RedshiftManifestEmitter) copyStmt(filePath string) string {
-	b := new(bytes.Buffer)
-	c := fmt.Sprintf(
-		"CREDENTIALS 'aws_access_key_id=%s;aws_secret_access_key=%s' ",
-		os.Getenv("AWS_ACCESS_KEY"),
-		os.Getenv("AWS_SECRET_KEY"),
-	)
-	b.WriteString("COPY " + e.DataTable + " ")
-	b.WriteString("FROM 's3://" + e.S3Bucket + "/" + filePath + "' ")
-	b.WriteString(c)
-	switch e.Format {
-	case "json":
-		b.WriteString(fmt.Sprintf("json 'auto' "))
-	case "jsonpaths":
-		b.WriteString(fmt.Sprintf("json '%s' ", e.Jsonpaths))
-	default:
-		b.WriteString(fmt.Sprintf("DELIMITER '%s' ", e.Delimiter))
-	}
-	b.WriteString("MANIFEST")
-	b.WriteString(";")
-	return b.String()
+func (e RedshiftManifestEmitter) copyStmt(filePath string) (string, error) {
+	return e.copyStmtInto(e.DataTable, filePath)
+}
+
+// copyStmtInto creates the COPY statement loading the manifest at filePath into table.
+func (e RedshiftManifestEmitter) copyStmtInto(table string, filePath string) (string, error) {
+	c, err := e.credentials().CopyCredentials()
+	if err != nil {
+		return "", err
+	}
+
+	o := e.CopyOptions.withLegacy(e.Format, e.Jsonpaths, e.Delimiter)
+	o.Manifest = true
+	stmt, err := redshiftCopyStatement(table, "s3://"+e.S3Bucket+"/"+filePath, c, o)
+	if err != nil {
+		return "", err
+	}
+	l4g.Debug(redactCredentials(stmt))
+	return stmt, nil
+}
+
+// credentials picks the configured Credentials, then the emitter's own keys, then the environment.
+func (e RedshiftManifestEmitter) credentials() RedshiftCredentials {
+	if e.Credentials != nil {
+		return e.Credentials
+	}
+	if e.AccessKey != "" && e.SecretKey != "" {
+		return RedshiftKeyCredentials{AccessKey: e.AccessKey, SecretKey: e.SecretKey}
+	}
+	return RedshiftEnvCredentials{}
 }
 
 // Put the Manifest file contents to Redshift
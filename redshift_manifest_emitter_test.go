@@ -6,12 +6,40 @@ func TestInsertStmt(t *testing.T) {
 	e := RedshiftManifestEmitter{FileTable: "funz"}
 	s := []string{"file1", "file2"}
 
-	expected := "INSERT INTO funz VALUES ('file1'),('file2');"
-	result := e.fileInsertStmt(s)
+	expected := "INSERT INTO \"funz\" VALUES ($1),($2);"
+	result, args := e.fileInsertStmt(s)
 
 	if result != expected {
 		t.Errorf("fileInsertStmt() = %v want %v", result, expected)
 	}
+	if len(args) != 2 || args[0] != "file1" || args[1] != "file2" {
+		t.Errorf("fileInsertStmt() args = %v want %v", args, s)
+	}
+}
+
+func TestFileSelectStmt(t *testing.T) {
+	e := RedshiftManifestEmitter{FileTable: "funz"}
+	s := []string{"file1", "file2"}
+
+	expected := `SELECT "file" FROM "funz" WHERE "file" IN ($1,$2);`
+	result, args := e.fileSelectStmt("file", s)
+
+	if result != expected {
+		t.Errorf("fileSelectStmt() = %v want %v", result, expected)
+	}
+	if len(args) != 2 || args[0] != "file1" || args[1] != "file2" {
+		t.Errorf("fileSelectStmt() args = %v want %v", args, s)
+	}
+}
+
+func TestManifestEmitterWithoutDb(t *testing.T) {
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	b.ProcessRecord("2014/01/01/a-b", "1", 0)
+
+	e := RedshiftManifestEmitter{DataTable: "events", FileTable: "files"}
+	if err := e.Emit(b, StringToStringTransformer{}, "shard"); err == nil {
+		t.Errorf("Emit() without a Db returned no error")
+	}
 }
 
 func TestManifestName(t *testing.T) {
@@ -0,0 +1,117 @@
+package connector
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// redshiftSQL builds a Redshift statement from trusted keywords, quoted identifiers and
+// literals, and bind parameters. Anything that comes from configuration or data must go
+// through Ident, Literal or Bind, never Raw.
+type redshiftSQL struct {
+	buf  bytes.Buffer
+	args []interface{}
+}
+
+// Raw appends trusted SQL text as is.
+func (q *redshiftSQL) Raw(s string) *redshiftSQL {
+	q.buf.WriteString(s)
+	return q
+}
+
+// Ident appends a quoted, possibly schema-qualified, identifier.
+func (q *redshiftSQL) Ident(name string) *redshiftSQL {
+	q.buf.WriteString(quoteRedshiftIdentifier(name))
+	return q
+}
+
+// Literal appends a quoted string literal. Used where Redshift does not accept bind
+// parameters, such as the options of a COPY.
+func (q *redshiftSQL) Literal(s string) *redshiftSQL {
+	q.buf.WriteString(quoteRedshiftLiteral(s))
+	return q
+}
+
+// Bind appends the next positional parameter and records its value.
+func (q *redshiftSQL) Bind(v interface{}) *redshiftSQL {
+	q.args = append(q.args, v)
+	q.buf.WriteString("$" + strconv.Itoa(len(q.args)))
+	return q
+}
+
+// String returns the statement text.
+func (q *redshiftSQL) String() string {
+	return q.buf.String()
+}
+
+// Args returns the values for the statement's bind parameters.
+func (q *redshiftSQL) Args() []interface{} {
+	return q.args
+}
+
+// quoteRedshiftIdentifier quotes each dot separated part of name, e.g. test.events becomes
+// "test"."events". Parts that are already quoted are unquoted first, and may contain dots,
+// e.g. "my.schema".events. Redshift folds quoted identifiers to lower case unless case
+// sensitivity is enabled, so quoting does not change which table is addressed.
+func quoteRedshiftIdentifier(name string) string {
+	parts := splitRedshiftIdentifier(name)
+	for i, p := range parts {
+		parts[i] = `"` + strings.Replace(p, `"`, `""`, -1) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+// splitRedshiftIdentifier splits name on the dots outside of quoted parts and unquotes
+// them. A quote that does not close a part where it ends is kept as part of the name.
+func splitRedshiftIdentifier(name string) []string {
+	var parts []string
+	for {
+		if p, rest, ok := cutQuotedIdentifier(name); ok {
+			parts = append(parts, p)
+			if rest == "" {
+				return parts
+			}
+			name = rest[1:]
+			continue
+		}
+
+		i := strings.Index(name, ".")
+		if i < 0 {
+			return append(parts, name)
+		}
+		parts = append(parts, name[:i])
+		name = name[i+1:]
+	}
+}
+
+// cutQuotedIdentifier unquotes the quoted part at the start of name, returning the rest of
+// name from the dot that follows it. It reports false if name does not start with a part
+// quoted up to a dot or its end.
+func cutQuotedIdentifier(name string) (string, string, bool) {
+	if !strings.HasPrefix(name, `"`) {
+		return "", "", false
+	}
+	for i := 1; i < len(name); i++ {
+		if name[i] != '"' {
+			continue
+		}
+		if i+1 < len(name) && name[i+1] == '"' {
+			i++
+			continue
+		}
+		if rest := name[i+1:]; rest == "" || rest[0] == '.' {
+			return strings.Replace(name[1:i], `""`, `"`, -1), rest, true
+		}
+		return "", "", false
+	}
+	return "", "", false
+}
+
+// quoteRedshiftLiteral quotes s as a string literal. Redshift treats a backslash in a
+// literal as an escape character, so backslashes are doubled along with single quotes.
+func quoteRedshiftLiteral(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `''`, -1)
+	return "'" + s + "'"
+}
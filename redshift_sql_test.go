@@ -0,0 +1,138 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuoteRedshiftIdentifier(t *testing.T) {
+	testCases := []struct {
+		in       string
+		expected string
+	}{
+		{in: "events", expected: `"events"`},
+		{in: "test.events", expected: `"test"."events"`},
+		{in: `"test"."events"`, expected: `"test"."events"`},
+		{in: `events"; DROP TABLE users; --`, expected: `"events""; DROP TABLE users; --"`},
+		{in: `"my.schema".events`, expected: `"my.schema"."events"`},
+		{in: `test."my.table"`, expected: `"test"."my.table"`},
+		{in: `"a""b.c"`, expected: `"a""b.c"`},
+		{in: `"open.events`, expected: `"""open"."events"`},
+	}
+
+	for idx, tc := range testCases {
+		result := quoteRedshiftIdentifier(tc.in)
+		if result != tc.expected {
+			t.Errorf("test case %d: quoteRedshiftIdentifier() = %v want %v", idx, result, tc.expected)
+		}
+	}
+}
+
+func TestQuoteRedshiftLiteral(t *testing.T) {
+	testCases := []struct {
+		in       string
+		expected string
+	}{
+		{in: "file", expected: `'file'`},
+		{in: "it's", expected: `'it''s'`},
+		{in: `a\'b`, expected: `'a\\''b'`},
+		{in: "x'); DROP TABLE users; --", expected: `'x''); DROP TABLE users; --'`},
+	}
+
+	for idx, tc := range testCases {
+		result := quoteRedshiftLiteral(tc.in)
+		if result != tc.expected {
+			t.Errorf("test case %d: quoteRedshiftLiteral() = %v want %v", idx, result, tc.expected)
+		}
+	}
+}
+
+func TestRedshiftSQLBind(t *testing.T) {
+	q := new(redshiftSQL)
+	q.Raw("SELECT * FROM ").Ident("t").Raw(" WHERE a = ").Bind(1).Raw(" AND b = ").Bind("x")
+
+	expected := `SELECT * FROM "t" WHERE a = $1 AND b = $2`
+	if q.String() != expected {
+		t.Errorf("String() = %v want %v", q.String(), expected)
+	}
+	if !reflect.DeepEqual(q.Args(), []interface{}{1, "x"}) {
+		t.Errorf("Args() = %v want %v", q.Args(), []interface{}{1, "x"})
+	}
+}
+
+func TestInsertStmtQuotesFileNames(t *testing.T) {
+	e := RedshiftManifestEmitter{FileTable: "files"}
+	s := []string{"2014/01/01/a'); DROP TABLE users; --"}
+
+	result, args := e.fileInsertStmt(s)
+
+	expected := `INSERT INTO "files" VALUES ($1);`
+	if result != expected {
+		t.Errorf("fileInsertStmt() = %v want %v", result, expected)
+	}
+	if len(args) != 1 || args[0] != s[0] {
+		t.Errorf("fileInsertStmt() args = %v want %v", args, s)
+	}
+}
+
+func TestCopyStatementFormats(t *testing.T) {
+	creds := RedshiftIAMRole{Arn: "arn:aws:iam::1:role/r"}
+
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{format: "json", expected: `COPY "test"."t" FROM 's3://bucket/it''s.txt' IAM_ROLE 'arn:aws:iam::1:role/r' json 'auto';`},
+		{format: "jsonpaths", expected: `COPY "test"."t" FROM 's3://bucket/it''s.txt' IAM_ROLE 'arn:aws:iam::1:role/r' json 's3://bucket/paths''.json';`},
+		{format: "", expected: `COPY "test"."t" FROM 's3://bucket/it''s.txt' IAM_ROLE 'arn:aws:iam::1:role/r' DELIMITER '''';`},
+	}
+
+	for idx, tc := range testCases {
+		e := RedshiftBasicEmtitter{
+			Format:      tc.format,
+			Delimiter:   "'",
+			Jsonpaths:   "s3://bucket/paths'.json",
+			S3Bucket:    "bucket",
+			TableName:   "test.t",
+			Credentials: creds,
+		}
+		result, err := e.copyStatement("it's.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != tc.expected {
+			t.Errorf("test case %d: copyStatement() = %v want %v", idx, result, tc.expected)
+		}
+	}
+}
+
+func TestCopyStmtFormats(t *testing.T) {
+	creds := RedshiftIAMRole{Arn: "arn:aws:iam::1:role/r"}
+
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{format: "json", expected: `COPY "test"."t" FROM 's3://bucket/it''s' IAM_ROLE 'arn:aws:iam::1:role/r' json 'auto' MANIFEST;`},
+		{format: "jsonpaths", expected: `COPY "test"."t" FROM 's3://bucket/it''s' IAM_ROLE 'arn:aws:iam::1:role/r' json 's3://bucket/paths''.json' MANIFEST;`},
+		{format: "", expected: `COPY "test"."t" FROM 's3://bucket/it''s' IAM_ROLE 'arn:aws:iam::1:role/r' DELIMITER '|' MANIFEST;`},
+	}
+
+	for idx, tc := range testCases {
+		e := RedshiftManifestEmitter{
+			Format:      tc.format,
+			Delimiter:   "|",
+			Jsonpaths:   "s3://bucket/paths'.json",
+			S3Bucket:    "bucket",
+			DataTable:   "test.t",
+			Credentials: creds,
+		}
+		result, err := e.copyStmt("it's")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != tc.expected {
+			t.Errorf("test case %d: copyStmt() = %v want %v", idx, result, tc.expected)
+		}
+	}
+}
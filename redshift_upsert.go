@@ -0,0 +1,124 @@
+package connector
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// RedshiftUpsert configures the Redshift emitters to upsert instead of append. Each load is
+// COPY'd into a temporary staging table shaped like the target, deduplicated by PrimaryKeys,
+// and then swapped into the target in the emitter's transaction, so change-data-capture
+// streams do not accumulate one row per change.
+type RedshiftUpsert struct {
+	// PrimaryKeys are the columns identifying a row. Required.
+	PrimaryKeys []string
+	// VersionColumn, when set, orders versions of the same row. Only the highest version in
+	// the batch is kept, and rows older than the version already in the target are dropped.
+	// Without it, or between rows that tie on version, the batch keeps one row per key,
+	// chosen by ordering on every column so that replays keep the same one.
+	VersionColumn string
+	// Merge uses Redshift's MERGE ... REMOVE DUPLICATES instead of DELETE followed by INSERT.
+	Merge bool
+}
+
+// stageTable is the name of the temporary staging table for target. Temporary tables live
+// in a session schema, so the name cannot be qualified.
+func (u *RedshiftUpsert) stageTable(target string) string {
+	return "stage_" + strings.Replace(target, ".", "_", -1)
+}
+
+// statements builds the statements that stage the COPY and apply it to target, in order.
+// copyStmt must load into stageTable(target); columns are the target's columns, in order.
+func (u *RedshiftUpsert) statements(target string, columns []string, copyStmt string) []string {
+	loaded := quoteRedshiftIdentifier(u.stageTable(target))
+	stage := quoteRedshiftIdentifier(u.stageTable(target) + "_deduped")
+	target = quoteRedshiftIdentifier(target)
+
+	cols := make([]string, len(columns))
+	for i, c := range columns {
+		cols[i] = quoteRedshiftIdentifier(c)
+	}
+	keys := make([]string, len(u.PrimaryKeys))
+	for i, k := range u.PrimaryKeys {
+		keys[i] = quoteRedshiftIdentifier(k)
+	}
+	order := strings.Join(cols, ", ")
+	if u.VersionColumn != "" {
+		order = quoteRedshiftIdentifier(u.VersionColumn) + " DESC, " + order
+	}
+
+	// keys repeated within the batch would insert one row each, so keep one row per key
+	stmts := []string{
+		fmt.Sprintf("CREATE TEMP TABLE %s (LIKE %s);", loaded, target),
+		copyStmt,
+		fmt.Sprintf("CREATE TEMP TABLE %s (LIKE %s);", stage, target),
+		fmt.Sprintf("INSERT INTO %s SELECT %s FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) AS upsert_row FROM %s) AS ranked WHERE upsert_row = 1;",
+			stage, strings.Join(cols, ", "), strings.Join(keys, ", "), order, loaded),
+	}
+
+	if u.VersionColumn != "" {
+		version := quoteRedshiftIdentifier(u.VersionColumn)
+		stmts = append(stmts,
+			fmt.Sprintf("DELETE FROM %s USING %s WHERE %s AND %s.%s < %s.%s;",
+				stage, target, u.keysEqual(stage, target), stage, version, target, version),
+		)
+	}
+
+	if u.Merge {
+		stmts = append(stmts,
+			fmt.Sprintf("MERGE INTO %s USING %s ON %s REMOVE DUPLICATES;", target, stage, u.keysEqual(target, stage)),
+		)
+	} else {
+		stmts = append(stmts,
+			fmt.Sprintf("DELETE FROM %s USING %s WHERE %s;", target, stage, u.keysEqual(target, stage)),
+			fmt.Sprintf("INSERT INTO %s SELECT * FROM %s;", target, stage),
+		)
+	}
+
+	return append(stmts, fmt.Sprintf("DROP TABLE %s;", loaded), fmt.Sprintf("DROP TABLE %s;", stage))
+}
+
+// exec runs the upsert statements inside tx. The caller owns commit and rollback.
+func (u *RedshiftUpsert) exec(tx *sql.Tx, target string, copyStmt string) error {
+	if len(u.PrimaryKeys) == 0 {
+		return fmt.Errorf("redshift upsert into %s has no primary key columns", target)
+	}
+
+	columns, err := redshiftColumns(tx, target)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range u.statements(target, columns, copyStmt) {
+		if stmt != copyStmt {
+			l4g.Debug(stmt)
+		}
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redshiftColumns returns the columns of table, in order.
+func redshiftColumns(tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.Query("SELECT * FROM " + quoteRedshiftIdentifier(table) + " LIMIT 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// keysEqual joins left and right, both already quoted, on the primary key columns.
+func (u *RedshiftUpsert) keysEqual(left string, right string) string {
+	conds := make([]string, len(u.PrimaryKeys))
+	for i, k := range u.PrimaryKeys {
+		k = quoteRedshiftIdentifier(k)
+		conds[i] = fmt.Sprintf("%s.%s = %s.%s", left, k, right, k)
+	}
+	return strings.Join(conds, " AND ")
+}
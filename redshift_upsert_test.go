@@ -0,0 +1,77 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpsertStatements(t *testing.T) {
+	copyStmt := "COPY \"stage_test_events\" FROM 's3://bucket/file' json 'auto';"
+
+	columns := []string{"id", "site", "updated_at"}
+	create := []string{
+		"CREATE TEMP TABLE \"stage_test_events\" (LIKE \"test\".\"events\");",
+		copyStmt,
+		"CREATE TEMP TABLE \"stage_test_events_deduped\" (LIKE \"test\".\"events\");",
+	}
+	drop := []string{
+		"DROP TABLE \"stage_test_events\";",
+		"DROP TABLE \"stage_test_events_deduped\";",
+	}
+
+	testCases := []struct {
+		upsert   RedshiftUpsert
+		expected []string
+	}{
+		{
+			upsert: RedshiftUpsert{PrimaryKeys: []string{"id"}},
+			expected: []string{
+				"INSERT INTO \"stage_test_events_deduped\" SELECT \"id\", \"site\", \"updated_at\" FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY \"id\" ORDER BY \"id\", \"site\", \"updated_at\") AS upsert_row FROM \"stage_test_events\") AS ranked WHERE upsert_row = 1;",
+				"DELETE FROM \"test\".\"events\" USING \"stage_test_events_deduped\" WHERE \"test\".\"events\".\"id\" = \"stage_test_events_deduped\".\"id\";",
+				"INSERT INTO \"test\".\"events\" SELECT * FROM \"stage_test_events_deduped\";",
+			},
+		},
+		{
+			upsert: RedshiftUpsert{PrimaryKeys: []string{"id", "site"}, VersionColumn: "updated_at"},
+			expected: []string{
+				"INSERT INTO \"stage_test_events_deduped\" SELECT \"id\", \"site\", \"updated_at\" FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY \"id\", \"site\" ORDER BY \"updated_at\" DESC, \"id\", \"site\", \"updated_at\") AS upsert_row FROM \"stage_test_events\") AS ranked WHERE upsert_row = 1;",
+				"DELETE FROM \"stage_test_events_deduped\" USING \"test\".\"events\" WHERE \"stage_test_events_deduped\".\"id\" = \"test\".\"events\".\"id\" AND \"stage_test_events_deduped\".\"site\" = \"test\".\"events\".\"site\" AND \"stage_test_events_deduped\".\"updated_at\" < \"test\".\"events\".\"updated_at\";",
+				"DELETE FROM \"test\".\"events\" USING \"stage_test_events_deduped\" WHERE \"test\".\"events\".\"id\" = \"stage_test_events_deduped\".\"id\" AND \"test\".\"events\".\"site\" = \"stage_test_events_deduped\".\"site\";",
+				"INSERT INTO \"test\".\"events\" SELECT * FROM \"stage_test_events_deduped\";",
+			},
+		},
+		{
+			upsert: RedshiftUpsert{PrimaryKeys: []string{"id"}, Merge: true},
+			expected: []string{
+				"INSERT INTO \"stage_test_events_deduped\" SELECT \"id\", \"site\", \"updated_at\" FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY \"id\" ORDER BY \"id\", \"site\", \"updated_at\") AS upsert_row FROM \"stage_test_events\") AS ranked WHERE upsert_row = 1;",
+				"MERGE INTO \"test\".\"events\" USING \"stage_test_events_deduped\" ON \"test\".\"events\".\"id\" = \"stage_test_events_deduped\".\"id\" REMOVE DUPLICATES;",
+			},
+		},
+	}
+
+	for idx, tc := range testCases {
+		expected := append(append(append([]string{}, create...), tc.expected...), drop...)
+		result := tc.upsert.statements("test.events", columns, copyStmt)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("test case %d: statements() = %#v want %#v", idx, result, expected)
+		}
+	}
+}
+
+func TestUpsertCopiesIntoStageTable(t *testing.T) {
+	e := RedshiftBasicEmtitter{
+		Format:    "json",
+		S3Bucket:  "test_bucket",
+		TableName: "test.events",
+		Upsert:    &RedshiftUpsert{PrimaryKeys: []string{"id"}},
+	}
+	stmt, err := e.copyStatementInto(e.Upsert.stageTable(e.TableName), "test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "COPY \"stage_test_events\" FROM 's3://test_bucket/test.txt' "
+	if stmt[:len(expected)] != expected {
+		t.Errorf("copyStatementInto() = %v want prefix %v", stmt, expected)
+	}
+}
@@ -0,0 +1,136 @@
+package connector
+
+import (
+	"fmt"
+
+	l4g "github.com/ezoic/log4go"
+)
+
+// RoutingEmitter is an implementation of Emitter that partitions each buffer by a key computed
+// from its records, e.g. the event type, and emits every partition with its own Emitter, so a
+// single Pipeline can load one table or S3 prefix per event type.
+//
+// Emit fails when any route fails, so the Pipeline checkpoints only once every route has
+// succeeded. The replayed buffer is then emitted to every route again, including those that
+// had succeeded, so route emitters should be idempotent. Every route is handed the sequence
+// numbers of the whole buffer, so route emitters that skip loaded ranges must track them per
+// route: RedshiftBasicEmtitters of different tables may share a LoadCheckpoint, as it keeps a
+// row per table, but routes loading the same table must not. Route emitters can tell their
+// route with BufferRoute; the emitters uploading to S3 add it to their file names, so routes
+// may share an S3Prefix.
+//
+// Routes are only known from the buffers emitted, so the Pipeline cannot flush them: a route
+// whose Emitter is a ShardFlusher, e.g. a RedshiftBatchEmitter, fails.
+type RoutingEmitter struct {
+	// Key returns the route of a record.
+	Key func(record interface{}) string
+
+	// RecordKey, when set, is used instead of Key and is also given the record's metadata, e.g.
+	// to route by partition key. The metadata is nil when the buffer does not keep it.
+	RecordKey func(record interface{}, r *Record) string
+
+	// NewEmitter builds the Emitter of a route. It is called for every route of every buffer,
+	// so it should be cheap. Returning a nil Emitter drops the route's records.
+	NewEmitter func(key string) (Emitter, error)
+
+	// Report, when set, receives the outcome of every route for each buffer.
+	Report func(shardID string, results []SinkResult)
+}
+
+// Emit is invoked when the buffer is full. It emits each route's records with the route's
+// Emitter. A failed route does not stop the others; they are all reported in a MultiEmitError.
+func (e RoutingEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	var keys []string
+	routes := map[string]*routeBuffer{}
+	metadata := BufferMetadata(b)
+	for i, r := range b.Records() {
+		var m *Record
+		if i < len(metadata) {
+			m = metadata[i]
+		}
+
+		var key string
+		if e.RecordKey != nil {
+			key = e.RecordKey(r, m)
+		} else {
+			key = e.Key(r)
+		}
+		rb, ok := routes[key]
+		if !ok {
+			rb = &routeBuffer{Buffer: b, key: key}
+			routes[key] = rb
+			keys = append(keys, key)
+		}
+		rb.records = append(rb.records, r)
+		rb.metadata = append(rb.metadata, m)
+	}
+
+	results := make([]SinkResult, 0, len(keys))
+	failed := false
+	for _, key := range keys {
+		r := SinkResult{Name: key, Attempts: 1}
+		var emitter Emitter
+		emitter, r.Err = e.NewEmitter(key)
+		if r.Err == nil && holdsShardData(emitter) {
+			r.Err = fmt.Errorf("the emitter of route [%s] is a ShardFlusher, which a RoutingEmitter cannot flush", key)
+		} else if r.Err == nil && emitter == nil {
+			l4g.Debug("dropping [%v] records of route [%s] on shard [%v]", len(routes[key].records), key, shardID)
+			r.Skipped = true
+		} else if r.Err == nil {
+			r.Err = emitter.Emit(routes[key], t, shardID)
+		}
+		if r.Err != nil {
+			l4g.Error("route [%s] failed on shard [%v]: %v", key, shardID, r.Err)
+			failed = true
+		}
+		results = append(results, r)
+	}
+
+	if e.Report != nil {
+		e.Report(shardID, results)
+	}
+	if failed {
+		return &MultiEmitError{Results: results}
+	}
+	return nil
+}
+
+// BufferRoute returns the route key of a buffer a RoutingEmitter hands to a route's Emitter,
+// or "" for any other Buffer or TypedBuffer.
+func BufferRoute(b interface{}) string {
+	if rb, ok := b.(interface{ routeKey() string }); ok {
+		return rb.routeKey()
+	}
+	return ""
+}
+
+// routeBuffer is the part of a buffer belonging to one route. It reports the sequence numbers
+// and arrival time of the whole buffer.
+type routeBuffer struct {
+	Buffer
+	key      string
+	records  []interface{}
+	metadata []*Record
+}
+
+func (b *routeBuffer) routeKey() string {
+	return b.key
+}
+
+func (b *routeBuffer) Records() []interface{} {
+	return b.records
+}
+
+func (b *routeBuffer) Metadata() []*Record {
+	return b.metadata
+}
+
+func (b *routeBuffer) NumRecordsInBuffer() int {
+	return len(b.records)
+}
+
+// ProcessRecord and Flush do nothing: the buffer being emitted belongs to the Pipeline.
+func (b *routeBuffer) ProcessRecord(record interface{}, sequenceNumber string, approximateArrivalTime int) {
+}
+
+func (b *routeBuffer) Flush() {}
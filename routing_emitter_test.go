@@ -0,0 +1,133 @@
+package connector
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// collectingEmitter records the buffers it receives, failing when err is set.
+type collectingEmitter struct {
+	err     error
+	records [][]interface{}
+	last    []string
+}
+
+func (e *collectingEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	e.records = append(e.records, b.Records())
+	e.last = append(e.last, b.LastSequenceNumber())
+	return e.err
+}
+
+func TestRoutingEmitter(t *testing.T) {
+	emitters := map[string]*collectingEmitter{
+		"click": {},
+		"view":  {},
+		"error": {err: fmt.Errorf("table missing")},
+	}
+	var reported []SinkResult
+	e := RoutingEmitter{
+		Key: func(r interface{}) string { return strings.Split(r.(string), ":")[0] },
+		NewEmitter: func(key string) (Emitter, error) {
+			if key == "debug" {
+				return nil, nil
+			}
+			return emitters[key], nil
+		},
+		Report: func(shardID string, results []SinkResult) { reported = results },
+	}
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	for i, s := range []string{"click:1", "view:1", "click:2", "debug:1"} {
+		b.ProcessRecord(s, fmt.Sprint(i+1), 0)
+	}
+
+	if err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+	if want := [][]interface{}{{"click:1", "click:2"}}; !reflect.DeepEqual(emitters["click"].records, want) {
+		t.Errorf("click route records = %v want %v", emitters["click"].records, want)
+	}
+	if want := []string{"4"}; !reflect.DeepEqual(emitters["view"].last, want) {
+		t.Errorf("view route LastSequenceNumber() = %v want %v", emitters["view"].last, want)
+	}
+	if len(reported) != 3 || !reported[2].Skipped || reported[2].Name != "debug" {
+		t.Errorf("reported = %+v want click, view and a skipped debug route", reported)
+	}
+
+	b.Flush()
+	b.ProcessRecord("error:1", "5", 0)
+	b.ProcessRecord("view:2", "6", 0)
+	err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000")
+	if _, ok := err.(*MultiEmitError); !ok {
+		t.Errorf("Emit() = %v want a MultiEmitError", err)
+	}
+	if len(emitters["view"].records) != 2 {
+		t.Errorf("view route emits = %v want 2, a failed route must not stop the others", len(emitters["view"].records))
+	}
+}
+
+func TestRoutingEmitterRefusesShardFlushers(t *testing.T) {
+	flushing := &flushingEmitter{shardEmitter: shardEmitter{records: map[string][]interface{}{}}}
+	plain := &collectingEmitter{}
+	e := RoutingEmitter{
+		Key: func(r interface{}) string { return r.(string) },
+		NewEmitter: func(key string) (Emitter, error) {
+			if key == "batch" {
+				return MultiEmitter{Sinks: []Sink{{Name: "batch", Emitter: flushing}}}, nil
+			}
+			return MultiEmitter{Sinks: []Sink{{Name: "plain", Emitter: plain}}}, nil
+		},
+	}
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	b.ProcessRecord("plain", "1", 0)
+	if err := e.Emit(b, StringToStringTransformer{}, "shard"); err != nil || len(plain.records) != 1 {
+		t.Errorf("Emit() = %v with %v emits want nil with 1", err, len(plain.records))
+	}
+
+	b.ProcessRecord("batch", "2", 0)
+	if err := e.Emit(b, StringToStringTransformer{}, "shard"); err == nil || len(flushing.records) != 0 {
+		t.Errorf("Emit() to a ShardFlusher route = %v with records %v want an error and none", err, flushing.records)
+	}
+}
+
+func TestRoutingEmitterRecordKey(t *testing.T) {
+	emitters := map[string]*metadataEmitter{"a": {}, "b": {}}
+	e := RoutingEmitter{
+		RecordKey: func(record interface{}, r *Record) string {
+			return r.PartitionKey
+		},
+		NewEmitter: func(key string) (Emitter, error) {
+			return emitters[key], nil
+		},
+	}
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	for i, key := range []string{"a", "b", "a"} {
+		b.ProcessRecordWithMetadata(fmt.Sprint(i), &Record{PartitionKey: key, SequenceNumber: fmt.Sprint(i + 1)})
+	}
+	if err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+
+	if want := []string{"1", "3"}; !reflect.DeepEqual(emitters["a"].sequences, want) {
+		t.Errorf("route a metadata sequences = %v want %v", emitters["a"].sequences, want)
+	}
+	if want := []string{"2"}; !reflect.DeepEqual(emitters["b"].sequences, want) {
+		t.Errorf("route b metadata sequences = %v want %v", emitters["b"].sequences, want)
+	}
+}
+
+// metadataEmitter records the sequence numbers of the metadata of the buffers it receives.
+type metadataEmitter struct {
+	sequences []string
+}
+
+func (e *metadataEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	for _, m := range BufferMetadata(b) {
+		e.sequences = append(e.sequences, m.SequenceNumber)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package connector
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ezoic/go-kinesis"
+)
+
+// ShardSet is a set of shard ids that is safe for concurrent use. A nil *ShardSet is empty and
+// ignores changes.
+type ShardSet struct {
+	mu     sync.Mutex
+	shards map[string]bool
+}
+
+// Add adds shardID, returning false if it was already in the set.
+func (s *ShardSet) Add(shardID string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shards[shardID] {
+		return false
+	}
+	if s.shards == nil {
+		s.shards = map[string]bool{}
+	}
+	s.shards[shardID] = true
+	return true
+}
+
+// Remove removes shardID.
+func (s *ShardSet) Remove(shardID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.shards, shardID)
+}
+
+// Contains reports whether shardID is in the set.
+func (s *ShardSet) Contains(shardID string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shards[shardID]
+}
+
+// List returns the shard ids in the set, sorted.
+func (s *ShardSet) List() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shards := make([]string, 0, len(s.shards))
+	for shardID := range s.shards {
+		shards = append(shards, shardID)
+	}
+	sort.Strings(shards)
+	return shards
+}
+
+// Runner processes shards of a stream concurrently, each with its own Pipeline built by
+// NewPipeline, so that no two shards share a Buffer or Checkpoint. Its methods are safe for
+// concurrent use, e.g. from a lease coordinator starting shards as it acquires them.
+type Runner struct {
+	Ksis *kinesis.Kinesis
+
+	// NewPipeline builds the Pipeline of a shard. The Buffer and Checkpoint must be new for
+	// every call; the Emitter, Filter, Transformer and Dedup may be shared if they are safe
+	// for concurrent use, as those of this package are.
+	NewPipeline func(shardID string) Pipeline
+
+	running ShardSet
+	wg      sync.WaitGroup
+
+	// reader returns the client a shard is read with, Ksis when nil. Tests replace it.
+	reader func(shardID string) shardReader
+}
+
+// Start processes shardID in a new goroutine unless it is already running, and reports
+// whether it started it. The shard is running until it is closed or its lease is lost.
+func (r *Runner) Start(shardID string) bool {
+	if !r.running.Add(shardID) {
+		return false
+	}
+
+	p := r.NewPipeline(shardID)
+	p.Running = &r.running
+
+	var ksis shardReader = r.Ksis
+	if r.reader != nil {
+		ksis = r.reader(shardID)
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		p.processShard(ksis, shardID)
+	}()
+	return true
+}
+
+// Running returns the shards being processed, sorted.
+func (r *Runner) Running() []string {
+	return r.running.List()
+}
+
+// Wait blocks until every started shard has stopped.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
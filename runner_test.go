@@ -0,0 +1,313 @@
+package connector
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ezoic/go-kinesis"
+)
+
+// fakeShardReader serves batches of records of one shard, then reports it closed.
+type fakeShardReader struct {
+	mu      sync.Mutex
+	batches [][]kinesis.GetRecordsRecords
+	calls   int
+}
+
+func (f *fakeShardReader) GetShardIterator(args *kinesis.RequestArgs) (*kinesis.GetShardIteratorResp, error) {
+	return &kinesis.GetShardIteratorResp{ShardIterator: "iterator-0"}, nil
+}
+
+func (f *fakeShardReader) GetRecords(args *kinesis.RequestArgs) (*kinesis.GetRecordsResp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.calls == len(f.batches) {
+		return &kinesis.GetRecordsResp{}, nil
+	}
+	f.calls++
+	return &kinesis.GetRecordsResp{
+		Records:           f.batches[f.calls-1],
+		NextShardIterator: fmt.Sprintf("iterator-%d", f.calls),
+	}, nil
+}
+
+// memoryCheckpoint is a Checkpoint of a single shard.
+type memoryCheckpoint struct {
+	shardID        string
+	sequenceNumber string
+	closed         bool
+}
+
+func (c *memoryCheckpoint) CheckpointExists(shardID string) bool {
+	return c.sequenceNumber != ""
+}
+
+func (c *memoryCheckpoint) CheckpointIsClosed(shardID string) bool {
+	return c.closed
+}
+
+func (c *memoryCheckpoint) SequenceNumber() string {
+	return c.sequenceNumber
+}
+
+func (c *memoryCheckpoint) SetCheckpoint(shardID string, sequenceNumber string, approximateArrivalTime int) {
+	if shardID != c.shardID {
+		panic("checkpoint of shard " + c.shardID + " set for shard " + shardID)
+	}
+	c.sequenceNumber = sequenceNumber
+}
+
+func (c *memoryCheckpoint) SetClosed(shardID string, isClosed bool) {
+	c.closed = isClosed
+}
+
+// shardEmitter is an Emitter shared by every shard, keeping the records emitted per shard.
+type shardEmitter struct {
+	mu      sync.Mutex
+	records map[string][]interface{}
+}
+
+func (e *shardEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.records[shardID] = append(e.records[shardID], b.Records()...)
+	return nil
+}
+
+// Test_RunnerShards runs shards concurrently with shared emitter, filter and deduplicator.
+// Run it with -race.
+func Test_RunnerShards(t *testing.T) {
+	const shards, batches, perBatch = 8, 5, 7
+
+	readers := map[string]*fakeShardReader{}
+	checkpoints := map[string]*memoryCheckpoint{}
+	for s := 0; s < shards; s++ {
+		shardID := fmt.Sprintf("shardId-%012d", s)
+		reader := &fakeShardReader{}
+		seq := 0
+		for i := 0; i < batches; i++ {
+			var batch []kinesis.GetRecordsRecords
+			for j := 0; j < perBatch; j++ {
+				seq++
+				batch = append(batch, kinesis.GetRecordsRecords{
+					Data:           []byte(fmt.Sprintf("%s:%d", shardID, seq)),
+					PartitionKey:   shardID,
+					SequenceNumber: fmt.Sprint(seq),
+				})
+			}
+			reader.batches = append(reader.batches, batch)
+		}
+		readers[shardID] = reader
+		checkpoints[shardID] = &memoryCheckpoint{shardID: shardID}
+	}
+
+	emitter := &shardEmitter{records: map[string][]interface{}{}}
+	dedup := &Deduplicator{ID: func(r interface{}) string { return r.(string) }}
+	filter := RecordFilterFunc(func(record interface{}, r *Record) bool {
+		return strings.HasPrefix(record.(string), r.ShardID)
+	})
+
+	r := &Runner{
+		NewPipeline: func(shardID string) Pipeline {
+			return Pipeline{
+				Buffer:      &RecordBuffer{NumRecordsToBuffer: 10},
+				Checkpoint:  checkpoints[shardID],
+				Dedup:       dedup,
+				Emitter:     emitter,
+				Filter:      filter,
+				StreamName:  "stream",
+				Transformer: StringToStringTransformer{},
+			}
+		},
+		reader: func(shardID string) shardReader {
+			return readers[shardID]
+		},
+	}
+
+	var wg sync.WaitGroup
+	for shardID := range readers {
+		wg.Add(1)
+		go func(shardID string) {
+			defer wg.Done()
+			r.Start(shardID)
+			r.Start(shardID)
+			r.Running()
+		}(shardID)
+	}
+	wg.Wait()
+	r.Wait()
+
+	if got := r.Running(); len(got) != 0 {
+		t.Errorf("Running() after Wait() = %v want none", got)
+	}
+	for shardID, c := range checkpoints {
+		if got, want := c.sequenceNumber, fmt.Sprint(batches*perBatch); got != want || !c.closed {
+			t.Errorf("shard %s checkpoint = %v, closed %v want %v, closed", shardID, got, c.closed, want)
+		}
+		records := emitter.records[shardID]
+		if len(records) != batches*perBatch {
+			t.Errorf("shard %s emitted %d records want %d", shardID, len(records), batches*perBatch)
+			continue
+		}
+		for i, rec := range records {
+			if want := fmt.Sprintf("%s:%d", shardID, i+1); rec != want {
+				t.Errorf("shard %s record %d = %v want %v", shardID, i, rec, want)
+				break
+			}
+		}
+	}
+}
+
+func Test_claimShardState(t *testing.T) {
+	b := &RecordBuffer{}
+	typed := &TypedRecordBuffer[string]{}
+	c := &memoryCheckpoint{}
+
+	cases := []struct {
+		shardID string
+		values  []interface{}
+		ok      bool
+	}{
+		{"shard-1", []interface{}{b, c}, true},
+		{"shard-2", []interface{}{&RecordBuffer{}, c}, false},
+		{"shard-2", []interface{}{b}, false},
+		{"shard-2", []interface{}{typed, StringToStringTransformer{}, nil}, true},
+		{"shard-3", []interface{}{UntypedBuffer[string](typed)}, false},
+	}
+	for i, tc := range cases {
+		err := claimShardState(tc.shardID, tc.values...)
+		if (err == nil) != tc.ok {
+			t.Errorf("case %d: claimShardState(%v) = %v want ok %v", i, tc.shardID, err, tc.ok)
+		}
+	}
+
+	releaseShardState(b, c, typed)
+	if err := claimShardState("shard-3", b, c, UntypedBuffer[string](typed)); err != nil {
+		t.Errorf("claimShardState() after release = %v", err)
+	}
+	releaseShardState(b, c, typed)
+}
+
+func Test_ShardSet(t *testing.T) {
+	var s ShardSet
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.Add(fmt.Sprint(i % 5))
+			s.Contains("0")
+		}(i)
+	}
+	wg.Wait()
+
+	if want := []string{"0", "1", "2", "3", "4"}; !reflect.DeepEqual(s.List(), want) {
+		t.Errorf("List() = %v want %v", s.List(), want)
+	}
+	if s.Add("1") {
+		t.Errorf("Add() of a present shard = true want false")
+	}
+	s.Remove("1")
+	if s.Contains("1") {
+		t.Errorf("Contains() after Remove() = true want false")
+	}
+
+	var nilSet *ShardSet
+	nilSet.Remove("1")
+	if nilSet.Add("1") || nilSet.Contains("1") || nilSet.List() != nil {
+		t.Errorf("nil ShardSet is not empty")
+	}
+}
+
+// flushingEmitter is a ShardFlusher recording its flushes.
+type flushingEmitter struct {
+	shardEmitter
+	flushes []bool
+}
+
+func (e *flushingEmitter) FlushInterval() time.Duration {
+	return time.Nanosecond
+}
+
+func (e *flushingEmitter) FlushShard(shardID string, final bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.flushes = append(e.flushes, final)
+	return nil
+}
+
+func Test_PipelineFlushesEmitter(t *testing.T) {
+	reader := &fakeShardReader{batches: [][]kinesis.GetRecordsRecords{
+		{{Data: []byte("a"), SequenceNumber: "1"}},
+		{{Data: []byte("b"), SequenceNumber: "2"}},
+	}}
+	c := &memoryCheckpoint{shardID: "shard"}
+	emitter := &flushingEmitter{shardEmitter: shardEmitter{records: map[string][]interface{}{}}}
+
+	p := Pipeline{
+		Buffer:      &RecordBuffer{NumRecordsToBuffer: 10},
+		Checkpoint:  c,
+		Emitter:     emitter,
+		Filter:      &AllPassFilter{},
+		StreamName:  "stream",
+		Transformer: StringToStringTransformer{},
+	}
+	p.processShard(reader, "shard")
+
+	if len(emitter.flushes) == 0 || !emitter.flushes[len(emitter.flushes)-1] {
+		t.Fatalf("flushes = %v want a final flush last", emitter.flushes)
+	}
+	for i, final := range emitter.flushes[:len(emitter.flushes)-1] {
+		if final {
+			t.Errorf("flush %d = final want periodic", i)
+		}
+	}
+	if !c.closed {
+		t.Errorf("checkpoint closed = false want true")
+	}
+}
+
+// userRecordEmitter keeps each emitted record with its partition key and sequence numbers.
+type userRecordEmitter struct {
+	records []string
+}
+
+func (e *userRecordEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	for i, m := range BufferMetadata(b) {
+		e.records = append(e.records, fmt.Sprintf("%v/%s/%s/%d", b.Records()[i], m.PartitionKey, m.SequenceNumber, m.SubSequenceNumber))
+	}
+	return nil
+}
+
+func Test_PipelineDeaggregates(t *testing.T) {
+	aggregated := aggregateRecords([]kinesisPutRecord{
+		{Data: []byte("a"), PartitionKey: "user-1"},
+		{Data: []byte("b"), PartitionKey: "user-1"},
+	})[0]
+	reader := &fakeShardReader{batches: [][]kinesis.GetRecordsRecords{{
+		{Data: []byte("plain"), PartitionKey: "user-0", SequenceNumber: "1"},
+		{Data: aggregated.Data, PartitionKey: aggregated.PartitionKey, SequenceNumber: "2"},
+	}}}
+
+	emitter := &userRecordEmitter{}
+
+	p := Pipeline{
+		Buffer:      &RecordBuffer{NumRecordsToBuffer: 10},
+		Checkpoint:  &memoryCheckpoint{shardID: "shard"},
+		Deaggregate: true,
+		Emitter:     emitter,
+		Filter:      &AllPassFilter{},
+		StreamName:  "stream",
+		Transformer: StringToStringTransformer{},
+	}
+	p.processShard(reader, "shard")
+
+	if want := []string{"plain/user-0/1/0", "a/user-1/2/0", "b/user-1/2/1"}; !reflect.DeepEqual(emitter.records, want) {
+		t.Errorf("emitted records = %v want %v", emitter.records, want)
+	}
+}
@@ -2,7 +2,10 @@ package connector
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/AdRoll/goamz/aws"
@@ -15,7 +18,9 @@ import (
 // The use of  this struct requires the configuration of an S3 bucket/endpoint. When the buffer is full, this
 // struct's Emit method adds the contents of the buffer to S3 as one file. The filename is generated
 // from the first and last sequence numbers of the records contained in that file separated by a
-// dash. This struct requires the configuration of an S3 bucket and endpoint.
+// dash, followed by the route key when a RoutingEmitter emits to it, so that routes sharing an
+// S3Prefix do not overwrite each other's files. This struct requires the configuration of an S3
+// bucket and endpoint.
 type S3Emitter struct {
 	S3Bucket string
 	S3Prefix string
@@ -32,21 +37,27 @@ func (e S3Emitter) S3FileName(firstSeq string, lastSeq string) string {
 	}
 }
 
-// Emit is invoked when the buffer is full. This method emits the set of filtered records.
-func (e S3Emitter) Emit(b Buffer, t Transformer, shardID string) error {
-	auth, _ := aws.EnvAuth()
-	s3Con := s3.New(auth, aws.USEast)
-	s3Con.ReadTimeout = time.Second * 300
-	s3Con.ConnectTimeout = time.Second * 10
-	bucket := s3Con.Bucket(e.S3Bucket)
+// bufferFileName is the S3FileName of the buffer, followed by its route key if any.
+func (e S3Emitter) bufferFileName(b Buffer) string {
 	s3File := e.S3FileName(b.FirstSequenceNumber(), b.LastSequenceNumber())
+	if route := BufferRoute(b); route != "" {
+		s3File += "-" + url.PathEscape(route)
+	}
+	return s3File
+}
 
-	var buffer bytes.Buffer
+// Emit is invoked when the buffer is full. This method emits the set of filtered records.
+func (e S3Emitter) Emit(b Buffer, t Transformer, shardID string) error {
+	_, _, err := e.put(b, t, shardID)
+	return err
+}
 
-	for _, r := range b.Records() {
-		var s = t.FromRecord(r)
-		buffer.Write(s)
-	}
+// put uploads the buffer and returns the key it was uploaded to and the hex MD5 of the
+// contents, for callers that go on to reference or verify the file.
+func (e S3Emitter) put(b Buffer, t Transformer, shardID string) (string, string, error) {
+	bucket := e.bucket()
+	s3File := e.bufferFileName(b)
+	body := e.body(b, t)
 
 	var err error
 	for i := 0; i < 10; i++ {
@@ -55,7 +66,7 @@ func (e S3Emitter) Emit(b Buffer, t Transformer, shardID string) error {
 		// s3 file has not appeared to the database yet
 		HandleAwsWaitTimeExp(i, "s3 emitter on shard "+shardID)
 
-		err = bucket.Put(s3File, buffer.Bytes(), "text/plain", s3.Private, s3.Options{})
+		err = bucket.Put(s3File, body, "text/plain", s3.Private, s3.Options{})
 
 		if err == nil || IsRecoverableError(err) == false {
 			l4g.Fine("exiting loop")
@@ -69,9 +80,29 @@ func (e S3Emitter) Emit(b Buffer, t Transformer, shardID string) error {
 
 	if err != nil {
 		l4g.Error("S3Put ERROR: %v", err)
-		return err
+		return "", "", err
 	} else {
 		l4g.Debug("[%v] records emitted to [s3://%v/%v] on shard [%v]", b.NumRecordsInBuffer(), e.S3Bucket, s3File, shardID)
 	}
-	return nil
+	sum := md5.Sum(body)
+	return s3File, hex.EncodeToString(sum[:]), nil
+}
+
+// body serializes the buffered records into the contents of the S3 file.
+func (e S3Emitter) body(b Buffer, t Transformer) []byte {
+	var buffer bytes.Buffer
+
+	for _, r := range b.Records() {
+		var s = t.FromRecord(r)
+		buffer.Write(s)
+	}
+	return buffer.Bytes()
+}
+
+func (e S3Emitter) bucket() *s3.Bucket {
+	auth, _ := aws.EnvAuth()
+	s3Con := s3.New(auth, aws.USEast)
+	s3Con.ReadTimeout = time.Second * 300
+	s3Con.ConnectTimeout = time.Second * 10
+	return s3Con.Bucket(e.S3Bucket)
 }
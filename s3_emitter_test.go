@@ -2,6 +2,8 @@ package connector
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -27,3 +29,39 @@ func TestS3FileName(t *testing.T) {
 	}
 
 }
+
+// fileNameEmitter records the file names its S3Emitter would upload the buffers to.
+type fileNameEmitter struct {
+	S3Emitter
+	names []string
+}
+
+func (e *fileNameEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	e.names = append(e.names, e.bufferFileName(b))
+	return nil
+}
+
+func TestS3BufferFileName(t *testing.T) {
+	d := time.Now().UTC().Format("2006/01/02")
+	e := S3Emitter{S3Bucket: "bucket", S3Prefix: "prefix"}
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	b.ProcessRecord("click:1", "1", 0)
+	b.ProcessRecord("view/page:1", "2", 0)
+
+	if got, want := e.bufferFileName(b), fmt.Sprintf("prefix/%v/1-2", d); got != want {
+		t.Errorf("bufferFileName() = %v want %v", got, want)
+	}
+
+	routes := &fileNameEmitter{S3Emitter: e}
+	r := RoutingEmitter{
+		Key:        func(r interface{}) string { return strings.Split(r.(string), ":")[0] },
+		NewEmitter: func(key string) (Emitter, error) { return routes, nil },
+	}
+	r.Emit(b, StringToStringTransformer{}, "shard")
+
+	want := []string{fmt.Sprintf("prefix/%v/1-2-click", d), fmt.Sprintf("prefix/%v/1-2-view%%2Fpage", d)}
+	if !reflect.DeepEqual(routes.names, want) {
+		t.Errorf("route bufferFileName() = %v want %v", routes.names, want)
+	}
+}
@@ -1,38 +1,81 @@
 package connector
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/ezoic/go-kinesis"
 	l4g "github.com/ezoic/log4go"
 )
 
 // An implementation of Emitter that puts event data on S3 file, and then puts the
 // S3 file path onto the output stream for processing by manifest application.
+//
+// The path is only published once a HEAD of the object returns the ETag of the uploaded
+// contents, so the manifest application never sees a file that is not there. Paths are
+// partitioned by the source shard, which keeps the files of one shard in order on the
+// output stream.
 type S3ManifestEmitter struct {
 	OutputStream string
 	S3Bucket     string
+	S3Prefix     string
 	Ksis         *kinesis.Kinesis
 }
 
 func (e S3ManifestEmitter) Emit(b Buffer, t Transformer, shardID string) error {
 
 	// Emit buffer contents to S3 Bucket
-	s3Emitter := S3Emitter{S3Bucket: e.S3Bucket}
-	s3Emitter.Emit(b, t, shardID)
-	s3File := s3Emitter.S3FileName(b.FirstSequenceNumber(), b.LastSequenceNumber())
+	s3Emitter := S3Emitter{S3Bucket: e.S3Bucket, S3Prefix: e.S3Prefix}
+	s3File, md5Hex, err := s3Emitter.put(b, t, shardID)
+	if err != nil {
+		return err
+	}
 
-	// Emit the file path to Kinesis Output stream
-	args := kinesis.NewArgs()
-	args.Add("StreamName", e.OutputStream)
-	args.Add("PartitionKey", s3File)
-	args.AddData([]byte(s3File))
+	if err = e.verifyUpload(s3Emitter, s3File, md5Hex, shardID); err != nil {
+		l4g.Error("S3 upload verification ERROR: %v", err)
+		return err
+	}
 
-	_, err := e.Ksis.PutRecord(args)
+	// Emit the file path to Kinesis Output stream
+	records := []kinesisPutRecord{{Data: []byte(s3File), PartitionKey: shardID}}
+	err = putRecords(e.Ksis, e.OutputStream, records, "s3 manifest emitter on shard "+shardID)
 
 	if err != nil {
-		l4g.Error("PutRecord ERROR: %v", err)
+		l4g.Error("PutRecords ERROR: %v", err)
 		return err
 	} else {
-		l4g.Info("[%s] emitted to [%s] on shard [%v]", b.FirstSequenceNumber(), e.OutputStream, shardID)
+		l4g.Info("[%s] emitted to [%s] on shard [%v]", s3File, e.OutputStream, shardID)
 	}
 	return nil
 }
+
+// verifyUpload checks with a HEAD request that s3File exists with the expected MD5.
+func (e S3ManifestEmitter) verifyUpload(s3Emitter S3Emitter, s3File string, md5Hex string, shardID string) error {
+	bucket := s3Emitter.bucket()
+
+	var err error
+	for i := 0; i < 5; i++ {
+		HandleAwsWaitTimeExp(i, "s3 manifest emitter verification on shard "+shardID)
+
+		resp, herr := bucket.Head(s3File, nil)
+		if herr != nil {
+			err = herr
+			if IsRecoverableError(err) {
+				continue
+			}
+			return err
+		}
+		resp.Body.Close()
+
+		if etagMatches(resp.Header.Get("ETag"), md5Hex) {
+			return nil
+		}
+		err = fmt.Errorf("s3://%s/%s has ETag %s, expected %s", e.S3Bucket, s3File, resp.Header.Get("ETag"), md5Hex)
+	}
+	return err
+}
+
+// etagMatches compares an S3 ETag header with the hex MD5 of a single part upload.
+func etagMatches(etag string, md5Hex string) bool {
+	return strings.EqualFold(strings.Trim(etag, `"`), md5Hex)
+}
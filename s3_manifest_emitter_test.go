@@ -0,0 +1,23 @@
+package connector
+
+import "testing"
+
+func TestEtagMatches(t *testing.T) {
+	testCases := []struct {
+		etag    string
+		md5Hex  string
+		matches bool
+	}{
+		{etag: `"d41d8cd98f00b204e9800998ecf8427e"`, md5Hex: "d41d8cd98f00b204e9800998ecf8427e", matches: true},
+		{etag: `"D41D8CD98F00B204E9800998ECF8427E"`, md5Hex: "d41d8cd98f00b204e9800998ecf8427e", matches: true},
+		{etag: "d41d8cd98f00b204e9800998ecf8427e", md5Hex: "d41d8cd98f00b204e9800998ecf8427e", matches: true},
+		{etag: `"0cc175b9c0f1b6a831c399e269772661"`, md5Hex: "d41d8cd98f00b204e9800998ecf8427e", matches: false},
+		{etag: "", md5Hex: "d41d8cd98f00b204e9800998ecf8427e", matches: false},
+	}
+
+	for idx, tc := range testCases {
+		if r := etagMatches(tc.etag, tc.md5Hex); r != tc.matches {
+			t.Errorf("test case %d: etagMatches(%v, %v) = %v want %v", idx, tc.etag, tc.md5Hex, r, tc.matches)
+		}
+	}
+}
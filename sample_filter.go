@@ -0,0 +1,56 @@
+package connector
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// SampleFilter keeps a random fraction Rate of the records, between 0 and 1.
+type SampleFilter struct {
+	Rate float64
+}
+
+// KeepRecord returns true for a random fraction Rate of the records.
+func (f SampleFilter) KeepRecord(r interface{}) bool {
+	return rand.Float64() < f.Rate
+}
+
+// HashSampleFilter keeps a fraction Rate of the records, chosen by a hash of their key, so
+// that every record with the same key, e.g. a user id, is either kept or dropped on every
+// connector and every replay.
+type HashSampleFilter struct {
+	Rate float64
+
+	// Key returns the key of a record. When nil, the key is the value at Field.
+	Key func(r interface{}) string
+
+	// Field is the path of the key in the record, as in expression filters, e.g. user.id.
+	Field string
+}
+
+// KeepRecord returns true if the hash of r's key falls within Rate.
+func (f HashSampleFilter) KeepRecord(r interface{}) bool {
+	var key string
+	if f.Key != nil {
+		key = f.Key(r)
+	} else {
+		v, ok := lookupPath(decodeRecord(r), splitPath(f.Field))
+		if !ok {
+			return false
+		}
+		key = fmt.Sprint(v)
+	}
+	return hashSample(key, f.Rate)
+}
+
+// hashSample reports whether key hashes into the lowest fraction rate of the hash space.
+func hashSample(key string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	sum := md5.Sum([]byte(key))
+	return float64(binary.BigEndian.Uint64(sum[:8])) < rate*math.MaxUint64
+}
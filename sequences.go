@@ -2,67 +2,181 @@ package connector
 
 import (
 	"sort"
+	"strings"
 
 	l4g "github.com/ezoic/log4go"
-	"github.com/shopspring/decimal"
 )
 
-type SequenceList []decimal.Decimal
-
-func (s SequenceList) Len() int {
-	return len(s)
+// SequenceRange is a run of sequence numbers, from First to Last inclusive, that were
+// appended in ascending order.
+type SequenceRange struct {
+	First string
+	Last  string
 }
-func (s SequenceList) Less(i, j int) bool {
-	return s[i].Cmp(s[j]) < 0
+
+// SequenceGap lies strictly between two processed ranges. Sequence numbers in it have not
+// been appended, though Kinesis may never have assigned any of them.
+type SequenceGap struct {
+	After  string
+	Before string
 }
-func (s SequenceList) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
+
+// SequenceList tracks the sequence numbers processed on a shard as sorted, disjoint ranges.
+//
+// Kinesis delivers a shard's records in ascending sequence number order but the numbers are
+// not consecutive, so a range stands for a run of in-order deliveries: every number between
+// First and Last was either processed or never assigned. A number appended below the previous
+// one is out of order and starts a new range, as does one that skips over an existing range,
+// and the space between ranges is reported as a gap. Sequence numbers are compared as decimal
+// strings, without parsing.
+//
+// The zero value is an empty list.
+type SequenceList struct {
+	ranges     []SequenceRange
+	tail       int // index of the range holding the last appended number
+	last       string
+	count      int
+	outOfOrder int
 }
 
-func (s SequenceList) Append(v string) SequenceList {
-	vd, err := decimal.NewFromString(v)
-	if err != nil {
-		l4g.Warn("cannot convert %s to decimal: %s", v, err.Error())
-		return s
+// Append records v as processed. It returns false if v was already covered by a range, or is
+// not a valid sequence number.
+func (s *SequenceList) Append(v string) bool {
+	v, ok := normalizeSequenceNumber(v)
+	if !ok {
+		l4g.Warn("cannot append invalid sequence number %q", v)
+		return false
 	}
 
-	fi := sort.Search(len(s), func(i int) bool {
-		return s[i].Cmp(vd) >= 0
-	})
-	if fi < len(s) && s[fi].Cmp(vd) == 0 {
-		// we found the element, do nothing
-	} else {
-		s = append(s, vd)
-		copy(s[fi+1:], s[fi:])
-		s[fi] = vd
-
-		if len(s) > 2 {
-			s[1] = s[len(s)-1]
-			s = s[:2]
+	late := s.count > 0 && compareNormalized(v, s.last) < 0
+	if late {
+		s.outOfOrder++
+	}
+
+	i := s.search(v)
+	if i < len(s.ranges) && compareNormalized(s.ranges[i].First, v) <= 0 {
+		if late {
+			l4g.Debug("late sequence number %v falls within the processed range [%v-%v]", v, s.ranges[i].First, s.ranges[i].Last)
 		}
+		return false
+	}
+
+	s.count++
+	s.last = v
+
+	if len(s.ranges) > 0 && i == s.tail+1 {
+		// v follows the last appended number with no range in between
+		s.ranges[s.tail].Last = v
+		return true
 	}
-	return s
+
+	s.ranges = append(s.ranges, SequenceRange{})
+	copy(s.ranges[i+1:], s.ranges[i:])
+	s.ranges[i] = SequenceRange{First: v, Last: v}
+	s.tail = i
+	return true
 }
 
-func (s SequenceList) SequenceExists(v string) bool {
-	vd, err := decimal.NewFromString(v)
-	if err != nil {
-		l4g.Warn("cannot convert %s to decimal: %s", v, err.Error())
+// SequenceExists reports whether v falls within a processed range. Invalid sequence numbers
+// are reported as existing so that they are skipped.
+func (s *SequenceList) SequenceExists(v string) bool {
+	v, ok := normalizeSequenceNumber(v)
+	if !ok {
+		l4g.Warn("cannot look up invalid sequence number %q", v)
 		return true
 	}
+	i := s.search(v)
+	return i < len(s.ranges) && compareNormalized(s.ranges[i].First, v) <= 0
+}
+
+// Len returns the number of distinct sequence numbers appended.
+func (s *SequenceList) Len() int {
+	return s.count
+}
+
+// OutOfOrder returns how many sequence numbers were appended below the last one accepted,
+// including those rejected because they fell within a processed range.
+func (s *SequenceList) OutOfOrder() int {
+	return s.outOfOrder
+}
+
+// Ranges returns the processed ranges in ascending order.
+func (s *SequenceList) Ranges() []SequenceRange {
+	return append([]SequenceRange(nil), s.ranges...)
+}
+
+// Gaps returns the space between consecutive processed ranges, in ascending order.
+func (s *SequenceList) Gaps() []SequenceGap {
+	var gaps []SequenceGap
+	for i := 1; i < len(s.ranges); i++ {
+		gaps = append(gaps, SequenceGap{After: s.ranges[i-1].Last, Before: s.ranges[i].First})
+	}
+	return gaps
+}
+
+// Contiguous reports whether the processed sequence numbers form a single range.
+func (s *SequenceList) Contiguous() bool {
+	return len(s.ranges) <= 1
+}
+
+// Min returns the lowest sequence number appended, or "" when the list is empty.
+func (s *SequenceList) Min() string {
+	if len(s.ranges) == 0 {
+		return ""
+	}
+	return s.ranges[0].First
+}
+
+// Max returns the highest sequence number appended, or "" when the list is empty.
+func (s *SequenceList) Max() string {
+	if len(s.ranges) == 0 {
+		return ""
+	}
+	return s.ranges[len(s.ranges)-1].Last
+}
+
+// Reset empties the list, keeping its storage.
+func (s *SequenceList) Reset() {
+	*s = SequenceList{ranges: s.ranges[:0]}
+}
 
-	fi := sort.Search(len(s), func(i int) bool {
-		return s[i].Cmp(vd) >= 0
+// search returns the index of the first range ending at or after v.
+func (s *SequenceList) search(v string) int {
+	return sort.Search(len(s.ranges), func(i int) bool {
+		return compareNormalized(s.ranges[i].Last, v) >= 0
 	})
+}
+
+// normalizeSequenceNumber strips leading zeros from v and reports whether it is made of digits.
+func normalizeSequenceNumber(v string) (string, bool) {
+	if v == "" {
+		return v, false
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] < '0' || v[i] > '9' {
+			return v, false
+		}
+	}
+	if v = strings.TrimLeft(v, "0"); v == "" {
+		v = "0"
+	}
+	return v, true
+}
 
-	inList := false
-	if fi == len(s) {
-		inList = false
-	} else if fi == 0 && s[0].Cmp(vd) != 0 {
-		inList = false
-	} else {
-		inList = true
+// compareNormalized compares sequence numbers without leading zeros.
+func compareNormalized(a string, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
 	}
+	return strings.Compare(a, b)
+}
 
-	return inList
+// CompareSequenceNumbers compares two Kinesis sequence numbers numerically, returning
+// -1, 0 or 1. Sequence numbers are unsigned decimal strings too long for any integer type,
+// so they are compared by length first and then lexically.
+func CompareSequenceNumbers(a string, b string) int {
+	return compareNormalized(strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0"))
 }
@@ -1,172 +1,137 @@
 package connector
 
 import (
-	"sort"
+	"reflect"
 	"testing"
-
-	"github.com/shopspring/decimal"
 )
 
 func Test_SequencesList(t *testing.T) {
+	var s SequenceList
 
-	s := make(SequenceList, 0)
-
-	// put the first element into the list
-	s = s.Append("123")
-	if len(s) != 1 {
-		t.Fatalf("expected len(s)=1, got %v", len(s))
-	}
-	if s.SequenceExists("123") == false {
-		t.Fatalf("expected abc to exist in sequence list")
-	}
-	if s.SequenceExists("999") == true {
-		t.Fatalf("expected lll not to exist in sequence list")
+	appends := []struct {
+		v    string
+		want bool
+	}{
+		{"123", true},
+		{"123", false},
+		{"0123", false},
+		{"125", true},
+		{"124", false}, // between in-order deliveries, so never assigned
+		{"121", true},
+		{"122", true},
+		{"130", true},
+		{"127", true},
+		{"abc", false},
+	}
+	for _, a := range appends {
+		if got := s.Append(a.v); got != a.want {
+			t.Errorf("Append(%v) = %v want %v", a.v, got, a.want)
+		}
 	}
 
-	// put the sequence into the list again, it shouldn't actually ad it
-	s = s.Append("123")
-	if len(s) != 1 {
-		t.Fatalf("expected len(s)=1, got %v", len(s))
-	}
-	if s.SequenceExists("123") == false {
-		t.Fatalf("expected abc to exist in sequence list")
+	if got, want := s.Len(), 6; got != want {
+		t.Errorf("Len() = %v want %v", got, want)
 	}
-	if s.SequenceExists("999") == true {
-		t.Fatalf("expected lll not to exist in sequence list")
+	// 124, 121 and 127 arrived below the number before them, though 124 was rejected
+	if got, want := s.OutOfOrder(), 3; got != want {
+		t.Errorf("OutOfOrder() = %v want %v", got, want)
 	}
-
-	// put an element into the list that would go to the front of the array
-	s = s.Append("121")
-	if len(s) != 2 {
-		t.Fatalf("expected len(s)=1, got %v", len(s))
-	}
-	if s.SequenceExists("123") == false {
-		t.Fatalf("expected abc to exist in sequence list")
+	// 130 skips over 123-125 after 122, so it and the late 127 start ranges of their own
+	wantRanges := []SequenceRange{{"121", "122"}, {"123", "125"}, {"127", "127"}, {"130", "130"}}
+	if got := s.Ranges(); !reflect.DeepEqual(got, wantRanges) {
+		t.Errorf("Ranges() = %v want %v", got, wantRanges)
 	}
-	if s.SequenceExists("121") == false {
-		t.Fatalf("expected aba to exist in sequence list")
+	wantGaps := []SequenceGap{{After: "122", Before: "123"}, {After: "125", Before: "127"}, {After: "127", Before: "130"}}
+	if got := s.Gaps(); !reflect.DeepEqual(got, wantGaps) {
+		t.Errorf("Gaps() = %v want %v", got, wantGaps)
 	}
-	if s.SequenceExists("999") == true {
-		t.Fatalf("expected lll not to exist in sequence list")
+	if s.Contiguous() {
+		t.Errorf("Contiguous() = %v want %v", true, false)
 	}
-	if s[0].Cmp(decimal.New(121, 0)) != 0 || s[1].Cmp(decimal.New(123, 0)) != 0 {
-		t.Fatalf("bad list: %+v", s)
+	if got, want := s.Min(), "121"; got != want {
+		t.Errorf("Min() = %v want %v", got, want)
 	}
-	if sort.IsSorted(s) == false {
-		t.Fatalf("not sorted, uh oh")
+	if got, want := s.Max(), "130"; got != want {
+		t.Errorf("Max() = %v want %v", got, want)
 	}
 
-	// put an element into the list that would go to the end of the array
-	s = s.Append("124")
-	if len(s) != 2 {
-		t.Fatalf("expected len(s)=2, got %v", len(s))
-	}
-	if s.SequenceExists("123") == false {
-		t.Fatalf("expected abc to exist in sequence list")
-	}
-	if s.SequenceExists("121") == false {
-		t.Fatalf("expected aba to exist in sequence list")
-	}
-	if s.SequenceExists("124") == false {
-		t.Fatalf("expected abd to exist in sequence list")
-	}
-	if s.SequenceExists("999") == true {
-		t.Fatalf("expected lll not to exist in sequence list")
-	}
-	if s[0].Cmp(decimal.New(121, 0)) != 0 || s[1].Cmp(decimal.New(124, 0)) != 0 {
-		t.Fatalf("bad list: %+v", s)
-	}
-	if sort.IsSorted(s) == false {
-		t.Fatalf("not sorted, uh oh")
+	exists := []struct {
+		v    string
+		want bool
+	}{
+		{"121", true},
+		{"122", true},
+		{"123", true},
+		{"124", true},
+		{"126", false},
+		{"130", true},
+		{"120", false},
+		{"131", false},
+		{"999", false},
+		{"abc", true},
+	}
+	for _, e := range exists {
+		if got := s.SequenceExists(e.v); got != e.want {
+			t.Errorf("SequenceExists(%v) = %v want %v", e.v, got, e.want)
+		}
 	}
 
-	// put an element into the list that would go to the middle of the array
-	s = s.Append("122")
-	if len(s) != 2 {
-		t.Fatalf("expected len(s)=1, got %v", len(s))
-	}
-	if s.SequenceExists("123") == false {
-		t.Fatalf("expected abc to exist in sequence list")
-	}
-	if s.SequenceExists("121") == false {
-		t.Fatalf("expected aba to exist in sequence list")
-	}
-	if s.SequenceExists("124") == false {
-		t.Fatalf("expected abd to exist in sequence list")
-	}
-	if s.SequenceExists("122") == false {
-		t.Fatalf("expected abb to exist in sequence list")
-	}
-	if s.SequenceExists("999") == true {
-		t.Fatalf("expected lll not to exist in sequence list")
-	}
-	if s[0].Cmp(decimal.New(121, 0)) != 0 || s[1].Cmp(decimal.New(124, 0)) != 0 {
-		t.Fatalf("bad list: %+v", s)
-	}
-	if sort.IsSorted(s) == false {
-		t.Fatalf("not sorted, uh oh")
+	s.Reset()
+	if s.Len() != 0 || s.SequenceExists("123") || len(s.Ranges()) != 0 {
+		t.Errorf("Reset() left %v", s.Ranges())
 	}
+}
 
-	// put an element into the list that would go at the beginning
-	s = s.Append("120")
-	if len(s) != 2 {
-		t.Fatalf("expected len(s)=1, got %v", len(s))
-	}
-	if s.SequenceExists("123") == false {
-		t.Fatalf("expected abc to exist in sequence list")
-	}
-	if s.SequenceExists("121") == false {
-		t.Fatalf("expected aba to exist in sequence list")
-	}
-	if s.SequenceExists("124") == false {
-		t.Fatalf("expected abd to exist in sequence list")
-	}
-	if s.SequenceExists("122") == false {
-		t.Fatalf("expected abb to exist in sequence list")
-	}
-	if s.SequenceExists("120") == false {
-		t.Fatalf("expected abb to exist in sequence list")
-	}
-	if s.SequenceExists("999") == true {
-		t.Fatalf("expected lll not to exist in sequence list")
-	}
-	if s[0].Cmp(decimal.New(120, 0)) != 0 || s[1].Cmp(decimal.New(124, 0)) != 0 {
-		t.Fatalf("bad list: %+v", s)
-	}
-	if sort.IsSorted(s) == false {
-		t.Fatalf("not sorted, uh oh")
+func Test_SequencesListSkipsRange(t *testing.T) {
+	var s SequenceList
+	for _, v := range []string{"7", "8", "9", "1", "2", "3", "5", "10"} {
+		s.Append(v)
 	}
 
-	// put an element into the list that would go at the beginning
-	s = s.Append("129")
-	if len(s) != 2 {
-		t.Fatalf("expected len(s)=1, got %v", len(s))
-	}
-	if s.SequenceExists("123") == false {
-		t.Fatalf("expected abc to exist in sequence list")
-	}
-	if s.SequenceExists("121") == false {
-		t.Fatalf("expected aba to exist in sequence list")
+	// 5 follows 3 in order, 10 skips over the range 7-9 and starts its own
+	wantRanges := []SequenceRange{{"1", "5"}, {"7", "9"}, {"10", "10"}}
+	if got := s.Ranges(); !reflect.DeepEqual(got, wantRanges) {
+		t.Errorf("Ranges() = %v want %v", got, wantRanges)
 	}
-	if s.SequenceExists("124") == false {
-		t.Fatalf("expected abd to exist in sequence list")
+	if got, want := s.OutOfOrder(), 1; got != want {
+		t.Errorf("OutOfOrder() = %v want %v", got, want)
 	}
-	if s.SequenceExists("122") == false {
-		t.Fatalf("expected abb to exist in sequence list")
-	}
-	if s.SequenceExists("120") == false {
-		t.Fatalf("expected abb to exist in sequence list")
+}
+
+func Test_SequencesListInOrder(t *testing.T) {
+	var s SequenceList
+	seqs := []string{
+		"49546986683135544286507457936321625675700192471156785154",
+		"49546986683135544286507457936321625675700192471156785155",
+		"49546986683135544286507457936321625675700192471156785200",
+		"49546986683135544286507457936321625675700192471156786000",
 	}
-	if s.SequenceExists("129") == false {
-		t.Fatalf("expected abb to exist in sequence list")
+	for _, v := range seqs {
+		s.Append(v)
 	}
-	if s.SequenceExists("999") == true {
-		t.Fatalf("expected lll not to exist in sequence list")
+	if !s.Contiguous() || s.OutOfOrder() != 0 || len(s.Gaps()) != 0 {
+		t.Errorf("in-order appends gave ranges %v, %d out of order", s.Ranges(), s.OutOfOrder())
 	}
-	if s[0].Cmp(decimal.New(120, 0)) != 0 || s[1].Cmp(decimal.New(129, 0)) != 0 {
-		t.Fatalf("bad list: %+v", s)
+}
+
+func Test_CompareSequenceNumbers(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		cmp  int
+	}{
+		{a: "123", b: "123", cmp: 0},
+		{a: "122", b: "123", cmp: -1},
+		{a: "124", b: "123", cmp: 1},
+		{a: "99", b: "123", cmp: -1},
+		{a: "0123", b: "123", cmp: 0},
+		{a: "49546986683135544286507457936321625675700192471156785154", b: "49546986683135544286507457936321625675700192471156785155", cmp: -1},
+		{a: "", b: "1", cmp: -1},
 	}
-	if sort.IsSorted(s) == false {
-		t.Fatalf("not sorted, uh oh")
+
+	for idx, tc := range testCases {
+		r := CompareSequenceNumbers(tc.a, tc.b)
+		if r != tc.cmp {
+			t.Errorf("test case %d: CompareSequenceNumbers(%v, %v) = %v, want %v", idx, tc.a, tc.b, r, tc.cmp)
+		}
 	}
 }
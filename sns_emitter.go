@@ -0,0 +1,86 @@
+package connector
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/AdRoll/goamz/aws"
+	l4g "github.com/ezoic/log4go"
+)
+
+// SNSEmitter is an implementation of Emitter that publishes each buffered record as a message to
+// an SNS topic with PublishBatch. Entries rejected in a response are retried on their own,
+// unless SNS reports the failure as the sender's fault.
+type SNSEmitter struct {
+	TopicArn string
+	Region   string
+
+	// Endpoint overrides the SNS endpoint for the region, e.g. to use a local stand-in.
+	Endpoint string
+
+	// Auth signs requests. When nil, credentials are read from the environment on every Emit.
+	Auth *aws.Auth
+
+	// MessageGroupID returns the message group of a record on a FIFO topic. When nil, the
+	// source shard ID is used for topics whose name ends in .fifo.
+	MessageGroupID func(record interface{}, data []byte) string
+
+	// MessageDeduplicationID returns the deduplication ID of a record on a FIFO topic. When nil,
+	// the topic must have content-based deduplication enabled.
+	MessageDeduplicationID func(record interface{}, data []byte) string
+}
+
+type snsPublishBatchResponse struct {
+	Failed []batchEntryFailure `xml:"PublishBatchResult>Failed>member"`
+}
+
+// Emit is invoked when the buffer is full. It publishes every buffered record to TopicArn.
+func (e SNSEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	client, err := newAwsClient("sns", e.Region, e.Endpoint, e.Auth)
+	if err != nil {
+		return err
+	}
+
+	fifo := strings.HasSuffix(e.TopicArn, ".fifo")
+	entries, sizes := messageEntries(b, t, shardID, fifo, e.MessageGroupID, e.MessageDeduplicationID)
+
+	infoString := "sns emitter on shard " + shardID
+	for _, r := range batchRanges(sizes, maxMessageBatchCount, maxMessageBatchSize) {
+		err = sendWithRetry(indexes(r[0], r[1]), func(ids []int) ([]int, error) {
+			return e.publishBatch(client, entries, ids)
+		}, infoString)
+		if err != nil {
+			l4g.Error("PublishBatch ERROR: %v", err)
+			return err
+		}
+	}
+
+	l4g.Info("[%v] records published to [%s] on shard [%v]", b.NumRecordsInBuffer(), e.TopicArn, shardID)
+	return nil
+}
+
+func (e SNSEmitter) publishBatch(client *awsClient, entries []messageEntry, ids []int) ([]int, error) {
+	params := url.Values{}
+	params.Set("Action", "PublishBatch")
+	params.Set("Version", "2010-03-31")
+	params.Set("TopicArn", e.TopicArn)
+	for n, id := range ids {
+		prefix := fmt.Sprintf("PublishBatchRequestEntries.member.%d.", n+1)
+		params.Set(prefix+"Id", strconv.Itoa(id))
+		params.Set(prefix+"Message", entries[id].Body)
+		if entries[id].GroupID != "" {
+			params.Set(prefix+"MessageGroupId", entries[id].GroupID)
+		}
+		if entries[id].DeduplicationID != "" {
+			params.Set(prefix+"MessageDeduplicationId", entries[id].DeduplicationID)
+		}
+	}
+
+	var resp snsPublishBatchResponse
+	if err := client.callQuery(client.Endpoint, params, &resp); err != nil {
+		return nil, err
+	}
+	return failedEntries(resp.Failed)
+}
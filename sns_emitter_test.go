@@ -0,0 +1,33 @@
+package connector
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSNSEmitter(t *testing.T) {
+	var calls [][]string
+	server := queryStandIn(t, "PublishBatch", "PublishBatchRequestEntries.member", &calls)
+	defer server.Close()
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	for i, s := range []string{"a", "b", "c"} {
+		b.ProcessRecord(s, fmt.Sprint(i+1), 0)
+	}
+
+	e := SNSEmitter{
+		TopicArn:       "arn:aws:sns:us-east-1:123456789012:topic",
+		Endpoint:       server.URL,
+		Auth:           testAwsAuth,
+		MessageGroupID: func(r interface{}, data []byte) string { return "g" },
+	}
+	if err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+
+	want := [][]string{{"a/g/", "b/g/", "c/g/"}, {"b/g/"}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("PublishBatch calls = %q want %q", calls, want)
+	}
+}
@@ -0,0 +1,334 @@
+package connector
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	l4g "github.com/ezoic/log4go"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/stdlib"
+)
+
+// SQLDialect selects the SQL flavour a SQLEmitter writes.
+type SQLDialect string
+
+// Dialects supported by SQLEmitter.
+const (
+	SQLPostgres SQLDialect = "postgres"
+	SQLMysql    SQLDialect = "mysql"
+)
+
+// maxSQLParameters is the bind parameter limit of both Postgres and MySQL statements.
+const maxSQLParameters = 65535
+
+// SQLEmitter is an implementation of Emitter that writes the buffered records straight into a
+// Postgres or MySQL table, for sinks too small to be worth staging in S3. Each buffer is written
+// in one transaction with multi-row INSERTs or, for Postgres through pgx, COPY FROM STDIN.
+// Recoverable errors retry the whole transaction with the aws backoff.
+type SQLEmitter struct {
+	Db        *sql.DB
+	Dialect   SQLDialect
+	TableName string
+	Columns   []string
+
+	// Row maps a record to its values, in the order of Columns.
+	Row func(record interface{}) ([]interface{}, error)
+
+	// BatchSize caps the rows per INSERT statement, 1000 when zero.
+	BatchSize int
+
+	// Copy loads Postgres tables with COPY FROM STDIN instead of INSERT. Db must have been
+	// opened with the pgx driver.
+	Copy bool
+
+	// Upsert updates existing rows instead of failing on duplicate keys, with ON CONFLICT for
+	// Postgres and ON DUPLICATE KEY UPDATE for MySQL. Within one buffer the last record for a
+	// key wins.
+	Upsert bool
+
+	// ConflictColumns is the key Postgres checks for conflicts, required by Postgres upserts
+	// that update rows. MySQL uses the table's unique keys, but rows in a buffer are still
+	// deduplicated on ConflictColumns when set.
+	ConflictColumns []string
+
+	// UpdateColumns are overwritten on conflict. When nil, every column not in ConflictColumns
+	// is; when there are none, conflicting rows are left as they are.
+	UpdateColumns []string
+}
+
+// Emit is invoked when the buffer is full. It writes every buffered record to TableName.
+func (e SQLEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	rows, err := e.rows(b.Records())
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	for i := 0; i < 10; i++ {
+		HandleAwsWaitTimeExp(i, "sql emitter on shard "+shardID)
+
+		if e.Copy && e.Dialect == SQLPostgres {
+			err = e.copy(rows)
+		} else {
+			err = e.insert(rows)
+		}
+
+		// if the request succeeded, or its an unrecoverable error, break out of the loop
+		// because we are done
+		if err == nil || IsRecoverableError(err) == false {
+			break
+		}
+
+		l4g.Warn("recoverable sql error %v on shard [%v]", err, shardID)
+	}
+
+	if err != nil {
+		l4g.Error("SQL emitter ERROR: %v", err)
+		return err
+	}
+
+	l4g.Info("[%v] records written to [%s] as [%v] rows on shard [%v]", b.NumRecordsInBuffer(), e.TableName, len(rows), shardID)
+	return nil
+}
+
+// validate reports configurations no statement can be built for.
+func (e SQLEmitter) validate() error {
+	if e.Dialect != SQLPostgres && e.Dialect != SQLMysql {
+		return fmt.Errorf("unknown sql emitter dialect %q", e.Dialect)
+	}
+	if len(e.Columns) == 0 {
+		return fmt.Errorf("sql emitter for %s has no Columns", e.TableName)
+	}
+	if e.Row == nil {
+		return fmt.Errorf("sql emitter for %s has no Row function", e.TableName)
+	}
+	if e.Upsert && e.Dialect == SQLPostgres && len(e.ConflictColumns) == 0 && len(e.updateColumns()) > 0 {
+		// ON CONFLICT DO UPDATE needs a conflict target
+		return fmt.Errorf("sql emitter upserts into %s need ConflictColumns to update rows", e.TableName)
+	}
+	return nil
+}
+
+// rows maps the records to rows. When upserting, only the last row for each conflict key is
+// kept, in the position of the first, since a statement may not update a row twice.
+func (e SQLEmitter) rows(records []interface{}) ([][]interface{}, error) {
+	var keyIdx []int
+	if e.Upsert {
+		for _, c := range e.ConflictColumns {
+			idx := indexOfColumn(e.Columns, c)
+			if idx < 0 {
+				return nil, fmt.Errorf("conflict column %s is not one of the sql emitter's columns", c)
+			}
+			keyIdx = append(keyIdx, idx)
+		}
+	}
+
+	rows := make([][]interface{}, 0, len(records))
+	seen := map[string]int{}
+	for _, r := range records {
+		row, err := e.Row(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(row) != len(e.Columns) {
+			return nil, fmt.Errorf("sql emitter row has %d values for %d columns", len(row), len(e.Columns))
+		}
+
+		if len(keyIdx) > 0 {
+			key := make([]interface{}, len(keyIdx))
+			for i, idx := range keyIdx {
+				key[i] = row[idx]
+			}
+			k := fmt.Sprintf("%#v", key)
+			if pos, ok := seen[k]; ok {
+				rows[pos] = row
+				continue
+			}
+			seen[k] = len(rows)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (e SQLEmitter) insert(rows [][]interface{}) error {
+	tx, err := e.Db.Begin()
+	if err != nil {
+		return err
+	}
+
+	batchSize := e.BatchSize
+	if batchSize == 0 {
+		batchSize = 1000
+	}
+	if max := maxSQLParameters / len(e.Columns); batchSize > max {
+		batchSize = max
+	}
+
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		stmt, args := e.insertStmt(rows[start:end])
+		if _, err = tx.Exec(stmt, args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertStmt builds a multi-row INSERT of rows with its bind arguments.
+func (e SQLEmitter) insertStmt(rows [][]interface{}) (string, []interface{}) {
+	var stmt bytes.Buffer
+	args := make([]interface{}, 0, len(rows)*len(e.Columns))
+
+	stmt.WriteString("INSERT INTO " + e.quote(e.TableName) + " (" + e.columnList(e.Columns) + ") VALUES ")
+	for i, row := range rows {
+		if i > 0 {
+			stmt.WriteString(", ")
+		}
+		stmt.WriteString("(")
+		for j, v := range row {
+			if j > 0 {
+				stmt.WriteString(", ")
+			}
+			args = append(args, v)
+			if e.Dialect == SQLPostgres {
+				fmt.Fprintf(&stmt, "$%d", len(args))
+			} else {
+				stmt.WriteString("?")
+			}
+		}
+		stmt.WriteString(")")
+	}
+	stmt.WriteString(e.upsertClause())
+	return stmt.String(), args
+}
+
+// upsertClause is the conflict handling appended to INSERTs, empty unless upserting.
+func (e SQLEmitter) upsertClause() string {
+	if !e.Upsert {
+		return ""
+	}
+	update := e.updateColumns()
+
+	if e.Dialect == SQLPostgres {
+		clause := " ON CONFLICT"
+		if len(e.ConflictColumns) > 0 {
+			clause += " (" + e.columnList(e.ConflictColumns) + ")"
+		}
+		if len(update) == 0 {
+			return clause + " DO NOTHING"
+		}
+		sets := make([]string, len(update))
+		for i, c := range update {
+			sets[i] = e.quote(c) + " = EXCLUDED." + e.quote(c)
+		}
+		return clause + " DO UPDATE SET " + strings.Join(sets, ", ")
+	}
+
+	if len(update) == 0 {
+		// a self assignment leaves the existing row as it is
+		c := e.quote(e.Columns[0])
+		return " ON DUPLICATE KEY UPDATE " + c + " = " + c
+	}
+	sets := make([]string, len(update))
+	for i, c := range update {
+		sets[i] = e.quote(c) + " = VALUES(" + e.quote(c) + ")"
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+func (e SQLEmitter) updateColumns() []string {
+	if e.UpdateColumns != nil {
+		return e.UpdateColumns
+	}
+	var update []string
+	for _, c := range e.Columns {
+		if indexOfColumn(e.ConflictColumns, c) < 0 {
+			update = append(update, c)
+		}
+	}
+	return update
+}
+
+// copy loads rows with COPY FROM STDIN on a pgx connection taken from Db. Upserts COPY into a
+// temporary table first and merge it with an INSERT ... SELECT.
+func (e SQLEmitter) copy(rows [][]interface{}) error {
+	conn, err := stdlib.AcquireConn(e.Db)
+	if err != nil {
+		return err
+	}
+	defer stdlib.ReleaseConn(e.Db, conn)
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	target := pgx.Identifier(strings.Split(e.TableName, "."))
+	if e.Upsert {
+		stage := "stage_" + strings.Replace(e.TableName, ".", "_", -1)
+		target = pgx.Identifier{stage}
+		_, err = tx.Exec("CREATE TEMP TABLE " + e.quote(stage) + " (LIKE " + e.quote(e.TableName) + " INCLUDING DEFAULTS) ON COMMIT DROP")
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err = tx.CopyFrom(target, e.Columns, pgx.CopyFromRows(rows)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if e.Upsert {
+		if _, err = tx.Exec(e.mergeStmt(target[0])); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// mergeStmt inserts the rows of the stage table into TableName, handling conflicts as upserts.
+func (e SQLEmitter) mergeStmt(stage string) string {
+	columns := e.columnList(e.Columns)
+	return "INSERT INTO " + e.quote(e.TableName) + " (" + columns + ") SELECT " + columns + " FROM " + e.quote(stage) + e.upsertClause()
+}
+
+func (e SQLEmitter) columnList(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = e.quote(c)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// quote quotes a possibly schema qualified name for the dialect. Postgres does not fold quoted
+// names to lower case, so names must be given in the case they were created with.
+func (e SQLEmitter) quote(name string) string {
+	if e.Dialect == SQLPostgres {
+		return quoteRedshiftIdentifier(name)
+	}
+	return parseMysqlTableName(name).quoted()
+}
+
+func indexOfColumn(columns []string, c string) int {
+	for i, col := range columns {
+		if col == c {
+			return i
+		}
+	}
+	return -1
+}
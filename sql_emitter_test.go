@@ -0,0 +1,153 @@
+package connector
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	_ "github.com/jackc/pgx/stdlib"
+)
+
+type sqlTestEvent struct {
+	ID    int
+	Count int
+}
+
+func sqlTestRow(r interface{}) ([]interface{}, error) {
+	e := r.(sqlTestEvent)
+	return []interface{}{e.ID, e.Count}, nil
+}
+
+func TestSQLEmitterInsertStmt(t *testing.T) {
+	rows := [][]interface{}{{1, 10}, {2, 20}}
+	testCases := []struct {
+		emitter SQLEmitter
+		stmt    string
+	}{
+		{
+			emitter: SQLEmitter{Dialect: SQLPostgres, TableName: "test.events", Columns: []string{"id", "count"}},
+			stmt:    `INSERT INTO "test"."events" ("id", "count") VALUES ($1, $2), ($3, $4)`,
+		},
+		{
+			emitter: SQLEmitter{Dialect: SQLMysql, TableName: "test.events", Columns: []string{"id", "count"}},
+			stmt:    "INSERT INTO `test`.`events` (`id`, `count`) VALUES (?, ?), (?, ?)",
+		},
+		{
+			emitter: SQLEmitter{Dialect: SQLPostgres, TableName: "events", Columns: []string{"id", "count"}, Upsert: true, ConflictColumns: []string{"id"}},
+			stmt:    `INSERT INTO "events" ("id", "count") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "count" = EXCLUDED."count"`,
+		},
+		{
+			emitter: SQLEmitter{Dialect: SQLPostgres, TableName: "events", Columns: []string{"id", "count"}, Upsert: true, ConflictColumns: []string{"id", "count"}},
+			stmt:    `INSERT INTO "events" ("id", "count") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id", "count") DO NOTHING`,
+		},
+		{
+			emitter: SQLEmitter{Dialect: SQLMysql, TableName: "events", Columns: []string{"id", "count"}, Upsert: true},
+			stmt:    "INSERT INTO `events` (`id`, `count`) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE `id` = VALUES(`id`), `count` = VALUES(`count`)",
+		},
+		{
+			emitter: SQLEmitter{Dialect: SQLMysql, TableName: "events", Columns: []string{"id", "count"}, Upsert: true, UpdateColumns: []string{}},
+			stmt:    "INSERT INTO `events` (`id`, `count`) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE `id` = `id`",
+		},
+	}
+
+	for idx, tc := range testCases {
+		stmt, args := tc.emitter.insertStmt(rows)
+		if stmt != tc.stmt {
+			t.Errorf("test case %d: insertStmt() = %v want %v", idx, stmt, tc.stmt)
+		}
+		if want := []interface{}{1, 10, 2, 20}; !reflect.DeepEqual(args, want) {
+			t.Errorf("test case %d: insertStmt() args = %v want %v", idx, args, want)
+		}
+	}
+}
+
+func TestSQLEmitterMergeStmt(t *testing.T) {
+	e := SQLEmitter{Dialect: SQLPostgres, TableName: "test.events", Columns: []string{"id", "count"}, Upsert: true, ConflictColumns: []string{"id"}}
+	want := `INSERT INTO "test"."events" ("id", "count") SELECT "id", "count" FROM "stage_test_events" ON CONFLICT ("id") DO UPDATE SET "count" = EXCLUDED."count"`
+	if stmt := e.mergeStmt("stage_test_events"); stmt != want {
+		t.Errorf("mergeStmt() = %v want %v", stmt, want)
+	}
+}
+
+func TestSQLEmitterValidate(t *testing.T) {
+	testCases := []struct {
+		emitter SQLEmitter
+		isError bool
+	}{
+		{emitter: SQLEmitter{Dialect: SQLPostgres, Columns: []string{"id", "count"}, Row: sqlTestRow}},
+		{emitter: SQLEmitter{Dialect: "sqlite", Columns: []string{"id", "count"}, Row: sqlTestRow}, isError: true},
+		{emitter: SQLEmitter{Dialect: SQLPostgres, Columns: []string{"id", "count"}, Row: sqlTestRow, Upsert: true}, isError: true},
+		{emitter: SQLEmitter{Dialect: SQLPostgres, Columns: []string{"id", "count"}, Row: sqlTestRow, Upsert: true, UpdateColumns: []string{}}},
+		{emitter: SQLEmitter{Dialect: SQLPostgres, Columns: []string{"id", "count"}, Row: sqlTestRow, Upsert: true, ConflictColumns: []string{"id"}}},
+		{emitter: SQLEmitter{Dialect: SQLMysql, Columns: []string{"id", "count"}, Row: sqlTestRow, Upsert: true}},
+		{emitter: SQLEmitter{Dialect: SQLMysql, Row: sqlTestRow}, isError: true},
+		{emitter: SQLEmitter{Dialect: SQLMysql, Columns: []string{"id", "count"}}, isError: true},
+	}
+
+	for idx, tc := range testCases {
+		if err := tc.emitter.validate(); (err != nil) != tc.isError {
+			t.Errorf("test case %d: validate() = %v want error %v", idx, err, tc.isError)
+		}
+	}
+}
+
+func TestSQLEmitterRows(t *testing.T) {
+	records := []interface{}{sqlTestEvent{1, 10}, sqlTestEvent{2, 20}, sqlTestEvent{1, 11}}
+
+	e := SQLEmitter{Dialect: SQLPostgres, Columns: []string{"id", "count"}, Row: sqlTestRow}
+	rows, err := e.rows(records)
+	if want := [][]interface{}{{1, 10}, {2, 20}, {1, 11}}; err != nil || !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows() = %v, %v want %v", rows, err, want)
+	}
+
+	e.Upsert, e.ConflictColumns = true, []string{"id"}
+	rows, err = e.rows(records)
+	if want := [][]interface{}{{1, 11}, {2, 20}}; err != nil || !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows() upserting = %v, %v want %v", rows, err, want)
+	}
+
+	e.ConflictColumns = []string{"missing"}
+	if _, err = e.rows(records); err == nil {
+		t.Errorf("rows() with an unknown conflict column = nil error want an error")
+	}
+}
+
+func testSQLEmitter(t *testing.T, db *sql.DB, e SQLEmitter, create string) {
+	db.Exec("DROP TABLE IF EXISTS test_sql_emitter")
+	if _, err := db.Exec(create); err != nil {
+		t.Fatalf("cannot create table, %s", err)
+	}
+	defer db.Exec("DROP TABLE test_sql_emitter")
+
+	e.Db, e.TableName, e.Columns, e.Row = db, "test_sql_emitter", []string{"id", "count"}, sqlTestRow
+	e.Upsert, e.ConflictColumns = true, []string{"id"}
+
+	for _, count := range []int{1, 2} {
+		b := &RecordBuffer{NumRecordsToBuffer: 100}
+		for i := 0; i < 50; i++ {
+			b.ProcessRecord(sqlTestEvent{i, count}, fmt.Sprint(i+1), 0)
+		}
+		if err := e.Emit(b, nil, "shardId-000000000000"); err != nil {
+			t.Fatalf("Emit() = %v want nil", err)
+		}
+	}
+
+	var n, sum int
+	db.QueryRow("SELECT COUNT(*), SUM(count) FROM test_sql_emitter").Scan(&n, &sum)
+	if n != 50 || sum != 100 {
+		t.Errorf("table has %v rows with a count of %v want 50 and 100", n, sum)
+	}
+}
+
+func Test_SQLEmitterMysql(t *testing.T) {
+	db, _ := sql.Open("mysql", os.Getenv("CHECKPOINT_MYSQL_DSN"))
+	testSQLEmitter(t, db, SQLEmitter{Dialect: SQLMysql}, "CREATE TABLE test_sql_emitter (id INT PRIMARY KEY, count INT)")
+}
+
+func Test_SQLEmitterPostgres(t *testing.T) {
+	db, _ := sql.Open("pgx", os.Getenv("POSTGRES_URL"))
+	testSQLEmitter(t, db, SQLEmitter{Dialect: SQLPostgres}, "CREATE TABLE test_sql_emitter (id INT PRIMARY KEY, count INT)")
+	testSQLEmitter(t, db, SQLEmitter{Dialect: SQLPostgres, Copy: true}, "CREATE TABLE test_sql_emitter (id INT PRIMARY KEY, count INT)")
+}
@@ -0,0 +1,145 @@
+package connector
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/AdRoll/goamz/aws"
+	l4g "github.com/ezoic/log4go"
+)
+
+// SendMessageBatch and PublishBatch limits: entries per call and bytes per call.
+const (
+	maxMessageBatchCount = 10
+	maxMessageBatchSize  = 256 * 1024
+)
+
+// SQSEmitter is an implementation of Emitter that sends each buffered record as a message to an
+// SQS queue with SendMessageBatch. Entries rejected in a response are retried on their own,
+// unless SQS reports the failure as the sender's fault.
+type SQSEmitter struct {
+	// QueueURL is where requests are sent, so it can also point at a local stand-in.
+	QueueURL string
+
+	// Region signs requests. When empty, it is taken from the QueueURL host, e.g.
+	// https://sqs.eu-west-1.amazonaws.com/123456789012/queue, or is us-east-1 for other hosts.
+	Region string
+
+	// Auth signs requests. When nil, credentials are read from the environment on every Emit.
+	Auth *aws.Auth
+
+	// MessageGroupID returns the message group of a record on a FIFO queue. When nil, the
+	// source shard ID is used for queues whose name ends in .fifo, which keeps each source
+	// shard's records in order.
+	MessageGroupID func(record interface{}, data []byte) string
+
+	// MessageDeduplicationID returns the deduplication ID of a record on a FIFO queue. When nil,
+	// the queue must have content-based deduplication enabled.
+	MessageDeduplicationID func(record interface{}, data []byte) string
+}
+
+type sqsSendMessageBatchResponse struct {
+	Failed []batchEntryFailure `xml:"SendMessageBatchResult>BatchResultErrorEntry"`
+}
+
+// messageEntry is one message of a SendMessageBatch or PublishBatch request.
+type messageEntry struct {
+	Body            string
+	GroupID         string
+	DeduplicationID string
+}
+
+// Emit is invoked when the buffer is full. It sends every buffered record to QueueURL.
+func (e SQSEmitter) Emit(b Buffer, t Transformer, shardID string) error {
+	region := e.Region
+	if region == "" {
+		region = sqsQueueRegion(e.QueueURL)
+	}
+	client, err := newAwsClient("sqs", region, e.QueueURL, e.Auth)
+	if err != nil {
+		return err
+	}
+
+	fifo := strings.HasSuffix(e.QueueURL, ".fifo")
+	entries, sizes := messageEntries(b, t, shardID, fifo, e.MessageGroupID, e.MessageDeduplicationID)
+
+	infoString := "sqs emitter on shard " + shardID
+	for _, r := range batchRanges(sizes, maxMessageBatchCount, maxMessageBatchSize) {
+		err = sendWithRetry(indexes(r[0], r[1]), func(ids []int) ([]int, error) {
+			return e.sendMessageBatch(client, entries, ids)
+		}, infoString)
+		if err != nil {
+			l4g.Error("SendMessageBatch ERROR: %v", err)
+			return err
+		}
+	}
+
+	l4g.Info("[%v] records emitted to [%s] on shard [%v]", b.NumRecordsInBuffer(), e.QueueURL, shardID)
+	return nil
+}
+
+func (e SQSEmitter) sendMessageBatch(client *awsClient, entries []messageEntry, ids []int) ([]int, error) {
+	params := url.Values{}
+	params.Set("Action", "SendMessageBatch")
+	params.Set("Version", "2012-11-05")
+	for n, id := range ids {
+		prefix := fmt.Sprintf("SendMessageBatchRequestEntry.%d.", n+1)
+		params.Set(prefix+"Id", strconv.Itoa(id))
+		params.Set(prefix+"MessageBody", entries[id].Body)
+		if entries[id].GroupID != "" {
+			params.Set(prefix+"MessageGroupId", entries[id].GroupID)
+		}
+		if entries[id].DeduplicationID != "" {
+			params.Set(prefix+"MessageDeduplicationId", entries[id].DeduplicationID)
+		}
+	}
+
+	var resp sqsSendMessageBatchResponse
+	if err := client.callQuery(client.Endpoint, params, &resp); err != nil {
+		return nil, err
+	}
+	return failedEntries(resp.Failed)
+}
+
+// messageEntries builds a message for every buffered record, along with their sizes. On FIFO
+// queues and topics the message group defaults to the shard ID.
+func messageEntries(b Buffer, t Transformer, shardID string, fifo bool, groupID func(interface{}, []byte) string, dedupID func(interface{}, []byte) string) ([]messageEntry, []int) {
+	entries := make([]messageEntry, 0, b.NumRecordsInBuffer())
+	sizes := make([]int, 0, b.NumRecordsInBuffer())
+	for _, r := range b.Records() {
+		data := t.FromRecord(r)
+		m := messageEntry{Body: string(data)}
+		if groupID != nil {
+			m.GroupID = groupID(r, data)
+		} else if fifo {
+			m.GroupID = shardID
+		}
+		if dedupID != nil {
+			m.DeduplicationID = dedupID(r, data)
+		}
+		entries = append(entries, m)
+		sizes = append(sizes, len(data))
+	}
+	return entries, sizes
+}
+
+// sqsQueueRegion returns the region of a queue URL of the form sqs.<region>.amazonaws.com, as
+// also used by VPC endpoints, or the legacy <region>.queue.amazonaws.com, or "" for other hosts.
+func sqsQueueRegion(queueURL string) string {
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(u.Hostname(), ".")
+	for i, p := range parts {
+		if p == "sqs" && i+2 < len(parts) {
+			return parts[i+1]
+		}
+		if p == "queue" && i > 0 && i+1 < len(parts) && parts[i+1] == "amazonaws" {
+			return parts[i-1]
+		}
+	}
+	return ""
+}
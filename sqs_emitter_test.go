@@ -0,0 +1,119 @@
+package connector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// queryStandIn accepts SQS SendMessageBatch or SNS PublishBatch calls, reporting the second entry
+// of the first call as failed. Each call's entries are recorded as "body/group/dedup".
+func queryStandIn(t *testing.T, action string, entryPrefix string, calls *[][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if a := r.Form.Get("Action"); a != action {
+			t.Errorf("Action = %v want %v", a, action)
+		}
+
+		var entries []string
+		var failed string
+		for n := 1; r.Form.Get(fmt.Sprintf("%s.%d.Id", entryPrefix, n)) != ""; n++ {
+			prefix := fmt.Sprintf("%s.%d.", entryPrefix, n)
+			body := r.Form.Get(prefix + "MessageBody")
+			if action == "PublishBatch" {
+				body = r.Form.Get(prefix + "Message")
+			}
+			entries = append(entries, body+"/"+r.Form.Get(prefix+"MessageGroupId")+"/"+r.Form.Get(prefix+"MessageDeduplicationId"))
+			if len(*calls) == 0 && n == 2 {
+				failed = r.Form.Get(prefix + "Id")
+			}
+		}
+		*calls = append(*calls, entries)
+
+		failure := ""
+		if failed != "" {
+			failure = "<Id>" + failed + "</Id><Code>InternalError</Code><Message>try again</Message><SenderFault>false</SenderFault>"
+		}
+		if action == "PublishBatch" {
+			if failure != "" {
+				failure = "<member>" + failure + "</member>"
+			}
+			fmt.Fprintf(w, "<PublishBatchResponse><PublishBatchResult><Successful></Successful><Failed>%s</Failed></PublishBatchResult></PublishBatchResponse>", failure)
+			return
+		}
+		if failure != "" {
+			failure = "<BatchResultErrorEntry>" + failure + "</BatchResultErrorEntry>"
+		}
+		fmt.Fprintf(w, "<SendMessageBatchResponse><SendMessageBatchResult>%s</SendMessageBatchResult></SendMessageBatchResponse>", failure)
+	}))
+}
+
+func TestSQSEmitter(t *testing.T) {
+	var calls [][]string
+	server := queryStandIn(t, "SendMessageBatch", "SendMessageBatchRequestEntry", &calls)
+	defer server.Close()
+
+	b := &RecordBuffer{NumRecordsToBuffer: 20}
+	for i := 0; i < 12; i++ {
+		b.ProcessRecord(fmt.Sprint(i), fmt.Sprint(i+1), 0)
+	}
+
+	e := SQSEmitter{
+		QueueURL:               server.URL + "/123456789012/queue.fifo",
+		Auth:                   testAwsAuth,
+		MessageDeduplicationID: func(r interface{}, data []byte) string { return "d" + string(data) },
+	}
+	if err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000"); err != nil {
+		t.Fatalf("Emit() = %v want nil", err)
+	}
+
+	var first []string
+	for i := 0; i < 10; i++ {
+		first = append(first, fmt.Sprintf("%d/shardId-000000000000/d%d", i, i))
+	}
+	want := [][]string{
+		first,
+		{"1/shardId-000000000000/d1"},
+		{"10/shardId-000000000000/d10", "11/shardId-000000000000/d11"},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("SendMessageBatch calls = %q want %q", calls, want)
+	}
+}
+
+func TestSQSEmitterSenderFault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<SendMessageBatchResponse><SendMessageBatchResult><BatchResultErrorEntry><Id>0</Id><Code>InvalidMessageContents</Code><Message>bad</Message><SenderFault>true</SenderFault></BatchResultErrorEntry></SendMessageBatchResult></SendMessageBatchResponse>")
+	}))
+	defer server.Close()
+
+	b := &RecordBuffer{NumRecordsToBuffer: 10}
+	b.ProcessRecord("a", "1", 0)
+
+	e := SQSEmitter{QueueURL: server.URL + "/123456789012/queue", Auth: testAwsAuth}
+	if err := e.Emit(b, StringToStringTransformer{}, "shardId-000000000000"); err == nil {
+		t.Errorf("Emit() = nil want an error")
+	}
+}
+
+func TestSQSQueueRegion(t *testing.T) {
+	testCases := []struct {
+		queueURL string
+		region   string
+	}{
+		{queueURL: "https://sqs.eu-west-1.amazonaws.com/123456789012/queue", region: "eu-west-1"},
+		{queueURL: "https://sqs.cn-north-1.amazonaws.com.cn/123456789012/queue", region: "cn-north-1"},
+		{queueURL: "https://vpce-0123-abcd.sqs.us-west-2.vpce.amazonaws.com/123456789012/queue", region: "us-west-2"},
+		{queueURL: "https://ap-southeast-2.queue.amazonaws.com/123456789012/queue", region: "ap-southeast-2"},
+		{queueURL: "https://queue.amazonaws.com/123456789012/queue", region: ""},
+		{queueURL: "http://127.0.0.1:9324/123456789012/queue", region: ""},
+	}
+
+	for idx, tc := range testCases {
+		if r := sqsQueueRegion(tc.queueURL); r != tc.region {
+			t.Errorf("test case %d: sqsQueueRegion(%v) = %v want %v", idx, tc.queueURL, r, tc.region)
+		}
+	}
+}
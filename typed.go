@@ -0,0 +1,337 @@
+package connector
+
+import "time"
+
+// TypedTransformer is a Transformer of records of type T.
+type TypedTransformer[T any] interface {
+	FromRecord(r T) []byte
+	ToRecord(data []byte) T
+}
+
+// TypedRecordTransformer is a RecordTransformer of records of type T.
+type TypedRecordTransformer[T any] interface {
+	TypedTransformer[T]
+	ToRecordWithMetadata(r *Record) T
+}
+
+// TypedDecodingTransformer is a DecodingTransformer of records of type T.
+type TypedDecodingTransformer[T any] interface {
+	TypedTransformer[T]
+	DecodeRecord(r *Record) (T, error)
+}
+
+// TypedFilter is a Filter of records of type T.
+type TypedFilter[T any] interface {
+	KeepRecord(r T) bool
+}
+
+// TypedRecordFilter is a RecordFilter of records of type T.
+type TypedRecordFilter[T any] interface {
+	TypedFilter[T]
+	KeepRecordWithMetadata(record T, r *Record) bool
+}
+
+// TypedFilterFunc adapts a function to a TypedFilter.
+type TypedFilterFunc[T any] func(r T) bool
+
+// KeepRecord calls f(r).
+func (f TypedFilterFunc[T]) KeepRecord(r T) bool {
+	return f(r)
+}
+
+// TypedBuffer is a Buffer of records of type T. Where a Buffer is given a nil record for a
+// filtered record whose sequence number should still be checkpointed, a TypedBuffer is given
+// SkipRecord.
+type TypedBuffer[T any] interface {
+	ProcessRecord(record T, sequenceNumber string, approximateArrivalTime int)
+	SkipRecord(sequenceNumber string, approximateArrivalTime int)
+	FirstSequenceNumber() string
+	Flush()
+	LastSequenceNumber() string
+	LastApproximateArrivalTime() int
+	NumRecordsInBuffer() int
+	Records() []T
+	ShouldFlush() bool
+}
+
+// TypedEmitter is an Emitter of records of type T.
+type TypedEmitter[T any] interface {
+	Emit(b TypedBuffer[T], t TypedTransformer[T], shardID string) error
+}
+
+// The adapters below convert between the typed and the interface{} API, so that the existing
+// filters and emitters work in a TypedPipeline and typed ones in a Pipeline. Records crossing
+// from interface{} to T are type asserted, which panics on records of another type. Adapting
+// an adapter back returns the value it wraps. Record metadata is passed through when the
+// wrapped value takes it, and emitter adapters forward FlushInterval and FlushShard to a
+// wrapped ShardFlusher.
+
+// UntypedTransformer adapts a TypedTransformer to a Transformer.
+func UntypedTransformer[T any](t TypedTransformer[T]) Transformer {
+	if a, ok := t.(typedTransformer[T]); ok {
+		return a.Transformer
+	}
+	return untypedTransformer[T]{t}
+}
+
+// TypedTransformerOf adapts a Transformer to a TypedTransformer.
+func TypedTransformerOf[T any](t Transformer) TypedTransformer[T] {
+	if a, ok := t.(untypedTransformer[T]); ok {
+		return a.TypedTransformer
+	}
+	return typedTransformer[T]{t}
+}
+
+type untypedTransformer[T any] struct {
+	TypedTransformer[T]
+}
+
+func (a untypedTransformer[T]) FromRecord(r interface{}) []byte {
+	return a.TypedTransformer.FromRecord(r.(T))
+}
+
+func (a untypedTransformer[T]) ToRecord(data []byte) interface{} {
+	return a.TypedTransformer.ToRecord(data)
+}
+
+func (a untypedTransformer[T]) ToRecordWithMetadata(r *Record) interface{} {
+	if rt, ok := a.TypedTransformer.(TypedRecordTransformer[T]); ok {
+		return rt.ToRecordWithMetadata(r)
+	}
+	return a.TypedTransformer.ToRecord(r.Data)
+}
+
+func (a untypedTransformer[T]) DecodeRecord(r *Record) (interface{}, error) {
+	if dt, ok := a.TypedTransformer.(TypedDecodingTransformer[T]); ok {
+		return dt.DecodeRecord(r)
+	}
+	return a.ToRecordWithMetadata(r), nil
+}
+
+type typedTransformer[T any] struct {
+	Transformer
+}
+
+func (a typedTransformer[T]) FromRecord(r T) []byte {
+	return a.Transformer.FromRecord(r)
+}
+
+func (a typedTransformer[T]) ToRecord(data []byte) T {
+	return a.Transformer.ToRecord(data).(T)
+}
+
+func (a typedTransformer[T]) ToRecordWithMetadata(r *Record) T {
+	if rt, ok := a.Transformer.(RecordTransformer); ok {
+		return rt.ToRecordWithMetadata(r).(T)
+	}
+	return a.ToRecord(r.Data)
+}
+
+func (a typedTransformer[T]) DecodeRecord(r *Record) (T, error) {
+	if dt, ok := a.Transformer.(DecodingTransformer); ok {
+		record, err := dt.DecodeRecord(r)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		return record.(T), nil
+	}
+	return a.ToRecordWithMetadata(r), nil
+}
+
+// UntypedFilter adapts a TypedFilter to a Filter.
+func UntypedFilter[T any](f TypedFilter[T]) Filter {
+	if a, ok := f.(typedFilter[T]); ok {
+		return a.Filter
+	}
+	return untypedFilter[T]{f}
+}
+
+// TypedFilterOf adapts a Filter, e.g. an expression filter, to a TypedFilter.
+func TypedFilterOf[T any](f Filter) TypedFilter[T] {
+	if a, ok := f.(untypedFilter[T]); ok {
+		return a.TypedFilter
+	}
+	return typedFilter[T]{f}
+}
+
+type untypedFilter[T any] struct {
+	TypedFilter[T]
+}
+
+func (a untypedFilter[T]) KeepRecord(r interface{}) bool {
+	return a.TypedFilter.KeepRecord(r.(T))
+}
+
+func (a untypedFilter[T]) KeepRecordWithMetadata(record interface{}, r *Record) bool {
+	if rf, ok := a.TypedFilter.(TypedRecordFilter[T]); ok {
+		return rf.KeepRecordWithMetadata(record.(T), r)
+	}
+	return a.KeepRecord(record)
+}
+
+type typedFilter[T any] struct {
+	Filter
+}
+
+func (a typedFilter[T]) KeepRecord(r T) bool {
+	return a.Filter.KeepRecord(r)
+}
+
+func (a typedFilter[T]) KeepRecordWithMetadata(record T, r *Record) bool {
+	return keepRecord(a.Filter, record, r)
+}
+
+// UntypedBuffer adapts a TypedBuffer to a Buffer. Its Records copies the records into a new
+// slice on every call.
+func UntypedBuffer[T any](b TypedBuffer[T]) Buffer {
+	if a, ok := b.(*typedBuffer[T]); ok {
+		return a.Buffer
+	}
+	return &untypedBuffer[T]{b}
+}
+
+// TypedBufferOf adapts a Buffer to a TypedBuffer. Its Records copies the records into a new
+// slice on every call.
+func TypedBufferOf[T any](b Buffer) TypedBuffer[T] {
+	if a, ok := b.(*untypedBuffer[T]); ok {
+		return a.TypedBuffer
+	}
+	return &typedBuffer[T]{b}
+}
+
+type untypedBuffer[T any] struct {
+	TypedBuffer[T]
+}
+
+func (a *untypedBuffer[T]) ProcessRecord(record interface{}, sequenceNumber string, approximateArrivalTime int) {
+	if record == nil {
+		a.TypedBuffer.SkipRecord(sequenceNumber, approximateArrivalTime)
+		return
+	}
+	a.TypedBuffer.ProcessRecord(record.(T), sequenceNumber, approximateArrivalTime)
+}
+
+func (a *untypedBuffer[T]) ProcessRecordWithMetadata(record interface{}, r *Record) {
+	if mb, ok := a.TypedBuffer.(interface {
+		ProcessRecordWithMetadata(record T, r *Record)
+	}); ok && record != nil {
+		mb.ProcessRecordWithMetadata(record.(T), r)
+		return
+	}
+	a.ProcessRecord(record, r.SequenceNumber, r.arrivalTime())
+}
+
+func (a *untypedBuffer[T]) Metadata() []*Record {
+	return BufferMetadata(a.TypedBuffer)
+}
+
+func (a *untypedBuffer[T]) routeKey() string {
+	return BufferRoute(a.TypedBuffer)
+}
+
+func (a *untypedBuffer[T]) unwrap() interface{} {
+	return a.TypedBuffer
+}
+
+func (a *untypedBuffer[T]) Records() []interface{} {
+	records := a.TypedBuffer.Records()
+	out := make([]interface{}, len(records))
+	for i, r := range records {
+		out[i] = r
+	}
+	return out
+}
+
+type typedBuffer[T any] struct {
+	Buffer
+}
+
+func (a *typedBuffer[T]) ProcessRecord(record T, sequenceNumber string, approximateArrivalTime int) {
+	a.Buffer.ProcessRecord(record, sequenceNumber, approximateArrivalTime)
+}
+
+func (a *typedBuffer[T]) SkipRecord(sequenceNumber string, approximateArrivalTime int) {
+	a.Buffer.ProcessRecord(nil, sequenceNumber, approximateArrivalTime)
+}
+
+func (a *typedBuffer[T]) ProcessRecordWithMetadata(record T, r *Record) {
+	if mb, ok := a.Buffer.(MetadataBuffer); ok {
+		mb.ProcessRecordWithMetadata(record, r)
+		return
+	}
+	a.Buffer.ProcessRecord(record, r.SequenceNumber, r.arrivalTime())
+}
+
+func (a *typedBuffer[T]) Metadata() []*Record {
+	return BufferMetadata(a.Buffer)
+}
+
+func (a *typedBuffer[T]) routeKey() string {
+	return BufferRoute(a.Buffer)
+}
+
+func (a *typedBuffer[T]) Records() []T {
+	records := a.Buffer.Records()
+	out := make([]T, len(records))
+	for i, r := range records {
+		out[i] = r.(T)
+	}
+	return out
+}
+
+// UntypedEmitter adapts a TypedEmitter to an Emitter.
+func UntypedEmitter[T any](e TypedEmitter[T]) Emitter {
+	if a, ok := e.(typedEmitter[T]); ok {
+		return a.Emitter
+	}
+	return untypedEmitter[T]{e}
+}
+
+// TypedEmitterOf adapts an Emitter, e.g. an S3Emitter, to a TypedEmitter.
+func TypedEmitterOf[T any](e Emitter) TypedEmitter[T] {
+	if a, ok := e.(untypedEmitter[T]); ok {
+		return a.TypedEmitter
+	}
+	return typedEmitter[T]{e}
+}
+
+type untypedEmitter[T any] struct {
+	TypedEmitter[T]
+}
+
+func (a untypedEmitter[T]) Emit(b Buffer, t Transformer, shardID string) error {
+	return a.TypedEmitter.Emit(TypedBufferOf[T](b), TypedTransformerOf[T](t), shardID)
+}
+
+func (a untypedEmitter[T]) FlushInterval() time.Duration {
+	return flushInterval(a.TypedEmitter)
+}
+
+func (a untypedEmitter[T]) FlushShard(shardID string, final bool) error {
+	return flushShard(a.TypedEmitter, shardID, final)
+}
+
+func (a untypedEmitter[T]) wrappedEmitters() []interface{} {
+	return []interface{}{a.TypedEmitter}
+}
+
+type typedEmitter[T any] struct {
+	Emitter
+}
+
+func (a typedEmitter[T]) Emit(b TypedBuffer[T], t TypedTransformer[T], shardID string) error {
+	return a.Emitter.Emit(UntypedBuffer(b), UntypedTransformer(t), shardID)
+}
+
+func (a typedEmitter[T]) FlushInterval() time.Duration {
+	return flushInterval(a.Emitter)
+}
+
+func (a typedEmitter[T]) FlushShard(shardID string, final bool) error {
+	return flushShard(a.Emitter, shardID, final)
+}
+
+func (a typedEmitter[T]) wrappedEmitters() []interface{} {
+	return []interface{}{a.Emitter}
+}
@@ -0,0 +1,61 @@
+package connector
+
+import (
+	"sync"
+
+	"github.com/ezoic/go-kinesis"
+	"github.com/ezoic/klease"
+)
+
+// TypedPipeline is a Pipeline whose Transformer, Filter, Buffer and Emitter work on records
+// of type T, so that mismatched components fail to compile instead of panicking on a type
+// assertion. The interface{} filters and emitters can be used through TypedFilterOf and
+// TypedEmitterOf.
+type TypedPipeline[T any] struct {
+	Buffer      TypedBuffer[T]
+	Checkpoint  Checkpoint
+	Dedup       *Deduplicator
+	Emitter     TypedEmitter[T]
+	Filter      TypedFilter[T] // keeps every record when nil
+	StreamName  string
+	Transformer TypedTransformer[T]
+
+	ShardIteratorInitType     string
+	CheckpointFilteredRecords bool
+	GetRecordsLimit           int
+	LeaseCoordinator          *klease.Coordinator
+	Deaggregate               bool
+	Running                   *ShardSet
+	PipelineLock              *sync.Mutex
+	RunningPipes              map[string]bool
+}
+
+// Pipeline returns the Pipeline running p, with its components adapted to the interface{} API.
+func (p TypedPipeline[T]) Pipeline() Pipeline {
+	var f Filter = &AllPassFilter{}
+	if p.Filter != nil {
+		f = UntypedFilter(p.Filter)
+	}
+	return Pipeline{
+		Buffer:                    UntypedBuffer(p.Buffer),
+		Checkpoint:                p.Checkpoint,
+		Dedup:                     p.Dedup,
+		Emitter:                   UntypedEmitter(p.Emitter),
+		Filter:                    f,
+		StreamName:                p.StreamName,
+		Transformer:               UntypedTransformer(p.Transformer),
+		ShardIteratorInitType:     p.ShardIteratorInitType,
+		CheckpointFilteredRecords: p.CheckpointFilteredRecords,
+		GetRecordsLimit:           p.GetRecordsLimit,
+		LeaseCoordinator:          p.LeaseCoordinator,
+		Deaggregate:               p.Deaggregate,
+		Running:                   p.Running,
+		PipelineLock:              p.PipelineLock,
+		RunningPipes:              p.RunningPipes,
+	}
+}
+
+// ProcessShard kicks off the process of a Kinesis Shard, as Pipeline.ProcessShard.
+func (p TypedPipeline[T]) ProcessShard(ksis *kinesis.Kinesis, shardID string) {
+	p.Pipeline().ProcessShard(ksis, shardID)
+}
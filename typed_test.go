@@ -0,0 +1,100 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+)
+
+type typedClick struct {
+	User string `json:"user"`
+	Page string `json:"page"`
+}
+
+// typedClickEmitter is a TypedEmitter remembering what it was given.
+type typedClickEmitter struct {
+	buffer  TypedBuffer[typedClick]
+	records []typedClick
+}
+
+func (e *typedClickEmitter) Emit(b TypedBuffer[typedClick], t TypedTransformer[typedClick], shardID string) error {
+	e.buffer = b
+	e.records = append(e.records, b.Records()...)
+	return nil
+}
+
+func Test_TypedPipelineAdapters(t *testing.T) {
+	b := &TypedRecordBuffer[typedClick]{NumRecordsToBuffer: 10}
+	e := &typedClickEmitter{}
+	p := TypedPipeline[typedClick]{
+		Buffer:      b,
+		Emitter:     e,
+		Filter:      TypedFilterFunc[typedClick](func(c typedClick) bool { return c.Page != "" }),
+		Transformer: JSONTransformer[typedClick]{},
+	}.Pipeline()
+
+	// drive the untyped pipeline components as processShardInternal does
+	for i, data := range []string{`{"user":"a","page":"/"}`, `{"user":"b"}`, `{"user":"c","page":"/x"}`} {
+		r := p.Transformer.ToRecord([]byte(data))
+		if p.Filter.KeepRecord(r) {
+			p.Buffer.ProcessRecord(r, string(rune('1'+i)), 0)
+		} else {
+			p.Buffer.ProcessRecord(nil, string(rune('1'+i)), 0)
+		}
+	}
+	if err := p.Emitter.Emit(p.Buffer, p.Transformer, "shard"); err != nil {
+		t.Fatalf("Emit() returned %s", err)
+	}
+
+	want := []typedClick{{"a", "/"}, {"c", "/x"}}
+	if !reflect.DeepEqual(e.records, want) {
+		t.Errorf("emitted %v want %v", e.records, want)
+	}
+	if e.buffer != b {
+		t.Errorf("Emit() was given %T, not the pipeline's buffer", e.buffer)
+	}
+	if got := b.LastSequenceNumber(); got != "3" {
+		t.Errorf("LastSequenceNumber() = %v want %v", got, "3")
+	}
+}
+
+func Test_TypedEmitterOf(t *testing.T) {
+	e := &collectingEmitter{}
+	b := &TypedRecordBuffer[string]{NumRecordsToBuffer: 10}
+	b.ProcessRecord("a", "1", 0)
+	b.SkipRecord("2", 0)
+	b.ProcessRecord("b", "3", 0)
+
+	te := TypedEmitterOf[string](e)
+	if err := te.Emit(b, TypedTransformerOf[string](StringToStringTransformer{}), "shard"); err != nil {
+		t.Fatalf("Emit() returned %s", err)
+	}
+	want := [][]interface{}{{"a", "b"}}
+	if !reflect.DeepEqual(e.records, want) {
+		t.Errorf("emitted %v want %v", e.records, want)
+	}
+
+	if got := UntypedEmitter(te); got != Emitter(e) {
+		t.Errorf("UntypedEmitter(TypedEmitterOf(e)) = %v want %v", got, e)
+	}
+}
+
+func Test_TypedFilterOf(t *testing.T) {
+	ef, err := NewExpressionFilter(`page == "/"`)
+	if err != nil {
+		t.Fatalf("NewExpressionFilter() returned %s", err)
+	}
+	f := TypedFilterOf[map[string]interface{}](ef)
+
+	cases := []struct {
+		record map[string]interface{}
+		want   bool
+	}{
+		{map[string]interface{}{"page": "/"}, true},
+		{map[string]interface{}{"page": "/x"}, false},
+	}
+	for _, c := range cases {
+		if got := f.KeepRecord(c.record); got != c.want {
+			t.Errorf("KeepRecord(%v) = %v want %v", c.record, got, c.want)
+		}
+	}
+}